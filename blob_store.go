@@ -0,0 +1,25 @@
+package omniq
+
+import "errors"
+
+var (
+	ErrBlobNotFound           = errors.New("omniq: blob not found")
+	ErrBlobPreconditionFailed = errors.New("omniq: blob generation mismatch")
+	ErrBlobInvalidKey         = errors.New("omniq: invalid blob key")
+)
+
+// BlobStore is the minimal surface of an object storage bucket (S3, GCS, ...)
+// needed by the bucket storage. Generations are opaque strings such as an ETag
+// or a GCS object generation.
+type BlobStore interface {
+	// Get returns the object and its current generation, or ErrBlobNotFound.
+	Get(key string) ([]byte, string, error)
+	// Put writes the object only if its current generation equals ifGeneration.
+	// An empty ifGeneration means the object must not exist yet. On mismatch it
+	// returns ErrBlobPreconditionFailed.
+	Put(key string, data []byte, ifGeneration string) (string, error)
+	// Delete removes the object. Deleting a missing object is not an error.
+	Delete(key string) error
+	// List returns the keys of all objects starting with prefix.
+	List(prefix string) ([]string, error)
+}
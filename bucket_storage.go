@@ -0,0 +1,357 @@
+package omniq
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type bucketEntry struct {
+	ID    JobID
+	Time  time.Time
+	Type  string
+	Queue string `json:",omitempty"`
+	storedPayload
+	Attempts int `json:",omitempty"`
+}
+
+type bucketStorageOptions struct {
+	prefix        string
+	historyPrefix string
+	deadPrefix    string
+	codec         Codec
+}
+
+func newDefaultBucketStorageOptions() bucketStorageOptions {
+	return bucketStorageOptions{prefix: "omniq/jobs/", historyPrefix: "omniq/history/", deadPrefix: "omniq/dead/"}
+}
+
+type bucketStorageOption func(*bucketStorageOptions)
+
+func WithKeyPrefix(prefix string) bucketStorageOption {
+	return func(opts *bucketStorageOptions) {
+		opts.prefix = prefix
+	}
+}
+
+// WithHistoryKeyPrefix sets where history records are stored. It must not
+// overlap the job prefix.
+func WithHistoryKeyPrefix(prefix string) bucketStorageOption {
+	return func(opts *bucketStorageOptions) {
+		opts.historyPrefix = prefix
+	}
+}
+
+// WithDeadLetterKeyPrefix sets where jobs that cannot be run are moved. It
+// must not overlap the job prefix.
+func WithDeadLetterKeyPrefix(prefix string) bucketStorageOption {
+	return func(opts *bucketStorageOptions) {
+		opts.deadPrefix = prefix
+	}
+}
+
+// WithBucketCodec sets the codec jobs are encoded with, unless they name
+// their own. Payloads of other codecs are stored base64-encoded.
+func WithBucketCodec(c Codec) bucketStorageOption {
+	return func(opts *bucketStorageOptions) {
+		opts.codec = c
+	}
+}
+
+// bucketStorage keeps one object per job. Claims are conditional writes of the
+// lease expiry, so concurrent consumers never hand out the same job twice.
+type bucketStorage[T any] struct {
+	blobs   BlobStore
+	factory JobFactory[T]
+	options bucketStorageOptions
+}
+
+func NewBucketStorage[T any](blobs BlobStore, factory JobFactory[T], opts ...bucketStorageOption) *bucketStorage[T] {
+	options := newDefaultBucketStorageOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return &bucketStorage[T]{blobs: blobs, factory: factory, options: options}
+}
+
+func (s *bucketStorage[T]) key(id JobID) string {
+	return s.options.prefix + string(id) + ".json"
+}
+
+func (s *bucketStorage[T]) keyID(key string) JobID {
+	return JobID(strings.TrimSuffix(strings.TrimPrefix(key, s.options.prefix), ".json"))
+}
+
+func (s *bucketStorage[T]) jobCodec() Codec {
+	return s.options.codec
+}
+
+func (s *bucketStorage[T]) Push(j Job[T], t time.Time) error {
+	payload, err := encodeJob(j, s.options.codec)
+	if err != nil {
+		return err
+	}
+
+	id := JobID(uuid.New().String())
+	content, err := json.Marshal(bucketEntry{ID: id, Time: t, Type: j.Type(), Queue: jobQueue(j), storedPayload: newStoredPayload(payload)})
+	if err != nil {
+		return err
+	}
+	if _, err := s.blobs.Put(s.key(id), content, ""); err != nil {
+		return err
+	}
+	j.GetIDContainer().SetID(id)
+	return nil
+}
+
+// PushRetry writes the job's object, replacing it if it is still there. A
+// concurrent claim of the old object fails the write with
+// ErrBlobPreconditionFailed.
+func (s *bucketStorage[T]) PushRetry(j Job[T], t time.Time, attempts int) error {
+	payload, err := encodeJob(j, s.options.codec)
+	if err != nil {
+		return err
+	}
+
+	id := j.GetIDContainer().GetID()
+	content, err := json.Marshal(bucketEntry{ID: id, Time: t, Type: j.Type(), Queue: jobQueue(j), storedPayload: newStoredPayload(payload), Attempts: attempts})
+	if err != nil {
+		return err
+	}
+	_, generation, err := s.blobs.Get(s.key(id))
+	if errors.Is(err, ErrBlobNotFound) {
+		generation = ""
+	} else if err != nil {
+		return err
+	}
+	_, err = s.blobs.Put(s.key(id), content, generation)
+	return err
+}
+
+func (s *bucketStorage[T]) Delete(id JobID) error {
+	return s.blobs.Delete(s.key(id))
+}
+
+func (s *bucketStorage[T]) GetDue() ([]Job[T], error) {
+	keys, err := s.blobs.List(s.options.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	due := []bucketEntry{}
+	jobs := []Job[T]{}
+	for _, key := range keys {
+		e, ok, err := s.claim(key, now)
+		var corrupt *corruptRecordError
+		if errors.As(err, &corrupt) {
+			jobs = append(jobs, &PoisonJob[T]{WithID: WithID{ID: s.keyID(key)}, Payload: corrupt.payload(), Err: err})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			due = append(due, e)
+		}
+	}
+	sort.Slice(due, func(a, b int) bool { return due[a].Time.Before(due[b].Time) })
+
+	for _, e := range due {
+		jobs = append(jobs, instantiateClaimed(s.factory, e.Type, e.ID, e.payload(), e.Attempts+1))
+	}
+	return jobs, nil
+}
+
+// claim pushes the job's due time past the lease if it is due. It reports false
+// when the job is not due or another consumer got to it first, and fails with
+// a *corruptRecordError if the object does not parse, which cannot be leased.
+func (s *bucketStorage[T]) claim(key string, now time.Time) (bucketEntry, bool, error) {
+	var e bucketEntry
+	content, generation, err := s.blobs.Get(key)
+	if errors.Is(err, ErrBlobNotFound) {
+		return e, false, nil
+	}
+	if err != nil {
+		return e, false, err
+	}
+	if err := json.Unmarshal(content, &e); err != nil {
+		return e, false, &corruptRecordError{record: content, err: err}
+	}
+	if e.Time.After(now) {
+		return e, false, nil
+	}
+
+	claimed := e
+	claimed.Time = now.Add(claimLease)
+	claimed.Attempts++
+	content, err = json.Marshal(claimed)
+	if err != nil {
+		return e, false, err
+	}
+	_, err = s.blobs.Put(key, content, generation)
+	if errors.Is(err, ErrBlobPreconditionFailed) {
+		return e, false, nil
+	}
+	if err != nil {
+		return e, false, err
+	}
+	return e, true, nil
+}
+
+// Query reads every job object, so it is meant for inspection rather than for
+// frequent calls.
+func (s *bucketStorage[T]) Query(f JobFilter) (JobPage, error) {
+	keys, err := s.blobs.List(s.options.prefix)
+	if err != nil {
+		return JobPage{}, err
+	}
+
+	jobs := make([]JobInfo, 0, len(keys))
+	for _, key := range keys {
+		content, _, err := s.blobs.Get(key)
+		if errors.Is(err, ErrBlobNotFound) {
+			continue
+		}
+		if err != nil {
+			return JobPage{}, err
+		}
+		var e bucketEntry
+		if err := json.Unmarshal(content, &e); err != nil {
+			return JobPage{}, err
+		}
+		jobs = append(jobs, JobInfo{ID: e.ID, Type: e.Type, Queue: cmp.Or(e.Queue, DefaultQueue), DueAt: e.Time, Attempts: e.Attempts, Payload: e.payload()})
+	}
+	return queryJobs(jobs, f, time.Now())
+}
+
+// DeadLetter writes the job under the dead letter prefix before deleting it,
+// so a crash in between leaves a copy rather than losing it.
+func (s *bucketStorage[T]) DeadLetter(id JobID, reason string) error {
+	content, _, err := s.blobs.Get(s.key(id))
+	if errors.Is(err, ErrBlobNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	dead := corruptDeadLetter(id, content, 0, reason)
+	var e bucketEntry
+	if err := json.Unmarshal(content, &e); err == nil {
+		dead = deadLetterEntry{ID: id, Type: e.Type, Queue: cmp.Or(e.Queue, DefaultQueue), storedPayload: e.storedPayload, Attempts: e.Attempts, Error: reason, FailedAt: time.Now()}
+	}
+
+	content, err = json.Marshal(dead)
+	if err != nil {
+		return err
+	}
+	if _, err := s.blobs.Put(s.options.deadPrefix+string(id)+".json", content, ""); err != nil {
+		return err
+	}
+	if err := s.blobs.Delete(s.key(id)); err != nil && !errors.Is(err, ErrBlobNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (s *bucketStorage[T]) DeadLetters() ([]DeadLetter, error) {
+	keys, err := s.blobs.List(s.options.deadPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	letters := make([]DeadLetter, 0, len(keys))
+	for _, key := range keys {
+		content, _, err := s.blobs.Get(key)
+		if errors.Is(err, ErrBlobNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var e deadLetterEntry
+		if err := json.Unmarshal(content, &e); err != nil {
+			return nil, err
+		}
+		letters = append(letters, e.deadLetter())
+	}
+	sort.SliceStable(letters, func(a, b int) bool { return letters[a].FailedAt.Before(letters[b].FailedAt) })
+	return letters, nil
+}
+
+// historyKey puts the finish time in the key, so pruning does not have to read
+// the records.
+func (s *bucketStorage[T]) historyKey(rec HistoryRecord) string {
+	return fmt.Sprintf("%s%s/%020d.json", s.options.historyPrefix, rec.ID, rec.FinishedAt.UnixNano())
+}
+
+func (s *bucketStorage[T]) Archive(rec HistoryRecord) error {
+	content, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = s.blobs.Put(s.historyKey(rec), content, "")
+	return err
+}
+
+func (s *bucketStorage[T]) History(id JobID) ([]HistoryRecord, error) {
+	keys, err := s.blobs.List(s.options.historyPrefix + string(id) + "/")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	recs := make([]HistoryRecord, 0, len(keys))
+	for _, key := range keys {
+		content, _, err := s.blobs.Get(key)
+		if errors.Is(err, ErrBlobNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var rec HistoryRecord
+		if err := json.Unmarshal(content, &rec); err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+func (s *bucketStorage[T]) PruneHistory(before time.Time, keep int) (int, error) {
+	if before.IsZero() && keep == 0 {
+		return 0, nil
+	}
+
+	keys, err := s.blobs.List(s.options.historyPrefix)
+	if err != nil {
+		return 0, err
+	}
+
+	finished := make([]time.Time, len(keys))
+	for i, key := range keys {
+		name := strings.TrimSuffix(key[strings.LastIndex(key, "/")+1:], ".json")
+		nanos, err := strconv.ParseInt(name, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("omniq: unexpected history key %q", key)
+		}
+		finished[i] = time.Unix(0, nanos)
+	}
+
+	expired := historyExpired(finished, before, keep)
+	for _, i := range expired {
+		if err := s.blobs.Delete(keys[i]); err != nil && !errors.Is(err, ErrBlobNotFound) {
+			return 0, err
+		}
+	}
+	return len(expired), nil
+}
@@ -0,0 +1,87 @@
+package omniq_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eugen-bondarev/omniq"
+	"github.com/eugen-bondarev/omniq/storagetest"
+)
+
+func TestBucketStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, factory omniq.JobFactory[struct{}]) omniq.SchedulerStorage[struct{}] {
+		blobs, err := omniq.NewFSBlobStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFSBlobStore: %v", err)
+		}
+		return omniq.NewBucketStorage(blobs, factory)
+	})
+}
+
+func TestBucketStorageCorruptObject(t *testing.T) {
+	blobs, err := omniq.NewFSBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := omniq.NewBucketStorage(blobs, &storagetest.Factory{})
+	if err := s.Push(&storagetest.TextJob{Text: "fine"}, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := blobs.Put("omniq/jobs/broken.json", []byte("{not json"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	due, err := s.GetDue()
+	if err != nil {
+		t.Fatalf("GetDue: %v", err)
+	}
+	if len(due) != 2 {
+		t.Fatalf("got %d jobs, want the poison job and the good one", len(due))
+	}
+	poison, ok := due[0].(*omniq.PoisonJob[struct{}])
+	if !ok || poison.ID != "broken" || poison.Err == nil {
+		t.Fatalf("got %#v, want a poison job for the corrupt object", due[0])
+	}
+
+	if err := s.DeadLetter(poison.ID, poison.Err.Error()); err != nil {
+		t.Fatalf("DeadLetter: %v", err)
+	}
+	letters, err := s.DeadLetters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 || string(letters[0].Payload.Data) != "{not json" || letters[0].Payload.Codec != "raw" {
+		t.Errorf("got %+v, want the corrupt object as it was stored", letters)
+	}
+	if due, err := s.GetDue(); err != nil || len(due) != 0 {
+		t.Errorf("GetDue after dead-lettering = %v, %v", due, err)
+	}
+}
+
+func TestFSBlobStoreKeys(t *testing.T) {
+	root := t.TempDir()
+	blobs, err := omniq.NewFSBlobStore(filepath.Join(root, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"../outside.json", "jobs/../../outside.json", "jobs/../a.json", "/etc/passwd", ""} {
+		if _, err := blobs.Put(key, []byte("{}"), ""); !errors.Is(err, omniq.ErrBlobInvalidKey) {
+			t.Errorf("Put(%q) = %v, want ErrBlobInvalidKey", key, err)
+		}
+		if _, _, err := blobs.Get(key); !errors.Is(err, omniq.ErrBlobInvalidKey) {
+			t.Errorf("Get(%q) = %v, want ErrBlobInvalidKey", key, err)
+		}
+		if err := blobs.Delete(key); !errors.Is(err, omniq.ErrBlobInvalidKey) {
+			t.Errorf("Delete(%q) = %v, want ErrBlobInvalidKey", key, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "outside.json")); err == nil {
+		t.Error("a key wrote outside of the root")
+	}
+	if _, err := blobs.Put("jobs/a.json", []byte("{}"), ""); err != nil {
+		t.Errorf("Put of a nested key: %v", err)
+	}
+}
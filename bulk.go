@@ -0,0 +1,156 @@
+package omniq
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BulkError reports the items of a bulk enqueue that failed, by their index.
+// The other items were enqueued.
+type BulkError struct {
+	Errors map[int]error
+}
+
+func (e *BulkError) Error() string {
+	indices := make([]int, 0, len(e.Errors))
+	for i := range e.Errors {
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+
+	msgs := make([]string, 0, len(indices))
+	for _, i := range indices {
+		msgs = append(msgs, fmt.Sprintf("item %d: %v", i, e.Errors[i]))
+	}
+	return fmt.Sprintf("omniq: %d of the jobs could not be scheduled: %s", len(indices), strings.Join(msgs, "; "))
+}
+
+func (e *BulkError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+func (e *BulkError) add(i int, err error) {
+	if e.Errors == nil {
+		e.Errors = map[int]error{}
+	}
+	e.Errors[i] = err
+}
+
+// err returns e, or nil if nothing failed.
+func (e *BulkError) err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// encodeScheduled encodes the jobs of a bulk enqueue, see encodeJob. Entries
+// of jobs that fail to encode have no codec and their errors are recorded in errs.
+func encodeScheduled[T any](items []Scheduled[T], codec Codec, errs *BulkError) []Payload {
+	payloads := make([]Payload, len(items))
+	for i, item := range items {
+		payload, err := encodeJob(item.Job, codec)
+		if err != nil {
+			errs.add(i, err)
+			continue
+		}
+		payloads[i] = payload
+	}
+	return payloads
+}
+
+// ScheduleMany enqueues all items, with a single write if the storage
+// implements BulkStorage. It returns the IDs in the order of items; if only
+// some items fail, the error is a *BulkError and their IDs are empty. Unique
+// jobs that duplicate a pending job or an earlier item are not enqueued and
+// get the ID of the job they duplicate.
+func (s *Scheduler[T]) ScheduleMany(items []Scheduled[T]) ([]JobID, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	errs := &BulkError{}
+	ids := make([]JobID, len(items))
+	push := make([]int, 0, len(items))
+	first := map[string]int{}
+	sameAs := map[int]int{}
+	for i, item := range items {
+		key, _, err := uniqueKey(item.Job)
+		if err != nil {
+			errs.add(i, err)
+			continue
+		}
+		if key != "" {
+			if earlier, ok := first[key]; ok {
+				sameAs[i] = earlier
+				continue
+			}
+			id, err := s.pendingDuplicate(item.Job)
+			if err != nil {
+				errs.add(i, err)
+				continue
+			}
+			if id != "" {
+				ids[i] = id
+				item.Job.GetIDContainer().SetID(id)
+				continue
+			}
+			first[key] = i
+		}
+		push = append(push, i)
+	}
+
+	if len(push) > 0 {
+		batch := make([]Scheduled[T], len(push))
+		for n, i := range push {
+			batch[n] = items[i]
+		}
+		var pushed []JobID
+		var err error
+		if bulk, ok := s.storage.(BulkStorage[T]); ok {
+			pushed, err = bulk.PushMany(batch)
+		} else {
+			pushed, err = s.pushEach(batch)
+		}
+		var bulkErr *BulkError
+		if err != nil && !errors.As(err, &bulkErr) {
+			return nil, err
+		}
+		for n, i := range push {
+			ids[i] = pushed[n]
+			if bulkErr != nil && bulkErr.Errors[n] != nil {
+				errs.add(i, bulkErr.Errors[n])
+			}
+		}
+		s.waker.wake()
+	}
+
+	for i, earlier := range sameAs {
+		if ids[earlier] == "" {
+			errs.add(i, fmt.Errorf("omniq: duplicates item %d, which was not scheduled", earlier))
+			continue
+		}
+		ids[i] = ids[earlier]
+		items[i].Job.GetIDContainer().SetID(ids[earlier])
+	}
+	return ids, errs.err()
+}
+
+func (s *Scheduler[T]) pushEach(items []Scheduled[T]) ([]JobID, error) {
+	errs := &BulkError{}
+	ids := make([]JobID, len(items))
+	for i, item := range items {
+		if err := s.storage.Push(item.Job, item.At); err != nil {
+			errs.add(i, err)
+			continue
+		}
+		ids[i] = item.Job.GetIDContainer().GetID()
+	}
+	return ids, errs.err()
+}
@@ -42,7 +42,7 @@ func runAdd(args []string) error {
 	// Prepare template data
 	var runParams string
 	if depType == "struct{}" {
-		runParams = ""
+		runParams = "d struct{}"
 	} else {
 		if depImport != "" {
 			// Extract package name from import path
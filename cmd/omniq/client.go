@@ -0,0 +1,48 @@
+package main
+
+import (
+	"go/ast"
+	"strings"
+)
+
+// generateClient writes the job's Args struct and the Client method that
+// schedules it. Args holds the exported and embedded fields of the job.
+func generateClient(job JobInfo) string {
+	w := &codecWriter{}
+	var keys []string
+
+	w.line("// %sArgs holds the fields of %s.", job.Name, job.Name)
+	w.line("type %sArgs struct {", job.Name)
+	for _, e := range job.Embedded {
+		w.line("%s", e)
+		keys = append(keys, embeddedName(e))
+	}
+	for _, f := range job.Fields {
+		if !ast.IsExported(f.Name) {
+			continue
+		}
+		w.line("%s %s", f.Name, f.Source)
+		keys = append(keys, f.Name)
+	}
+	w.line("}\n")
+
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = key + ": args." + key
+	}
+	w.line("// %s schedules %s, due right away unless an option says otherwise.", job.Name, job.Name)
+	w.line("func (c *Client) %s(ctx context.Context, args %sArgs, opts ...omniq.ScheduleOption) (omniq.JobID, error) {", job.Name, job.Name)
+	w.line("return c.scheduler.Schedule(ctx, &%s{%s}, opts...)", job.Name, strings.Join(values, ", "))
+	w.line("}\n")
+	return w.String()
+}
+
+// embeddedName is the field name of an embedded type, e.g. Base for
+// *pkg.Base[T].
+func embeddedName(typ string) string {
+	typ = strings.TrimPrefix(typ, "*")
+	if i := strings.IndexByte(typ, '['); i >= 0 {
+		typ = typ[:i]
+	}
+	return typ[strings.LastIndexByte(typ, '.')+1:]
+}
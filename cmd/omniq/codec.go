@@ -0,0 +1,442 @@
+package main
+
+import (
+	"fmt"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"github.com/eugen-bondarev/omniq/genjson"
+)
+
+// codecField is a field the generated codec reads and writes
+type codecField struct {
+	name     string // Go field name
+	key      string // JSON key
+	typ      types.Type
+	omitZero bool
+	// id marks the ID promoted from omniq.WithID
+	id bool
+}
+
+// codecWriter accumulates generated code and hands out temporary names
+type codecWriter struct {
+	strings.Builder
+	temps    int
+	fallible bool
+}
+
+func (w *codecWriter) line(format string, args ...any) {
+	fmt.Fprintf(w, format+"\n", args...)
+}
+
+func (w *codecWriter) temp(prefix string) string {
+	w.temps++
+	return fmt.Sprintf("%s%d", prefix, w.temps)
+}
+
+var codecInts = map[string]bool{"int": true, "int8": true, "int16": true, "int32": true, "int64": true, "rune": true, "time.Duration": true}
+var codecUints = map[string]bool{"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true, "uintptr": true, "byte": true}
+var codecFloats = map[string]int{"float32": 32, "float64": 64}
+
+// codecFields returns the fields a generated codec has to handle, in the
+// order encoding/json writes them, or a reason the job has to keep using
+// encoding/json
+func codecFields(job JobInfo) ([]codecField, string) {
+	if job.CustomJSON {
+		return nil, "defines its own JSON methods"
+	}
+	if len(job.Embedded) > 0 {
+		return nil, "embeds " + strings.Join(job.Embedded, ", ")
+	}
+
+	fields := []codecField{}
+	keys := map[string]bool{}
+	for _, f := range job.Fields {
+		if f.JSONName == "-" {
+			continue
+		}
+		if f.Quoted {
+			return nil, f.Name + " uses the string tag option"
+		}
+		if keys[f.JSONName] {
+			return nil, "has more than one field stored as " + f.JSONName
+		}
+		keys[f.JSONName] = true
+
+		if f.OmitEmpty && !codecKnown(f.GoType) {
+			return nil, f.Name + " is omitempty on a type the generator cannot see into"
+		}
+		fields = append(fields, codecField{name: f.Name, key: f.JSONName, typ: f.GoType, omitZero: f.OmitEmpty})
+	}
+
+	// The ID of the embedded omniq.WithID comes first, unless a field of the
+	// job itself takes its key
+	if !keys["ID"] {
+		id := codecField{name: "ID", key: "ID", id: true}
+		fields = append([]codecField{id}, fields...)
+	}
+	return fields, ""
+}
+
+// codecName names the unnamed basic types, time.Time and time.Duration as the
+// generated code spells them, and returns an empty string for other types
+func codecName(t types.Type) string {
+	switch t := types.Unalias(t).(type) {
+	case *types.Basic:
+		return t.Name()
+	case *types.Named:
+		if obj := t.Obj(); obj.Pkg() != nil && obj.Pkg().Path() == "time" && (obj.Name() == "Time" || obj.Name() == "Duration") {
+			return "time." + obj.Name()
+		}
+	}
+	return ""
+}
+
+// codecKnown reports whether the generator handles every part of t itself.
+// Other types go through encoding/json.
+func codecKnown(t types.Type) bool {
+	switch t := types.Unalias(t).(type) {
+	case *types.Basic, *types.Named:
+		name := codecName(t)
+		return name == "string" || name == "bool" || codecInts[name] || codecUints[name] || codecFloats[name] > 0 || name == "time.Time"
+	case *types.Pointer:
+		return codecKnown(t.Elem())
+	case *types.Slice:
+		return codecKnown(t.Elem())
+	case *types.Map:
+		return codecName(t.Key()) == "string" && codecKnown(t.Elem())
+	}
+	return false
+}
+
+// codecTypeString spells out a type codecKnown accepts, for declaring
+// variables of it
+func codecTypeString(t types.Type) (string, error) {
+	if !codecKnown(t) {
+		return "", fmt.Errorf("the generated codec cannot declare a %s", t)
+	}
+	switch t := types.Unalias(t).(type) {
+	case *types.Pointer:
+		elem, err := codecTypeString(t.Elem())
+		return "*" + elem, err
+	case *types.Slice:
+		elem, err := codecTypeString(t.Elem())
+		return "[]" + elem, err
+	case *types.Map:
+		elem, err := codecTypeString(t.Elem())
+		return "map[string]" + elem, err
+	}
+	return codecName(t), nil
+}
+
+// isCodecBytes reports whether t is a byte slice, which encoding/json writes
+// as base64
+func isCodecBytes(t types.Type) bool {
+	s, ok := types.Unalias(t).(*types.Slice)
+	return ok && (codecName(s.Elem()) == "byte" || codecName(s.Elem()) == "uint8")
+}
+
+// generateCodec renders MarshalJSON and UnmarshalJSON for a job
+func generateCodec(job JobInfo, fields []codecField) (string, error) {
+	body := &codecWriter{}
+	for _, f := range fields {
+		key := goString(string(genjson.AppendString(nil, f.key)) + ":")
+		value := "j." + f.name
+		if f.id {
+			body.line("b = genjson.Key(b, %s)", key)
+			body.line("b = genjson.AppendString(b, string(j.ID))")
+			continue
+		}
+		cond := ""
+		if f.omitZero {
+			cond = codecNonEmpty(f.typ, value)
+		}
+		if cond != "" {
+			body.line("if %s {", cond)
+		}
+		body.line("b = genjson.Key(b, %s)", key)
+		encodeValue(body, f.typ, value)
+		if cond != "" {
+			body.line("}")
+		}
+	}
+
+	// Size the buffer for the keys, the strings and a guess at the rest
+	size, lens := 2, []string{}
+	for _, f := range fields {
+		size += len(f.key) + 4
+		switch {
+		case f.id:
+			lens = append(lens, "len(j.ID)")
+		case codecName(f.typ) == "string":
+			lens = append(lens, "len(j."+f.name+")")
+		default:
+			size += 16
+		}
+	}
+
+	w := &codecWriter{}
+	w.line("func (j *%s) MarshalJSON() ([]byte, error) {", job.Name)
+	w.line("b := make([]byte, 0, %s)", strings.Join(append([]string{strconv.Itoa(size)}, lens...), "+"))
+	if body.fallible {
+		w.line("var err error")
+	}
+	w.line("b = append(b, '{')")
+	w.WriteString(body.String())
+	w.line("return append(b, '}'), nil")
+	w.line("}")
+	w.line("")
+
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = strconv.Quote(f.key)
+	}
+	w.line("func (j *%s) UnmarshalJSON(data []byte) error {", job.Name)
+	w.line("d := genjson.NewDecoder(data)")
+	w.line("err := d.Fields(func(key []byte) error {")
+	w.line("switch genjson.MatchKey(key, %s) {", strings.Join(names, ", "))
+	for _, f := range fields {
+		w.line("case %s:", strconv.Quote(f.key))
+		if f.id {
+			w.line("var id string")
+			w.line("if err := d.String(&id); err != nil {")
+			w.line("return err")
+			w.line("}")
+			w.line("j.ID = omniq.JobID(id)")
+			w.line("return nil")
+			continue
+		}
+		if call := decodeCall(f.typ, "j."+f.name); call != "" {
+			w.line("return %s", call)
+			continue
+		}
+		if err := decodeValue(w, f.typ, "j."+f.name); err != nil {
+			return "", fmt.Errorf("%s: %v", f.name, err)
+		}
+		w.line("return nil")
+	}
+	w.line("default:")
+	w.line("return d.Skip()")
+	w.line("}")
+	w.line("})")
+	w.line("if err != nil {")
+	w.line("return err")
+	w.line("}")
+	w.line("return d.End()")
+	w.line("}")
+	return w.String(), nil
+}
+
+// goString renders s as a Go string literal, preferring backquotes since JSON
+// keys are full of double quotes
+func goString(s string) string {
+	if strconv.CanBackquote(s) {
+		return "`" + s + "`"
+	}
+	return strconv.Quote(s)
+}
+
+// codecNonEmpty is the condition under which encoding/json writes an
+// omitempty field, empty if it always does
+func codecNonEmpty(t types.Type, v string) string {
+	switch t := types.Unalias(t).(type) {
+	case *types.Basic, *types.Named:
+		switch codecName(t) {
+		case "string":
+			return v + ` != ""`
+		case "bool":
+			return v
+		case "time.Time":
+			// Structs are never empty
+			return ""
+		}
+		return v + " != 0"
+	case *types.Pointer:
+		return v + " != nil"
+	}
+	return "len(" + v + ") != 0"
+}
+
+// encodeValue emits code appending v, of type t, to b
+func encodeValue(w *codecWriter, t types.Type, v string) {
+	if !codecKnown(t) {
+		appendChecked(w, "genjson.AppendValue(b, %s)", v)
+		return
+	}
+
+	switch u := types.Unalias(t).(type) {
+	case *types.Basic, *types.Named:
+		name := codecName(u)
+		switch {
+		case name == "string":
+			w.line("b = genjson.AppendString(b, %s)", v)
+		case name == "bool":
+			w.line("b = genjson.AppendBool(b, %s)", v)
+		case codecInts[name]:
+			w.line("b = genjson.AppendInt(b, int64(%s))", v)
+		case codecUints[name]:
+			w.line("b = genjson.AppendUint(b, uint64(%s))", v)
+		case codecFloats[name] > 0:
+			appendChecked(w, "genjson.AppendFloat(b, float64(%s), %d)", v, codecFloats[name])
+		case name == "time.Time":
+			appendChecked(w, "genjson.AppendTime(b, %s)", v)
+		}
+	case *types.Pointer:
+		w.line("if %s == nil {", v)
+		w.line(`b = append(b, "null"...)`)
+		w.line("} else {")
+		encodeValue(w, u.Elem(), "(*"+v+")")
+		w.line("}")
+	case *types.Slice:
+		if isCodecBytes(u) {
+			w.line("b = genjson.AppendBytes(b, %s)", v)
+			return
+		}
+		i, e := w.temp("i"), w.temp("e")
+		w.line("if %s == nil {", v)
+		w.line(`b = append(b, "null"...)`)
+		w.line("} else {")
+		w.line("b = append(b, '[')")
+		w.line("for %s, %s := range %s {", i, e, v)
+		w.line("if %s > 0 {", i)
+		w.line("b = append(b, ',')")
+		w.line("}")
+		encodeValue(w, u.Elem(), e)
+		w.line("}")
+		w.line("b = append(b, ']')")
+		w.line("}")
+	case *types.Map:
+		k := w.temp("k")
+		w.line("if %s == nil {", v)
+		w.line(`b = append(b, "null"...)`)
+		w.line("} else {")
+		w.line("b = append(b, '{')")
+		w.line("for _, %s := range genjson.SortedKeys(%s) {", k, v)
+		w.line("b = genjson.Key(b, ``)")
+		w.line("b = genjson.AppendString(b, %s)", k)
+		w.line("b = append(b, ':')")
+		encodeValue(w, u.Elem(), v+"["+k+"]")
+		w.line("}")
+		w.line("b = append(b, '}')")
+		w.line("}")
+	}
+}
+
+func appendChecked(w *codecWriter, call string, args ...any) {
+	w.fallible = true
+	w.line("if b, err = "+call+"; err != nil {", args...)
+	w.line("return nil, err")
+	w.line("}")
+}
+
+// decodeValue emits code reading the next value of the decoder d into v, of
+// type t. The code returns any error from the enclosing function.
+func decodeValue(w *codecWriter, t types.Type, v string) error {
+	if call := decodeCall(t, v); call != "" {
+		w.line("if err := %s; err != nil {", call)
+		w.line("return err")
+		w.line("}")
+		return nil
+	}
+
+	switch u := types.Unalias(t).(type) {
+	case *types.Pointer:
+		elem, err := codecTypeString(u.Elem())
+		if err != nil {
+			return err
+		}
+		p := w.temp("p")
+		w.line("if d.Null() {")
+		w.line("%s = nil", v)
+		w.line("} else {")
+		w.line("%s := new(%s)", p, elem)
+		if err := decodeValue(w, u.Elem(), "(*"+p+")"); err != nil {
+			return err
+		}
+		w.line("%s = %s", v, p)
+		w.line("}")
+	case *types.Slice:
+		slice, err := codecTypeString(u)
+		if err != nil {
+			return err
+		}
+		elem, err := codecTypeString(u.Elem())
+		if err != nil {
+			return err
+		}
+		s, e := w.temp("s"), w.temp("e")
+		w.line("if d.Null() {")
+		w.line("%s = nil", v)
+		w.line("} else {")
+		w.line("%s := make(%s, 0)", s, slice)
+		w.line("if err := d.Array(func() error {")
+		w.line("var %s %s", e, elem)
+		if err := decodeValue(w, u.Elem(), e); err != nil {
+			return err
+		}
+		w.line("%s = append(%s, %s)", s, s, e)
+		w.line("return nil")
+		w.line("}); err != nil {")
+		w.line("return err")
+		w.line("}")
+		w.line("%s = %s", v, s)
+		w.line("}")
+	case *types.Map:
+		m, err := codecTypeString(u)
+		if err != nil {
+			return err
+		}
+		elem, err := codecTypeString(u.Elem())
+		if err != nil {
+			return err
+		}
+		mv, k, e := w.temp("m"), w.temp("k"), w.temp("e")
+		w.line("if d.Null() {")
+		w.line("%s = nil", v)
+		w.line("} else {")
+		w.line("%s := make(%s)", mv, m)
+		w.line("if err := d.Object(func(%s string) error {", k)
+		w.line("var %s %s", e, elem)
+		if err := decodeValue(w, u.Elem(), e); err != nil {
+			return err
+		}
+		w.line("%s[%s] = %s", mv, k, e)
+		w.line("return nil")
+		w.line("}); err != nil {")
+		w.line("return err")
+		w.line("}")
+		w.line("%s = %s", v, mv)
+		w.line("}")
+	default:
+		return fmt.Errorf("the generated codec cannot decode a %s", t)
+	}
+	return nil
+}
+
+// decodeCall returns the single call that decodes into v, of type t, or
+// an empty string if it takes more than one
+func decodeCall(t types.Type, v string) string {
+	if !codecKnown(t) {
+		return "d.Value(&" + v + ")"
+	}
+	if isCodecBytes(t) {
+		return "d.Bytes(&" + v + ")"
+	}
+
+	switch name := codecName(t); {
+	case name == "string":
+		return "d.String(&" + v + ")"
+	case name == "bool":
+		return "d.Bool(&" + v + ")"
+	case codecInts[name]:
+		return "genjson.Int(d, &" + v + ")"
+	case codecUints[name]:
+		return "genjson.Uint(d, &" + v + ")"
+	case codecFloats[name] > 0:
+		return "genjson.Float(d, &" + v + ")"
+	case name == "time.Time":
+		return "d.Time(&" + v + ")"
+	}
+	return ""
+}
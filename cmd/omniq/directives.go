@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const directivePrefix = "//omniq:"
+
+// directive is a comment of the form //omniq:name arg... key=value... in the
+// doc comment of a job struct.
+type directive struct {
+	Name    string
+	Args    []string
+	Options map[string]string
+	Pos     token.Position
+}
+
+func (d directive) errorf(format string, args ...any) error {
+	return fmt.Errorf("%s: %s%s: %s", d.Pos, directivePrefix, d.Name, fmt.Sprintf(format, args...))
+}
+
+// directiveHandlers apply each known directive to the job it annotates.
+var directiveHandlers = map[string]func(d directive, job *JobInfo) error{
+	"type":     applyTypeDirective,
+	"queue":    applyQueueDirective,
+	"retries":  applyRetriesDirective,
+	"timeout":  applyTimeoutDirective,
+	"unique":   applyUniqueDirective,
+	"priority": applyPriorityDirective,
+}
+
+// optionMethods are the methods generated for option directives, which the
+// job must not define itself.
+var optionMethods = map[string]string{
+	"queue":    "Queue",
+	"retries":  "Retries",
+	"timeout":  "Timeout",
+	"unique":   "UniqueFields",
+	"priority": "Priority",
+}
+
+// backoffs maps the backoff option of //omniq:retries to omniq's constants.
+var backoffs = map[string]string{
+	"const":  "omniq.BackoffConstant",
+	"linear": "omniq.BackoffLinear",
+	"exp":    "omniq.BackoffExponential",
+}
+
+// parseDirectives collects the directives of a doc comment. Like //go:
+// directives they have no space after the slashes.
+func parseDirectives(fset *token.FileSet, doc *ast.CommentGroup) ([]directive, error) {
+	if doc == nil {
+		return nil, nil
+	}
+
+	var directives []directive
+	for _, c := range doc.List {
+		text, ok := strings.CutPrefix(c.Text, directivePrefix)
+		if !ok {
+			continue
+		}
+		d := directive{Options: map[string]string{}, Pos: fset.Position(c.Slash)}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("%s: %s without a name", d.Pos, directivePrefix)
+		}
+		d.Name = fields[0]
+		for _, field := range fields[1:] {
+			key, value, isOption := strings.Cut(field, "=")
+			if !isOption {
+				if len(d.Options) > 0 {
+					return nil, d.errorf("argument %q after options", field)
+				}
+				d.Args = append(d.Args, field)
+				continue
+			}
+			if key == "" || value == "" {
+				return nil, d.errorf("malformed option %q, want key=value", field)
+			}
+			if _, dup := d.Options[key]; dup {
+				return nil, d.errorf("option %q given twice", key)
+			}
+			d.Options[key] = value
+		}
+		directives = append(directives, d)
+	}
+	return directives, nil
+}
+
+// applyDirectives applies the directives to the job, failing on unknown ones
+// and on ones given twice.
+func applyDirectives(directives []directive, job *JobInfo) error {
+	seen := map[string]bool{}
+	for _, d := range directives {
+		handler, ok := directiveHandlers[d.Name]
+		if !ok {
+			return fmt.Errorf("%s: unknown directive %s%s", d.Pos, directivePrefix, d.Name)
+		}
+		if seen[d.Name] {
+			return d.errorf("given twice for %s", job.Name)
+		}
+		seen[d.Name] = true
+		if err := handler(d, job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkOptions fails on options the directive does not take.
+func (d directive) checkOptions(known ...string) error {
+	for key := range d.Options {
+		if !slices.Contains(known, key) {
+			return d.errorf("unknown option %q", key)
+		}
+	}
+	return nil
+}
+
+// applyTypeDirective handles //omniq:type [name] [alias=Old1,Old2], which sets
+// the name the job is stored under and the names it used to be stored under.
+func applyTypeDirective(d directive, job *JobInfo) error {
+	if err := d.checkOptions("alias"); err != nil {
+		return err
+	}
+	switch len(d.Args) {
+	case 0:
+		if d.Options["alias"] == "" {
+			return d.errorf("needs a type name, aliases or both")
+		}
+	case 1:
+		job.TypeName = d.Args[0]
+	default:
+		return d.errorf("takes a single type name, got %q", d.Args)
+	}
+	if aliases := d.Options["alias"]; aliases != "" {
+		for _, alias := range strings.Split(aliases, ",") {
+			if alias == "" {
+				return d.errorf("empty alias in %q", aliases)
+			}
+			job.Aliases = append(job.Aliases, alias)
+		}
+	}
+	return nil
+}
+
+// arg returns the single argument of a directive that takes exactly one.
+func (d directive) arg(what string) (string, error) {
+	if len(d.Args) != 1 {
+		return "", d.errorf("takes a single %s, got %q", what, d.Args)
+	}
+	return d.Args[0], nil
+}
+
+// applyQueueDirective handles //omniq:queue name.
+func applyQueueDirective(d directive, job *JobInfo) error {
+	if err := d.checkOptions(); err != nil {
+		return err
+	}
+	queue, err := d.arg("queue name")
+	if err != nil {
+		return err
+	}
+	job.Queue = queue
+	return nil
+}
+
+// applyRetriesDirective handles //omniq:retries n [backoff=const|linear|exp]
+// [delay=duration]. The backoff defaults to exp.
+func applyRetriesDirective(d directive, job *JobInfo) error {
+	if err := d.checkOptions("backoff", "delay"); err != nil {
+		return err
+	}
+	arg, err := d.arg("number of retries")
+	if err != nil {
+		return err
+	}
+	count, err := strconv.Atoi(arg)
+	if err != nil || count < 0 {
+		return d.errorf("invalid number of retries %q", arg)
+	}
+
+	retries := &RetryInfo{Count: count, Backoff: "exp"}
+	if backoff, ok := d.Options["backoff"]; ok {
+		if _, known := backoffs[backoff]; !known {
+			return d.errorf("unknown backoff %q, want one of %s", backoff, strings.Join(slices.Sorted(maps.Keys(backoffs)), ", "))
+		}
+		retries.Backoff = backoff
+	}
+	if delay, ok := d.Options["delay"]; ok {
+		if retries.Delay, err = parsePositiveDuration(delay); err != nil {
+			return d.errorf("invalid delay: %v", err)
+		}
+	}
+	job.Retries = retries
+	return nil
+}
+
+// applyTimeoutDirective handles //omniq:timeout duration.
+func applyTimeoutDirective(d directive, job *JobInfo) error {
+	if err := d.checkOptions(); err != nil {
+		return err
+	}
+	arg, err := d.arg("duration")
+	if err != nil {
+		return err
+	}
+	if job.Timeout, err = parsePositiveDuration(arg); err != nil {
+		return d.errorf("invalid timeout: %v", err)
+	}
+	return nil
+}
+
+// applyUniqueDirective handles //omniq:unique Field1,Field2, which names the
+// Go fields that identify a pending job.
+func applyUniqueDirective(d directive, job *JobInfo) error {
+	if err := d.checkOptions(); err != nil {
+		return err
+	}
+	arg, err := d.arg("comma-separated list of fields")
+	if err != nil {
+		return err
+	}
+	job.Unique = []FieldInfo{}
+	for _, name := range strings.Split(arg, ",") {
+		i := slices.IndexFunc(job.Fields, func(f FieldInfo) bool { return f.Name == name })
+		switch {
+		case name == "":
+			return d.errorf("empty field name in %q", arg)
+		case i < 0:
+			return d.errorf("%s has no field %s", job.Name, name)
+		case job.Fields[i].JSONName == "-":
+			return d.errorf("field %s of %s is not stored", name, job.Name)
+		case slices.ContainsFunc(job.Unique, func(f FieldInfo) bool { return f.Name == name }):
+			return d.errorf("field %s given twice", name)
+		}
+		job.Unique = append(job.Unique, job.Fields[i])
+	}
+	return nil
+}
+
+// applyPriorityDirective handles //omniq:priority n.
+func applyPriorityDirective(d directive, job *JobInfo) error {
+	if err := d.checkOptions(); err != nil {
+		return err
+	}
+	arg, err := d.arg("priority")
+	if err != nil {
+		return err
+	}
+	priority, err := strconv.Atoi(arg)
+	if err != nil {
+		return d.errorf("invalid priority %q, want an integer", arg)
+	}
+	job.Priority = &priority
+	return nil
+}
+
+func parsePositiveDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s is not positive", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseDoc parses the directives in the doc comment of a job struct.
+func parseDoc(t *testing.T, doc string) ([]directive, error) {
+	t.Helper()
+	src := "package jobs\n\n" + doc + "\ntype Job struct {\n\tTo string\n\tCache string `json:\"-\"`\n}\n"
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "jobs.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parseDirectives(fset, file.Decls[0].(*ast.GenDecl).Doc)
+}
+
+// applyDoc applies the directives in the doc comment to a job with a stored
+// field To and an unstored field Cache.
+func applyDoc(t *testing.T, doc string) (JobInfo, error) {
+	t.Helper()
+	job := JobInfo{Name: "Job", TypeName: "Job", Fields: []FieldInfo{
+		{Name: "To", Type: "string", JSONName: "To"},
+		{Name: "Cache", Type: "string", JSONName: "-"},
+	}}
+	directives, err := parseDoc(t, doc)
+	if err != nil {
+		return job, err
+	}
+	return job, applyDirectives(directives, &job)
+}
+
+func TestParseDirectives(t *testing.T) {
+	directives, err := parseDoc(t, "// Job sends mail.\n// omniq:queue ignored\n//omniq:retries 3 backoff=linear delay=1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(directives) != 1 {
+		t.Fatalf("got %d directives, want only the one without a space", len(directives))
+	}
+	d := directives[0]
+	if d.Name != "retries" || !slices.Equal(d.Args, []string{"3"}) || d.Options["backoff"] != "linear" || d.Options["delay"] != "1s" {
+		t.Errorf("got %+v", d)
+	}
+	if d.Pos.Line != 5 {
+		t.Errorf("got line %d, want 5", d.Pos.Line)
+	}
+
+	malformed := []struct {
+		doc, err string
+	}{
+		{"//omniq:", "without a name"},
+		{"//omniq:type alias=Old name", `argument "name" after options`},
+		{"//omniq:type alias=", `malformed option "alias="`},
+		{"//omniq:type =Old", `malformed option "=Old"`},
+		{"//omniq:type alias=A alias=B", `option "alias" given twice`},
+	}
+	for _, c := range malformed {
+		if _, err := parseDoc(t, c.doc); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: got %v, want an error containing %q", c.doc, err, c.err)
+		}
+	}
+}
+
+func TestApplyDirectives(t *testing.T) {
+	cases := []struct {
+		doc, err string
+	}{
+		{"//omniq:type welcome\n//omniq:type other", "given twice for Job"},
+		{"//omniq:queue a\n//omniq:queue b", "given twice for Job"},
+		{"//omniq:cron * * * * *", "unknown directive //omniq:cron"},
+	}
+	for _, c := range cases {
+		if _, err := applyDoc(t, c.doc); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%q: got %v, want an error containing %q", c.doc, err, c.err)
+		}
+	}
+}
+
+func TestTypeDirective(t *testing.T) {
+	cases := []struct {
+		doc      string
+		typeName string
+		aliases  []string
+		err      string
+	}{
+		{doc: "//omniq:type welcome_email", typeName: "welcome_email"},
+		{doc: "//omniq:type welcome_email alias=Job1", typeName: "welcome_email", aliases: []string{"Job1"}},
+		{doc: "//omniq:type alias=Job1,Job2", typeName: "Job", aliases: []string{"Job1", "Job2"}},
+		{doc: "//omniq:type", err: "needs a type name, aliases or both"},
+		{doc: "//omniq:type a b", err: "takes a single type name"},
+		{doc: "//omniq:type a alias=Job1,,Job2", err: "empty alias"},
+		{doc: "//omniq:type a version=2", err: `unknown option "version"`},
+	}
+	for _, c := range cases {
+		job, err := applyDoc(t, c.doc)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: got %v, want an error containing %q", c.doc, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.doc, err)
+			continue
+		}
+		if job.TypeName != c.typeName || !slices.Equal(job.Aliases, c.aliases) {
+			t.Errorf("%s: got type %q, aliases %q, want %q, %q", c.doc, job.TypeName, job.Aliases, c.typeName, c.aliases)
+		}
+	}
+}
+
+func TestOptionDirectives(t *testing.T) {
+	cases := []struct {
+		doc   string
+		check func(job JobInfo) bool
+		err   string
+	}{
+		{doc: "//omniq:queue mail", check: func(job JobInfo) bool { return job.Queue == "mail" }},
+		{doc: "//omniq:queue", err: "takes a single queue name"},
+		{doc: "//omniq:queue a b", err: "takes a single queue name"},
+		{doc: "//omniq:queue mail weight=2", err: `unknown option "weight"`},
+
+		{doc: "//omniq:retries 3", check: func(job JobInfo) bool { return *job.Retries == RetryInfo{Count: 3, Backoff: "exp"} }},
+		{doc: "//omniq:retries 0 backoff=const delay=1m30s", check: func(job JobInfo) bool {
+			return *job.Retries == RetryInfo{Count: 0, Backoff: "const", Delay: 90 * time.Second}
+		}},
+		{doc: "//omniq:retries", err: "takes a single number of retries"},
+		{doc: "//omniq:retries three", err: `invalid number of retries "three"`},
+		{doc: "//omniq:retries -1", err: `invalid number of retries "-1"`},
+		{doc: "//omniq:retries 3 backoff=fibonacci", err: `unknown backoff "fibonacci", want one of const, exp, linear`},
+		{doc: "//omniq:retries 3 delay=soon", err: "invalid delay"},
+		{doc: "//omniq:retries 3 delay=0s", err: "0s is not positive"},
+
+		{doc: "//omniq:timeout 250ms", check: func(job JobInfo) bool { return job.Timeout == 250*time.Millisecond }},
+		{doc: "//omniq:timeout", err: "takes a single duration"},
+		{doc: "//omniq:timeout 30", err: "invalid timeout"},
+		{doc: "//omniq:timeout -1s", err: "-1s is not positive"},
+
+		{doc: "//omniq:unique To", check: func(job JobInfo) bool { return len(job.Unique) == 1 && job.Unique[0].Name == "To" }},
+		{doc: "//omniq:unique To,", err: "empty field name"},
+		{doc: "//omniq:unique From", err: "Job has no field From"},
+		{doc: "//omniq:unique Cache", err: "field Cache of Job is not stored"},
+		{doc: "//omniq:unique To,To", err: "field To given twice"},
+
+		{doc: "//omniq:priority -5", check: func(job JobInfo) bool { return *job.Priority == -5 }},
+		{doc: "//omniq:priority high", err: `invalid priority "high", want an integer`},
+		{doc: "//omniq:priority 1 2", err: "takes a single priority"},
+	}
+	for _, c := range cases {
+		job, err := applyDoc(t, c.doc)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: got %v, want an error containing %q", c.doc, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.doc, err)
+			continue
+		}
+		if !c.check(job) {
+			t.Errorf("%s: got %+v", c.doc, job)
+		}
+	}
+}
@@ -2,23 +2,35 @@ package main
 
 import (
 	"bytes"
+	"flag"
 	"fmt"
 	"go/format"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"text/template"
 )
 
 // runGenerate handles the generate command
 func runGenerate(args []string) error {
-	if len(args) < 1 {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	buildTags := fs.String("tags", "", "comma-separated build tags the jobs package is loaded with")
+	strict := fs.Bool("strict", false, "fail if a job field does not survive being stored as JSON")
+	tests := fs.Bool("tests", false, "also generate round-trip tests and fuzz targets for every job in "+generatedTestFile)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
 		return fmt.Errorf("generate command requires a jobs directory argument")
 	}
 
-	jobsDir := args[0]
+	jobsDir := fs.Arg(0)
 
-	// Parse all job files in the directory
-	jobs, packageName, depType, depImport, err := parseJobsDirectory(jobsDir)
+	// Load and type-check the jobs package
+	jobs, packageName, depType, depImport, err := parseJobsDirectory(jobsDir, *buildTags)
 	if err != nil {
 		return fmt.Errorf("parsing jobs directory: %v", err)
 	}
@@ -27,12 +39,70 @@ func runGenerate(args []string) error {
 		return fmt.Errorf("no job structs found in %s", jobsDir)
 	}
 
+	// Report fields that JSON does not round-trip
+	if err := reportLint(jobs, *strict); err != nil {
+		return err
+	}
+
+	// Warn about jobs that changed without a version bump
+	versions, err := loadJobVersions(jobsDir)
+	if err != nil {
+		return err
+	}
+	changed, stale := versions.check(jobs)
+	for _, w := range append(changed, stale...) {
+		fmt.Printf("Warning: %s\n", w)
+	}
+
+	// Generate the JSON codecs. The factory always needs fmt for its errors,
+	// the client context.
+	stdImports, imports := map[string]bool{"context": true, "fmt": true}, map[string]bool{}
+	for i, job := range jobs {
+		fields, reason := codecFields(job)
+		if reason != "" {
+			fmt.Printf("%s %s, it is encoded with encoding/json\n", job.Name, reason)
+			continue
+		}
+		if jobs[i].Codec, err = generateCodec(job, fields); err != nil {
+			return fmt.Errorf("%s: %v", job.Name, err)
+		}
+		imports["github.com/eugen-bondarev/omniq/genjson"] = true
+		if strings.Contains(jobs[i].Codec, "time.") {
+			stdImports["time"] = true
+		}
+	}
+
+	// Generate the option methods of the directives
+	for i, job := range jobs {
+		jobs[i].Options = generateOptions(job)
+		if strings.Contains(jobs[i].Options, "time.") {
+			stdImports["time"] = true
+		}
+	}
+
+	// Generate the client, which declares the job's fields again and so needs
+	// their imports
+	importNames := map[string]string{"context": "context", "fmt": "fmt", "time": "time", "omniq": omniqPath, "genjson": omniqPath + "/genjson"}
+	for i, job := range jobs {
+		jobs[i].Client = generateClient(job)
+		for path, name := range job.Imports {
+			if path == depImport {
+				continue
+			}
+			if err := addImport(path, name, importNames, stdImports, imports); err != nil {
+				return fmt.Errorf("%s: %v", job.Name, err)
+			}
+		}
+	}
+
 	// Generate the code
 	data := GenerationData{
-		Package:   packageName,
-		Jobs:      jobs,
-		DepType:   depType,
-		DepImport: depImport,
+		Package:    packageName,
+		Jobs:       jobs,
+		DepType:    depType,
+		DepImport:  depImport,
+		StdImports: importSpecs(stdImports),
+		Imports:    importSpecs(imports),
 	}
 
 	tmpl, err := template.New("generated").Parse(generateTemplate)
@@ -51,13 +121,74 @@ func runGenerate(args []string) error {
 		return fmt.Errorf("formatting generated code: %v", err)
 	}
 
+	// Make sure the package compiles with it and every job is an omniq.Job
+	if err := verifyGenerated(jobsDir, *buildTags, jobs, formatted); err != nil {
+		return err
+	}
+
 	// Write to jobs_gen.go in the same directory
-	outputFile := filepath.Join(jobsDir, "jobs_gen.go")
+	outputFile := filepath.Join(jobsDir, generatedFile)
 
 	if err := os.WriteFile(outputFile, formatted, 0644); err != nil {
 		return fmt.Errorf("writing generated file: %v", err)
 	}
 
+	if *tests {
+		testFile, err := generateTests(jobsDir, packageName, jobs)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Generated %s\n", testFile)
+	}
+
+	if err := versions.save(jobsDir); err != nil {
+		return fmt.Errorf("writing %s: %v", versionsFile, err)
+	}
+
 	fmt.Printf("Generated %s\n", outputFile)
 	return nil
 }
+
+// addImport adds the package to the standard library or the other imports,
+// failing if another package of the same name is imported already
+func addImport(path, name string, names map[string]string, std, other map[string]bool) error {
+	if path == omniqPath {
+		return nil
+	}
+	if imported, ok := names[name]; ok && imported != path {
+		return fmt.Errorf("the generated code would import both %s and %s as %s", imported, path, name)
+	}
+	names[name] = path
+	spec := importSpec(name, path)
+	if strings.Contains(strings.Split(path, "/")[0], ".") {
+		other[spec] = true
+	} else {
+		std[spec] = true
+	}
+	return nil
+}
+
+// importSpec names the import only if the name differs from the last element
+// of the path.
+func importSpec(name, path string) string {
+	if name == path[strings.LastIndex(path, "/")+1:] {
+		return path
+	}
+	return name + " " + path
+}
+
+// importSpecs quotes the import paths, sorted by path.
+func importSpecs(imports map[string]bool) []string {
+	specs := slices.SortedFunc(maps.Keys(imports), func(a, b string) int {
+		return strings.Compare(a[strings.LastIndex(a, " ")+1:], b[strings.LastIndex(b, " ")+1:])
+	})
+	for i, spec := range specs {
+		name, path, named := strings.Cut(spec, " ")
+		if named {
+			specs[i] = name + " " + strconv.Quote(path)
+		} else {
+			specs[i] = strconv.Quote(spec)
+		}
+	}
+	return specs
+}
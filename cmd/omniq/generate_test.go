@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files from the generated code")
+
+// copyFixture copies the fixture package testdata/name into a temporary
+// package next to it, so it still imports omniq from this module.
+func copyFixture(t *testing.T, name string) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("testdata", name+"-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	sources, err := filepath.Glob(filepath.Join("testdata", name, "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, src := range sources {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, filepath.Base(src)), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// generateFixture runs generate on a copy of the fixture package testdata/name.
+func generateFixture(t *testing.T, name string, args ...string) string {
+	t.Helper()
+	dir := copyFixture(t, name)
+	if err := runGenerate(append(args, dir)); err != nil {
+		t.Fatalf("generate %s: %v", name, err)
+	}
+	return dir
+}
+
+// checkGolden compares the generated file with testdata/name/file.golden,
+// rewriting the golden file instead with -update.
+func checkGolden(t *testing.T, dir, name, file string) {
+	t.Helper()
+	got, err := os.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", name, file+".golden")
+	if *update {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from %s, run go test -update and review the diff:\n%s", file, golden, got)
+	}
+}
+
+// goCommand runs the go command in dir.
+func goCommand(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go %v: %v\n%s", args, err, out)
+	}
+}
+
+func TestGenerateCodec(t *testing.T) {
+	dir := generateFixture(t, "codec")
+	checkGolden(t, dir, "codec", generatedFile)
+	goCommand(t, dir, "vet", ".")
+}
+
+func TestGenerateOptions(t *testing.T) {
+	dir := generateFixture(t, "directives")
+	checkGolden(t, dir, "directives", generatedFile)
+	goCommand(t, dir, "vet", ".")
+}
+
+func TestGenerateClient(t *testing.T) {
+	dir := generateFixture(t, "client")
+	checkGolden(t, dir, "client", generatedFile)
+	goCommand(t, dir, "vet", ".")
+}
+
+func TestGenerateTests(t *testing.T) {
+	dir := generateFixture(t, "codec", "-tests")
+	checkGolden(t, dir, "codec", generatedTestFile)
+	goCommand(t, dir, "test", ".")
+}
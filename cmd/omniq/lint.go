@@ -0,0 +1,300 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// jsonLinter finds the parts of a job that do not survive a round trip
+// through encoding/json, following its rules for which fields are stored.
+type jsonLinter struct {
+	fset   *token.FileSet
+	issues []string
+	// pos is where the top-level field being checked is declared. Nested
+	// fields may live in other packages, so issues point at it.
+	pos token.Pos
+	// visiting maps the named types on the current path to the number of
+	// pointers dereferenced before them, to find pointer cycles
+	visiting map[*types.Named]int
+	pointers int
+	checked  map[*types.Named]bool
+}
+
+// jsonField is a field as encoding/json sees it
+type jsonField struct {
+	v      *types.Var
+	name   string
+	path   string
+	depth  int
+	tagged bool
+	pos    token.Pos
+}
+
+// lintJob lists the fields of the job that encoding/json does not store, or
+// does not store faithfully
+func lintJob(fset *token.FileSet, named *types.Named) []string {
+	l := &jsonLinter{fset: fset, visiting: map[*types.Named]int{named: 0}, checked: map[*types.Named]bool{}}
+	l.checkStruct(named.Underlying().(*types.Struct), named.Obj().Name(), token.NoPos)
+	return l.issues
+}
+
+func (l *jsonLinter) report(pos token.Pos, path, format string, args ...any) {
+	position := l.fset.Position(pos)
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, position.Filename); err == nil && !strings.HasPrefix(rel, "..") {
+			position.Filename = rel
+		}
+	}
+	l.issues = append(l.issues, fmt.Sprintf("%s: %s %s", position, path, fmt.Sprintf(format, args...)))
+}
+
+// checkStruct checks the fields encoding/json stores for a struct. pos is
+// NoPos for the job itself, whose fields are reported where they are declared.
+func (l *jsonLinter) checkStruct(st *types.Struct, path string, pos token.Pos) {
+	byName := map[string][]jsonField{}
+	var names []string
+	l.collectFields(st, path, 0, pos, byName, &names)
+
+	for _, name := range names {
+		fields := byName[name]
+		winner, ok := dominantField(fields)
+		if !ok {
+			paths := make([]string, 0, len(fields))
+			for _, f := range fields {
+				if f.depth == fields[0].depth {
+					paths = append(paths, f.path)
+				}
+			}
+			l.report(fields[0].pos, strings.Join(paths, " and "), "are all stored as %q, so encoding/json stores none of them", name)
+			continue
+		}
+		for _, f := range fields {
+			if f.v != winner.v {
+				l.report(f.pos, f.path, "is hidden by %s, which is also stored as %q, and is not stored", winner.path, name)
+			}
+		}
+
+		if pos == token.NoPos {
+			l.pos = winner.pos
+		}
+		l.checkType(winner.v.Type(), winner.path)
+	}
+}
+
+// collectFields gathers the fields encoding/json considers, descending into
+// untagged embedded structs like it does
+func (l *jsonLinter) collectFields(st *types.Struct, path string, depth int, pos token.Pos, byName map[string][]jsonField, names *[]string) {
+	for i := range st.NumFields() {
+		v := st.Field(i)
+		fieldPos := pos
+		if fieldPos == token.NoPos {
+			fieldPos = v.Pos()
+		}
+		fieldPath := path + "." + v.Name()
+
+		tag := reflect.StructTag(st.Tag(i)).Get("json")
+		if tag == "-" {
+			continue
+		}
+		if v.Embedded() && isOmniqType(v.Type(), "WithID") {
+			// The ID is stored by the storage, like parseJob leaves it out
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		tagged := name != ""
+
+		if v.Embedded() && name == "" {
+			t := types.Unalias(v.Type())
+			if ptr, ok := t.(*types.Pointer); ok {
+				t = types.Unalias(ptr.Elem())
+			}
+			if embedded, ok := t.Underlying().(*types.Struct); ok && !isJSONMarshaler(t) {
+				if named, ok := t.(*types.Named); ok {
+					if _, cycle := l.visiting[named]; cycle {
+						continue
+					}
+					l.visiting[named] = l.pointers
+					l.collectFields(embedded, fieldPath, depth+1, fieldPos, byName, names)
+					delete(l.visiting, named)
+					continue
+				}
+				l.collectFields(embedded, fieldPath, depth+1, fieldPos, byName, names)
+				continue
+			}
+		}
+		if v.Name() == "_" {
+			continue
+		}
+		if !v.Exported() {
+			l.report(fieldPos, fieldPath, "is unexported and is not stored")
+			continue
+		}
+
+		if name == "" {
+			name = v.Name()
+		}
+		if _, ok := byName[name]; !ok {
+			*names = append(*names, name)
+		}
+		byName[name] = append(byName[name], jsonField{v: v, name: name, path: fieldPath, depth: depth, tagged: tagged, pos: fieldPos})
+	}
+}
+
+// dominantField applies encoding/json's rule for fields stored under the
+// same name: the shallowest wins, and among equally shallow ones the only
+// tagged one. Otherwise none is stored.
+func dominantField(fields []jsonField) (jsonField, bool) {
+	shallowest := fields[0].depth
+	for _, f := range fields {
+		shallowest = min(shallowest, f.depth)
+	}
+	var candidates []jsonField
+	for _, f := range fields {
+		if f.depth == shallowest {
+			candidates = append(candidates, f)
+		}
+	}
+	if len(candidates) == 1 {
+		return candidates[0], true
+	}
+	var tagged []jsonField
+	for _, f := range candidates {
+		if f.tagged {
+			tagged = append(tagged, f)
+		}
+	}
+	if len(tagged) == 1 {
+		return tagged[0], true
+	}
+	return jsonField{}, false
+}
+
+// checkType checks a stored value of type t
+func (l *jsonLinter) checkType(t types.Type, path string) {
+	t = types.Unalias(t)
+	if isTimeDuration(t) {
+		l.report(l.pos, path, "is a time.Duration, which is stored as an integer number of nanoseconds rather than as a string like \"1m30s\"")
+		return
+	}
+	if isJSONMarshaler(t) {
+		return
+	}
+
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsComplex != 0:
+			l.report(l.pos, path, "is a complex number, which encoding/json cannot encode")
+		case u.Kind() == types.UnsafePointer:
+			l.report(l.pos, path, "is an unsafe.Pointer, which encoding/json cannot encode")
+		}
+	case *types.Chan:
+		l.report(l.pos, path, "is a channel, which encoding/json cannot encode")
+	case *types.Signature:
+		l.report(l.pos, path, "is a func, which encoding/json cannot encode")
+	case *types.Interface:
+		l.report(l.pos, path, "is an interface, so it is decoded as map[string]any, []any, string, float64 or bool rather than the type it held")
+	case *types.Pointer:
+		l.pointers++
+		l.checkType(u.Elem(), path)
+		l.pointers--
+	case *types.Slice:
+		l.checkType(u.Elem(), path+"[]")
+	case *types.Array:
+		l.checkType(u.Elem(), path+"[]")
+	case *types.Map:
+		if !isJSONMapKey(u.Key()) {
+			l.report(l.pos, path, "has keys of type %s, which encoding/json cannot encode", u.Key())
+		}
+		l.checkType(u.Elem(), path+"[]")
+	case *types.Struct:
+		named, ok := t.(*types.Named)
+		if !ok {
+			l.checkStruct(u, path, l.pos)
+			return
+		}
+		if pointers, ok := l.visiting[named]; ok {
+			if l.pointers > pointers {
+				l.report(l.pos, path, "refers back to %s through a pointer, and encoding/json fails on cyclic values", named.Obj().Name())
+			}
+			return
+		}
+		if l.checked[named] {
+			return
+		}
+		l.checked[named] = true
+		l.visiting[named] = l.pointers
+		l.checkStruct(u, path, l.pos)
+		delete(l.visiting, named)
+	}
+}
+
+func isTimeDuration(t types.Type) bool {
+	named, ok := types.Unalias(t).(*types.Named)
+	return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "time" && named.Obj().Name() == "Duration"
+}
+
+// isJSONMarshaler reports whether t encodes itself, as JSON or as text
+func isJSONMarshaler(t types.Type) bool {
+	return hasAnyMethod(t, "MarshalJSON") || hasAnyMethod(t, "MarshalText")
+}
+
+// isJSONMapKey reports whether encoding/json can use t as a map key
+func isJSONMapKey(t types.Type) bool {
+	if basic, ok := t.Underlying().(*types.Basic); ok && basic.Info()&(types.IsString|types.IsInteger) != 0 {
+		return true
+	}
+	return hasAnyMethod(t, "MarshalText")
+}
+
+// hasAnyMethod reports whether t or a pointer to it has the method
+func hasAnyMethod(t types.Type, name string) bool {
+	if _, ok := types.Unalias(t).(*types.Pointer); !ok {
+		t = types.NewPointer(t)
+	}
+	obj, _, _ := types.LookupFieldOrMethod(t, true, nil, name)
+	_, ok := obj.(*types.Func)
+	return ok
+}
+
+// runLint handles the lint command, which reports job fields that do not
+// survive being stored as JSON
+func runLint(args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	strict := fs.Bool("strict", false, "fail if there are any findings")
+	buildTags := fs.String("tags", "", "comma-separated build tags the jobs package is loaded with")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		return fmt.Errorf("lint command requires a jobs directory argument")
+	}
+
+	jobs, _, _, _, err := parseJobsDirectory(fs.Arg(0), *buildTags)
+	if err != nil {
+		return err
+	}
+	return reportLint(jobs, *strict)
+}
+
+// reportLint prints the lint findings of the jobs and, in strict mode, fails
+// if there are any
+func reportLint(jobs []JobInfo, strict bool) error {
+	n := 0
+	for _, job := range jobs {
+		for _, issue := range job.Lint {
+			fmt.Println(issue)
+			n++
+		}
+	}
+	if strict && n > 0 {
+		return fmt.Errorf("%d field(s) do not survive being stored as JSON", n)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	jobs, _, _, _, err := parseJobsDirectory("testdata/lint", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lint := map[string][]string{}
+	for _, job := range jobs {
+		lint[job.Name] = job.Lint
+	}
+
+	cases := []struct {
+		job  string
+		want []string
+	}{
+		{"CleanJob", nil},
+		{"UnexportedJob", []string{"UnexportedJob.count is unexported and is not stored"}},
+		{"SkippedJob", nil},
+		{"ChanJob", []string{"ChanJob.Done is a channel"}},
+		{"FuncJob", []string{"FuncJob.Callback is a func"}},
+		{"InterfaceJob", []string{"InterfaceJob.Value is an interface"}},
+		{"DurationJob", []string{"DurationJob.Every is a time.Duration"}},
+		{"CycleJob", []string{"CycleJob.Head.Next refers back to Node through a pointer"}},
+		{"ConflictJob", []string{`ConflictJob.Inner.Name and ConflictJob.Other.Name are all stored as "Name"`}},
+	}
+	for _, c := range cases {
+		got, ok := lint[c.job]
+		if !ok {
+			t.Errorf("%s was not parsed as a job", c.job)
+			continue
+		}
+		if len(got) != len(c.want) {
+			t.Errorf("%s has findings %q, want %d", c.job, got, len(c.want))
+			continue
+		}
+		for i, want := range c.want {
+			if !strings.Contains(got[i], want) {
+				t.Errorf("%s finding %q does not contain %q", c.job, got[i], want)
+			}
+		}
+	}
+}
+
+func TestLintEmbeddedWithID(t *testing.T) {
+	if _, code := runOmniq(t, "lint", "-strict", "../../examples/postgres/jobs"); code != 0 {
+		t.Errorf("lint -strict on the example exited with %d, want 0 since omniq.WithID is not a finding", code)
+	}
+}
+
+func TestLintStrict(t *testing.T) {
+	cases := []struct {
+		args []string
+		code int
+	}{
+		{[]string{"lint", "testdata/lint"}, 0},
+		{[]string{"lint", "-strict", "testdata/lint"}, 1},
+		{[]string{"lint"}, 1},
+	}
+	for _, c := range cases {
+		out, code := runOmniq(t, c.args...)
+		if code != c.code {
+			t.Errorf("omniq %s exited with %d, want %d:\n%s", strings.Join(c.args, " "), code, c.code, out)
+		}
+	}
+
+	out, _ := runOmniq(t, "lint", "-strict", "testdata/lint")
+	if !strings.Contains(out, "7 field(s) do not survive being stored as JSON") {
+		t.Errorf("lint -strict printed\n%s\nwant the number of findings", out)
+	}
+}
@@ -20,6 +20,16 @@ func main() {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
+	case "check":
+		if err := runCheck(args); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	case "lint":
+		if err := runLint(args); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 	case "init":
 		if err := runInit(args); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -30,6 +40,11 @@ func main() {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
+	case "migrate":
+		if err := runMigrate(args); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 	case "help", "-h", "--help":
 		printUsage()
 	default:
@@ -43,13 +58,22 @@ func printUsage() {
 	fmt.Println("omniq - Job queue code generator")
 	fmt.Println()
 	fmt.Println("Usage:")
-	fmt.Println("  omniq generate <jobs_directory>  Generate jobs_gen.go from job definitions")
+	fmt.Println("  omniq generate [-tags list] [-strict] [-tests] <jobs_directory>")
+	fmt.Println("                                   Generate jobs_gen.go from job definitions")
+	fmt.Println("  omniq check [-tags list] <jobs_directory>")
+	fmt.Println("                                   Fail if a job's fields changed without a version bump")
+	fmt.Println("  omniq lint [-tags list] [-strict] <jobs_directory>")
+	fmt.Println("                                   Report job fields that do not survive being stored as JSON")
 	fmt.Println("  omniq init                       Initialize a jobs package in current directory")
 	fmt.Println("  omniq add <job_name>             Add a new job to the jobs package")
+	fmt.Println("  omniq migrate [-table name] [-schema name] [-dead-table name] [-history-table name]")
+	fmt.Println("                [-history-partitioning none|daily|weekly] [-from version]")
+	fmt.Println("                                   Print the postgres schema migrations as SQL")
 	fmt.Println("  omniq help                       Show this help message")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  omniq generate ./jobs")
 	fmt.Println("  omniq init")
 	fmt.Println("  omniq add SendEmailJob")
+	fmt.Println("  omniq migrate -table lorem_ipsum | psql")
 }
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// omniqMainVariable makes the test binary run main instead of the tests, so
+// tests can check what the command prints and how it exits.
+const omniqMainVariable = "OMNIQ_TEST_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(omniqMainVariable) != "" {
+		os.Args = append([]string{"omniq"}, os.Args[1:]...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runOmniq runs the command with the arguments and returns its combined
+// output and exit code.
+func runOmniq(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), omniqMainVariable+"=1")
+	out, err := cmd.CombinedOutput()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		return string(out), exit.ExitCode()
+	}
+	if err != nil {
+		t.Fatalf("running omniq %v: %v", args, err)
+	}
+	return string(out), 0
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/eugen-bondarev/omniq"
+)
+
+var partitionIntervals = map[string]omniq.PGPartitionInterval{
+	"none":   omniq.PGPartitionNone,
+	"daily":  omniq.PGPartitionDaily,
+	"weekly": omniq.PGPartitionWeekly,
+}
+
+// runMigrate handles the migrate command
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	table := fs.String("table", "omniq_jobs", "name of the jobs table")
+	schema := fs.String("schema", "", "schema of the jobs table (default: the search path)")
+	deadTable := fs.String("dead-table", "", "name of the dead-letter table (default: the jobs table name with a _dead suffix)")
+	historyTable := fs.String("history-table", "", "name of the history table (default: the jobs table name with a _history suffix)")
+	partitioning := fs.String("history-partitioning", "none", "partition the history table by finish time: none, daily or weekly")
+	from := fs.Int("from", 0, "schema version already applied; only later migrations are printed")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	interval, ok := partitionIntervals[*partitioning]
+	if !ok {
+		return fmt.Errorf("unknown history partitioning %q, want none, daily or weekly", *partitioning)
+	}
+
+	// Print the script instead of connecting, so it can be reviewed and
+	// applied by a role that is allowed to run DDL
+	script, err := omniq.PGMigrationScript(*from,
+		omniq.WithTableName(*table),
+		omniq.WithSchema(*schema),
+		omniq.WithDeadLetterTableName(*deadTable),
+		omniq.WithHistoryTableName(*historyTable),
+		omniq.WithHistoryPartitioning(interval),
+	)
+	if err != nil {
+		return err
+	}
+	fmt.Print(script)
+	return nil
+}
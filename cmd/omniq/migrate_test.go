@@ -0,0 +1,28 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrateTableFlags(t *testing.T) {
+	out, code := runOmniq(t, "migrate", "-table", "work", "-dead-table", "failed", "-history-table", "finished", "-history-partitioning", "daily")
+	if code != 0 {
+		t.Fatalf("migrate exited with %d:\n%s", code, out)
+	}
+	for _, want := range []string{`CREATE TABLE IF NOT EXISTS "work"`, `"failed"`, `"finished"`, `PARTITION BY RANGE (finished_at)`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("the script does not contain %s:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "work_dead") || strings.Contains(out, "work_history") {
+		t.Errorf("the script uses the default table names:\n%s", out)
+	}
+}
+
+func TestMigrateInvalidPartitioning(t *testing.T) {
+	out, code := runOmniq(t, "migrate", "-history-partitioning", "monthly")
+	if code == 0 || !strings.Contains(out, `unknown history partitioning "monthly"`) {
+		t.Errorf("migrate exited with %d, want it to reject the interval:\n%s", code, out)
+	}
+}
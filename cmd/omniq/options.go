@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// generateOptions writes the option methods of the job's directives, which
+// the scheduler finds through omniq's optional job interfaces.
+func generateOptions(job JobInfo) string {
+	w := &codecWriter{}
+	if job.Queue != "" {
+		w.line("func (j *%s) Queue() string {", job.Name)
+		w.line("return %s", strconv.Quote(job.Queue))
+		w.line("}\n")
+	}
+	if r := job.Retries; r != nil {
+		w.line("func (j *%s) Retries() omniq.RetryPolicy {", job.Name)
+		if r.Delay > 0 {
+			w.line("return omniq.RetryPolicy{Retries: %d, Backoff: %s, Delay: %s}", r.Count, backoffs[r.Backoff], durationExpr(r.Delay))
+		} else {
+			w.line("return omniq.RetryPolicy{Retries: %d, Backoff: %s}", r.Count, backoffs[r.Backoff])
+		}
+		w.line("}\n")
+	}
+	if job.Timeout > 0 {
+		w.line("func (j *%s) Timeout() time.Duration {", job.Name)
+		w.line("return %s", durationExpr(job.Timeout))
+		w.line("}\n")
+	}
+	if job.Unique != nil {
+		pairs := make([]string, len(job.Unique))
+		for i, f := range job.Unique {
+			pairs[i] = fmt.Sprintf("%s: j.%s", strconv.Quote(f.JSONName), f.Name)
+		}
+		w.line("func (j *%s) UniqueFields() map[string]any {", job.Name)
+		w.line("return map[string]any{%s}", strings.Join(pairs, ", "))
+		w.line("}\n")
+	}
+	if job.Priority != nil {
+		w.line("func (j *%s) Priority() int {", job.Name)
+		w.line("return %d", *job.Priority)
+		w.line("}\n")
+	}
+	return w.String()
+}
+
+// durationExpr writes d the way a person would, e.g. 30 * time.Second.
+func durationExpr(d time.Duration) string {
+	units := []struct {
+		unit time.Duration
+		name string
+	}{
+		{time.Hour, "time.Hour"},
+		{time.Minute, "time.Minute"},
+		{time.Second, "time.Second"},
+		{time.Millisecond, "time.Millisecond"},
+		{time.Microsecond, "time.Microsecond"},
+	}
+	for _, u := range units {
+		if d%u.unit != 0 {
+			continue
+		}
+		if d == u.unit {
+			return u.name
+		}
+		return fmt.Sprintf("%d * %s", d/u.unit, u.name)
+	}
+	return fmt.Sprintf("time.Duration(%d)", d)
+}
@@ -5,20 +5,89 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
+	"go/types"
+	"maps"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+
+	"golang.org/x/tools/go/packages"
 )
 
 type JobInfo struct {
-	Name       string
+	Name string
+	// TypeName is what Type returns and what the job is stored under. It is
+	// the struct name unless a //omniq:type directive or a TypeName method
+	// sets another.
+	TypeName string
+	// Aliases are type names the job was stored under before, which the
+	// factory still accepts.
+	Aliases    []string
 	Fields     []FieldInfo
 	DepType    string
 	DepPackage string
+	// Embedded lists embedded fields other than omniq.WithID. encoding/json
+	// inlines their fields, which the generated codecs do not, so such jobs
+	// keep the reflective path.
+	Embedded []string
+	// CustomJSON is set when the job defines MarshalJSON or UnmarshalJSON itself.
+	CustomJSON bool
+	// Codec holds the generated MarshalJSON and UnmarshalJSON, empty if the
+	// job is encoded with encoding/json.
+	Codec string
+	// Version is what the job's Version method returns, 0 if it has none.
+	Version int
+	// Upcasters holds the upcaster for each version below Version, "nil" where
+	// there is none.
+	Upcasters []string
+	// Queue, Retries, Timeout, Unique and Priority are set by the //omniq:
+	// directives of the same names.
+	Queue    string
+	Retries  *RetryInfo
+	Timeout  time.Duration
+	Unique   []FieldInfo
+	Priority *int
+	// Options holds the generated option methods for the directives above.
+	Options string
+	// Imports maps the import paths of the packages that the field and
+	// dependency types refer to to their names, for the generated client.
+	Imports map[string]string
+	// Client holds the generated Args struct and Client method.
+	Client string
+	// Sample holds the fields of a composite literal of the job with non-zero
+	// values, and TestImports the packages it refers to, for the generated
+	// tests.
+	Sample      string
+	TestImports map[string]string
+	// Lint lists the fields that do not survive being stored as JSON. Jobs
+	// that encode themselves or use another codec are not checked.
+	Lint []string
+}
+
+// RetryInfo is the retry policy of a //omniq:retries directive.
+type RetryInfo struct {
+	Count   int
+	Backoff string
+	Delay   time.Duration
 }
 
 type FieldInfo struct {
 	Name string
 	Type string
+	// Source is the type as written, for declaring fields of the same type.
+	Source string
+	// GoType is the type-checked type, which the generated codecs follow.
+	GoType types.Type
+	// JSONName is the key the field is stored under, "-" if it is not stored.
+	JSONName  string
+	OmitEmpty bool
+	// Quoted is set by the ",string" option, which the generated codecs do
+	// not implement.
+	Quoted bool
 }
 
 type GenerationData struct {
@@ -26,257 +95,547 @@ type GenerationData struct {
 	Jobs      []JobInfo
 	DepType   string
 	DepImport string
+	// Imports the generated code needs beyond omniq and the dependencies
+	StdImports []string
+	Imports    []string
+}
+
+// upcasterInfo is a function named Upcast<Job>V<N>, which migrates the state
+// of Job from version N to N+1.
+type upcasterInfo struct {
+	Name string
+	Job  string
+	From int
 }
 
+var upcasterName = regexp.MustCompile(`^Upcast(\w+)V([0-9]+)$`)
+
 type AddJobData struct {
 	JobName   string
 	RunParams string
 }
 
-// parseJobsDirectory scans all .go files in a directory and extracts job information
-func parseJobsDirectory(jobsDir string) ([]JobInfo, string, string, string, error) {
-	// Find all .go files in the directory, excluding generate.go and *_gen.go
-	files, err := filepath.Glob(filepath.Join(jobsDir, "*.go"))
+// omniqPath is the import path of the omniq package, whose WithID and Job
+// the jobs are checked against
+const omniqPath = "github.com/eugen-bondarev/omniq"
+
+// generatedFile is the file generate writes. It is left out when the jobs
+// are loaded, so that a stale or missing one does not get in the way.
+const generatedFile = "jobs_gen.go"
+
+// loadJobsPackage type-checks the package in jobsDir with the given build
+// tags. The generated file is replaced by generated, or by an empty file of
+// the package if generated is nil. Type errors are left in the package's
+// Errors for the caller to judge.
+func loadJobsPackage(jobsDir, buildTags string, generated []byte) (*packages.Package, error) {
+	cfg := &packages.Config{Mode: packages.NeedName | packages.NeedFiles, Dir: jobsDir}
+	if buildTags != "" {
+		cfg.BuildFlags = []string{"-tags=" + buildTags}
+	}
+	pkgs, err := packages.Load(cfg, ".")
 	if err != nil {
-		return nil, "", "", "", err
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("expected one package in %s, found %d", jobsDir, len(pkgs))
+	}
+	if len(pkgs[0].Errors) > 0 {
+		return nil, pkgs[0].Errors[0]
 	}
 
-	var jobFiles []string
-	for _, file := range files {
-		basename := filepath.Base(file)
-		if basename == "generate.go" || strings.HasSuffix(basename, "_gen.go") {
-			continue
-		}
-		jobFiles = append(jobFiles, file)
+	if generated == nil {
+		generated = []byte("package " + pkgs[0].Name + "\n")
+	}
+	output, err := filepath.Abs(filepath.Join(jobsDir, generatedFile))
+	if err != nil {
+		return nil, err
+	}
+	cfg.Mode |= packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo
+	cfg.Overlay = map[string][]byte{output: generated}
+	pkgs, err = packages.Load(cfg, ".")
+	if err != nil {
+		return nil, err
 	}
+	return pkgs[0], nil
+}
 
-	if len(jobFiles) == 0 {
+// parseJobsDirectory type-checks the package in jobsDir and extracts the jobs,
+// which are the named struct types with a Run method declared on them
+func parseJobsDirectory(jobsDir, buildTags string) ([]JobInfo, string, string, string, error) {
+	pkg, err := loadJobsPackage(jobsDir, buildTags, nil)
+	if err != nil {
+		return nil, "", "", "", err
+	}
+	if len(pkg.Syntax) == 0 {
 		return nil, "", "", "", fmt.Errorf("no job files found in directory %s", jobsDir)
 	}
-
-	var allJobs []JobInfo
-	var packageName string
-	var commonDepType string
-	var depImportPath string
-
-	// Parse each job file
-	for _, filename := range jobFiles {
-		jobs, pkgName, fileDepType, depImport, err := parseJobsFile(filename)
-		if err != nil {
-			return nil, "", "", "", fmt.Errorf("error parsing %s: %v", filename, err)
+	if err := packageErrors(pkg); err != nil {
+		return nil, "", "", "", err
+	}
+	noteExcludedJobs(pkg)
+
+	p := &jobsParser{pkg: pkg, decls: map[*types.Func]*ast.FuncDecl{}}
+	for _, file := range pkg.Syntax {
+		for _, decl := range file.Decls {
+			if funcDecl, ok := decl.(*ast.FuncDecl); ok {
+				if fn, ok := pkg.TypesInfo.Defs[funcDecl.Name].(*types.Func); ok {
+					p.decls[fn] = funcDecl
+				}
+			}
 		}
+	}
 
-		if packageName == "" {
-			packageName = pkgName
-		} else if packageName != pkgName {
-			return nil, "", "", "", fmt.Errorf("package name mismatch: %s has package %s, but expected %s", filename, pkgName, packageName)
+	var jobs []JobInfo
+	for _, file := range pkg.Syntax {
+		for _, decl := range file.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range genDecl.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				doc := typeSpec.Doc
+				if doc == nil && len(genDecl.Specs) == 1 {
+					doc = genDecl.Doc
+				}
+				job, ok, err := p.parseJob(typeSpec, doc)
+				if err != nil {
+					return nil, "", "", "", err
+				}
+				if ok {
+					jobs = append(jobs, job)
+				}
+			}
 		}
+	}
 
-		if commonDepType == "" && len(jobs) > 0 {
-			commonDepType = fileDepType
-			depImportPath = depImport
+	upcasters, err := p.findUpcasters()
+	if err != nil {
+		return nil, "", "", "", err
+	}
+	if err := attachUpcasters(jobs, upcasters); err != nil {
+		return nil, "", "", "", err
+	}
+	if err := checkTypeNames(jobs); err != nil {
+		return nil, "", "", "", err
+	}
+	return jobs, pkg.Name, p.depType, p.depImport, nil
+}
+
+// packageErrors lists the errors of loading and type-checking the package.
+// Since the generated file is left out, code in the jobs package must not
+// depend on it.
+func packageErrors(pkg *packages.Package) error {
+	if len(pkg.Errors) == 0 {
+		return nil
+	}
+	// go list reports the compiler's view of type errors as well, in a
+	// single error of its own
+	var errs []string
+	for _, e := range pkg.Errors {
+		if e.Kind != packages.ListError {
+			errs = append(errs, e.Error())
 		}
+	}
+	if len(errs) == 0 {
+		for _, e := range pkg.Errors {
+			errs = append(errs, e.Error())
+		}
+	}
+	return fmt.Errorf("package %s does not compile:\n\t%s", pkg.Name, strings.Join(errs, "\n\t"))
+}
 
-		// Verify all jobs in this file have the same dependency type
-		for _, job := range jobs {
-			if job.DepType != commonDepType {
-				return nil, "", "", "", fmt.Errorf("dependency type mismatch: job %s has type %s, but expected %s",
-					job.Name, job.DepType, commonDepType)
+// noteExcludedJobs points out files with Run methods that the build
+// constraints leave out, as their jobs are not generated.
+func noteExcludedJobs(pkg *packages.Package) {
+	for _, filename := range pkg.IgnoredFiles {
+		if strings.HasSuffix(filename, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), filename, nil, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+		for _, decl := range file.Decls {
+			if funcDecl, ok := decl.(*ast.FuncDecl); ok && funcDecl.Recv != nil && funcDecl.Name.Name == "Run" {
+				fmt.Printf("Note: %s is excluded by its build constraints, so its jobs are left out; pass -tags to include them\n", filepath.Base(filename))
+				break
 			}
 		}
-
-		allJobs = append(allJobs, jobs...)
 	}
+}
+
+// jobsParser holds what the jobs of a package share
+type jobsParser struct {
+	pkg *packages.Package
+	// decls finds the declaration of a method, for reading the literals that
+	// TypeName and Version return
+	decls     map[*types.Func]*ast.FuncDecl
+	dep       types.Type
+	depType   string
+	depImport string
+	// depImports are the packages the dependency type refers to
+	depImports map[string]string
+}
 
-	return allJobs, packageName, commonDepType, depImportPath, nil
+// qualifier writes the names of other packages as the generated code refers
+// to them, and records them in imports if it is not nil
+func (p *jobsParser) qualifier(imports map[string]string) types.Qualifier {
+	return func(other *types.Package) string {
+		if other == p.pkg.Types {
+			return ""
+		}
+		if imports != nil {
+			imports[other.Path()] = other.Name()
+		}
+		return other.Name()
+	}
 }
 
-// parseJobsFile parses a single Go file and extracts job information
-func parseJobsFile(filename string) ([]JobInfo, string, string, string, error) {
-	fset := token.NewFileSet()
-	node, err := parser.ParseFile(fset, filename, nil, parser.ParseComments)
+// parseJob describes the type declared by typeSpec if it is a job. Directives
+// on anything but a job are an error.
+func (p *jobsParser) parseJob(typeSpec *ast.TypeSpec, doc *ast.CommentGroup) (JobInfo, bool, error) {
+	directives, err := parseDirectives(p.pkg.Fset, doc)
 	if err != nil {
-		return nil, "", "", "", err
+		return JobInfo{}, false, err
+	}
+	notAJob := func(reason string) (JobInfo, bool, error) {
+		if len(directives) > 0 {
+			return JobInfo{}, false, fmt.Errorf("%s: %s has %s directives but %s", directives[0].Pos, typeSpec.Name.Name, directivePrefix, reason)
+		}
+		return JobInfo{}, false, nil
 	}
 
-	var jobs []JobInfo
-	packageName := node.Name.Name
-	var depImportPath string
-	var commonDepType string
-
-	// First pass: find imports to build import map
-	importMap := make(map[string]string) // local name -> full path
-	for _, imp := range node.Imports {
-		if imp.Path.Value != "" {
-			path := strings.Trim(imp.Path.Value, "\"")
-			var localName string
-			if imp.Name != nil {
-				localName = imp.Name.Name
-			} else {
-				// Extract package name from path
-				parts := strings.Split(path, "/")
-				localName = parts[len(parts)-1]
-			}
-			importMap[localName] = path
+	obj, ok := p.pkg.TypesInfo.Defs[typeSpec.Name].(*types.TypeName)
+	if !ok || obj.IsAlias() {
+		// An alias of a job is the same job
+		return notAJob("is an alias")
+	}
+	named, ok := obj.Type().(*types.Named)
+	if !ok {
+		return notAJob("is not a named type")
+	}
+	name := obj.Name()
+	run := declaredMethod(named, "Run")
+	if run == nil {
+		return notAJob("no Run method")
+	}
+	structType, ok := named.Underlying().(*types.Struct)
+	if !ok {
+		return notAJob("is not a struct")
+	}
+	if named.TypeParams().Len() > 0 {
+		return JobInfo{}, false, fmt.Errorf("%s has type parameters; the factory needs a concrete type for every job", name)
+	}
+
+	// The dependencies are the single parameter of Run, and the same for all
+	// jobs
+	sig := run.Type().(*types.Signature)
+	if sig.Params().Len() != 1 || sig.Results().Len() != 0 {
+		return JobInfo{}, false, fmt.Errorf("%s: %s.Run must take the dependencies as its only parameter and return nothing, e.g. Run(d struct{})", p.pkg.Fset.Position(run.Pos()), name)
+	}
+	dep := sig.Params().At(0).Type()
+	if p.dep == nil {
+		p.dep = dep
+		p.depImports = map[string]string{}
+		p.depType = types.TypeString(dep, p.qualifier(p.depImports))
+		if depNamed, ok := types.Unalias(derefType(dep)).(*types.Named); ok && depNamed.Obj().Pkg() != nil && depNamed.Obj().Pkg() != p.pkg.Types {
+			p.depImport = depNamed.Obj().Pkg().Path()
 		}
+	} else if !types.Identical(dep, p.dep) {
+		return JobInfo{}, false, fmt.Errorf("dependency type mismatch: job %s has type %s, but expected %s", name, types.TypeString(dep, p.qualifier(nil)), p.depType)
 	}
 
-	// Second pass: find job structs and their Run methods
-	for _, decl := range node.Decls {
-		genDecl, ok := decl.(*ast.GenDecl)
-		if !ok || genDecl.Tok != token.TYPE {
-			continue
+	for _, generated := range []string{"Type", "GetIDContainer"} {
+		if declaredMethod(named, generated) != nil {
+			return JobInfo{}, false, fmt.Errorf("%s defines %s, which is generated", name, generated)
 		}
+	}
 
-		for _, spec := range genDecl.Specs {
-			typeSpec, ok := spec.(*ast.TypeSpec)
-			if !ok {
+	// Extract fields (excluding WithID)
+	var fields []FieldInfo
+	var embedded []string
+	imports := maps.Clone(p.depImports)
+	hasID := false
+	for i := range structType.NumFields() {
+		field := structType.Field(i)
+		if field.Embedded() {
+			if isOmniqType(field.Type(), "WithID") {
+				hasID = true
 				continue
 			}
+			embedded = append(embedded, types.TypeString(field.Type(), p.qualifier(imports)))
+			continue
+		}
+		info := newFieldInfo(field.Name(), types.TypeString(types.Unalias(field.Type()), p.qualifier(nil)), structType.Tag(i))
+		info.GoType = field.Type()
+		if field.Exported() {
+			info.Source = types.TypeString(field.Type(), p.qualifier(imports))
+		}
+		fields = append(fields, info)
+	}
+	if !hasID {
+		return JobInfo{}, false, fmt.Errorf("%s does not embed omniq.WithID", name)
+	}
 
-			structType, ok := typeSpec.Type.(*ast.StructType)
-			if !ok {
-				continue
-			}
+	version := 0
+	if method := p.decl(declaredMethod(named, "Version")); method != nil {
+		if version, err = parseVersion(method); err != nil {
+			return JobInfo{}, false, fmt.Errorf("%s.Version: %v", name, err)
+		}
+	}
 
-			// Check if this struct has a Run method
-			runMethod := findRunMethod(node, typeSpec.Name.Name)
-			if runMethod == nil {
-				continue // Not a job struct
-			}
+	job := JobInfo{
+		Name:       name,
+		TypeName:   name,
+		Fields:     fields,
+		DepType:    p.depType,
+		DepPackage: p.depImport,
+		Embedded:   embedded,
+		CustomJSON: hasMethod(named, "MarshalJSON") || hasMethod(named, "UnmarshalJSON"),
+		Version:    version,
+		Imports:    imports,
+	}
+	if err := applyDirectives(directives, &job); err != nil {
+		return JobInfo{}, false, err
+	}
+	for _, d := range directives {
+		if method, ok := optionMethods[d.Name]; ok && declaredMethod(named, method) != nil {
+			return JobInfo{}, false, d.errorf("%s defines %s itself", job.Name, method)
+		}
+	}
+	if job.Unique != nil && hasMethod(named, "Codec") {
+		return JobInfo{}, false, fmt.Errorf("%s is unique, so it must be stored as JSON, but it defines Codec", job.Name)
+	}
+	if !job.CustomJSON && !hasMethod(named, "Codec") {
+		job.Lint = lintJob(p.pkg.Fset, named)
+	}
+	job.TestImports = map[string]string{}
+	sampler := &sampler{qualifier: p.qualifier(job.TestImports)}
+	job.Sample = sampler.sampleFields(structType, "", 0)
+	if method := declaredMethod(named, "TypeName"); method != nil {
+		if job.TypeName != job.Name {
+			return JobInfo{}, false, fmt.Errorf("%s has both a TypeName method and a type name in %stype", job.Name, directivePrefix)
+		}
+		decl := p.decl(method)
+		if decl == nil {
+			return JobInfo{}, false, fmt.Errorf("%s.TypeName: declaration not found", job.Name)
+		}
+		if job.TypeName, err = parseTypeName(decl); err != nil {
+			return JobInfo{}, false, fmt.Errorf("%s.TypeName: %v", job.Name, err)
+		}
+	}
+	return job, true, nil
+}
 
-			// Extract dependency type from Run method
-			depType, err := extractDependencyType(runMethod, importMap)
-			if err != nil {
-				return nil, "", "", "", fmt.Errorf("error extracting dependency type from %s.Run: %v", typeSpec.Name.Name, err)
-			}
+func (p *jobsParser) decl(method *types.Func) *ast.FuncDecl {
+	if method == nil {
+		return nil
+	}
+	return p.decls[method]
+}
 
-			// Set common dependency type and import
-			if commonDepType == "" {
-				commonDepType = depType
-				// Find the import path for this dependency type
-				if strings.Contains(depType, ".") {
-					parts := strings.Split(depType, ".")
-					if len(parts) >= 2 {
-						pkgName := parts[0]
-						if importPath, ok := importMap[pkgName]; ok {
-							depImportPath = importPath
-						}
-					}
-				}
-			} else if depType != commonDepType {
-				return nil, "", "", "", fmt.Errorf("dependency type mismatch in file %s: job %s has type %s, but expected %s",
-					filename, typeSpec.Name.Name, depType, commonDepType)
-			}
+// declaredMethod finds a method declared on the named type itself, with a
+// value or a pointer receiver
+func declaredMethod(named *types.Named, name string) *types.Func {
+	for i := range named.NumMethods() {
+		if m := named.Method(i); m.Name() == name {
+			return m
+		}
+	}
+	return nil
+}
 
-			// Extract fields (excluding WithID)
-			var fields []FieldInfo
-			for _, field := range structType.Fields.List {
-				// Skip embedded WithID field
-				if len(field.Names) == 0 {
-					continue
-				}
+// hasMethod reports whether a pointer to the type has the method, including
+// ones promoted from embedded fields
+func hasMethod(named *types.Named, name string) bool {
+	obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(named), true, nil, name)
+	_, ok := obj.(*types.Func)
+	return ok
+}
 
-				for _, name := range field.Names {
-					if name.Name == "WithID" {
-						continue
-					}
-					fieldType := exprToString(field.Type)
-					fields = append(fields, FieldInfo{
-						Name: name.Name,
-						Type: fieldType,
-					})
-				}
-			}
+// isOmniqType reports whether t is the named type of the omniq package
+func isOmniqType(t types.Type, name string) bool {
+	named, ok := types.Unalias(t).(*types.Named)
+	return ok && named.Obj().Name() == name && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == omniqPath
+}
 
-			jobs = append(jobs, JobInfo{
-				Name:       typeSpec.Name.Name,
-				Fields:     fields,
-				DepType:    depType,
-				DepPackage: depImportPath,
-			})
-		}
+func derefType(t types.Type) types.Type {
+	if ptr, ok := types.Unalias(t).(*types.Pointer); ok {
+		return ptr.Elem()
 	}
-
-	return jobs, packageName, commonDepType, depImportPath, nil
+	return t
 }
 
-// findRunMethod finds the Run method for a given struct name
-func findRunMethod(node *ast.File, structName string) *ast.FuncDecl {
-	for _, decl := range node.Decls {
-		funcDecl, ok := decl.(*ast.FuncDecl)
-		if !ok || funcDecl.Recv == nil || funcDecl.Name.Name != "Run" {
+// findUpcasters finds the functions named Upcast<Job>V<N> and checks that
+// they are omniq.Upcaster functions
+func (p *jobsParser) findUpcasters() ([]upcasterInfo, error) {
+	var upcasters []upcasterInfo
+	scope := p.pkg.Types.Scope()
+	for _, name := range scope.Names() {
+		fn, ok := scope.Lookup(name).(*types.Func)
+		if !ok {
 			continue
 		}
-
-		if len(funcDecl.Recv.List) == 0 {
+		match := upcasterName.FindStringSubmatch(name)
+		if match == nil {
 			continue
 		}
 
-		// Check if receiver is our struct
-		recvType := funcDecl.Recv.List[0].Type
-		if starExpr, ok := recvType.(*ast.StarExpr); ok {
-			if ident, ok := starExpr.X.(*ast.Ident); ok && ident.Name == structName {
-				return funcDecl
-			}
+		sig := fn.Type().(*types.Signature)
+		if sig.Params().Len() != 1 || !isStateMap(sig.Params().At(0).Type()) ||
+			sig.Results().Len() != 1 || !types.Identical(sig.Results().At(0).Type(), types.Universe.Lookup("error").Type()) {
+			return nil, fmt.Errorf("%s must be a func(state map[string]any) error", name)
 		}
+		from, _ := strconv.Atoi(match[2])
+		upcasters = append(upcasters, upcasterInfo{Name: name, Job: match[1], From: from})
 	}
-	return nil
+	return upcasters, nil
+}
+
+func isStateMap(t types.Type) bool {
+	m, ok := types.Unalias(t).(*types.Map)
+	if !ok || !types.Identical(m.Key(), types.Typ[types.String]) {
+		return false
+	}
+	iface, ok := types.Unalias(m.Elem()).(*types.Interface)
+	return ok && iface.Empty()
 }
 
-// extractDependencyType extracts the dependency type from a Run method
-func extractDependencyType(funcDecl *ast.FuncDecl, importMap map[string]string) (string, error) {
-	if funcDecl.Type.Params == nil || len(funcDecl.Type.Params.List) == 0 {
-		// No parameters means no dependencies - use struct{}
-		return "struct{}", nil
+// verifyGenerated type-checks the package with the generated code in place
+// and makes sure that every job implements omniq.Job of the dependencies.
+func verifyGenerated(jobsDir, buildTags string, jobs []JobInfo, generated []byte) error {
+	pkg, err := loadJobsPackage(jobsDir, buildTags, generated)
+	if err != nil {
+		return err
+	}
+	if err := packageErrors(pkg); err != nil {
+		return fmt.Errorf("with the generated code, %v", err)
 	}
 
-	// Expecting exactly one parameter (the dependency)
-	if len(funcDecl.Type.Params.List) != 1 {
-		return "", fmt.Errorf("Run method should have zero or one parameter")
+	i := slices.IndexFunc(pkg.Types.Imports(), func(p *types.Package) bool { return p.Path() == omniqPath })
+	if i < 0 {
+		return fmt.Errorf("the generated code does not import %s", omniqPath)
 	}
+	jobType := pkg.Types.Imports()[i].Scope().Lookup("Job").Type()
+	for _, job := range jobs {
+		named := pkg.Types.Scope().Lookup(job.Name).Type().(*types.Named)
+		dep := declaredMethod(named, "Run").Type().(*types.Signature).Params().At(0).Type()
+		instance, err := types.Instantiate(nil, jobType, []types.Type{dep}, true)
+		if err != nil {
+			return fmt.Errorf("%s: %v", job.Name, err)
+		}
+		iface := instance.Underlying().(*types.Interface)
+		if method, _ := types.MissingMethod(types.NewPointer(named), iface, true); method != nil {
+			return fmt.Errorf("*%s does not implement omniq.Job[%s]: wrong or missing method %s", job.Name, job.DepType, method.Name())
+		}
+	}
+	return nil
+}
+
+// checkTypeNames makes sure every stored type name, current or alias, maps to
+// a single job
+func checkTypeNames(jobs []JobInfo) error {
+	owners := map[string]string{}
+	for _, job := range jobs {
+		for _, name := range append([]string{job.TypeName}, job.Aliases...) {
+			if owner, ok := owners[name]; ok {
+				return fmt.Errorf("type name %q is used by both %s and %s", name, owner, job.Name)
+			}
+			owners[name] = job.Name
+		}
+	}
+	return nil
+}
 
-	param := funcDecl.Type.Params.List[0]
-	depType := exprToString(param.Type)
+// attachUpcasters fills in JobInfo.Upcasters. Upcasters may live in any file
+// of the package, so this runs once all of them are parsed.
+func attachUpcasters(jobs []JobInfo, upcasters []upcasterInfo) error {
+	for _, u := range upcasters {
+		i := slices.IndexFunc(jobs, func(j JobInfo) bool { return j.Name == u.Job })
+		if i < 0 {
+			return fmt.Errorf("%s upcasts %s, which is not a job", u.Name, u.Job)
+		}
+		job := &jobs[i]
+		if u.From < 1 || u.From >= job.Version {
+			return fmt.Errorf("%s upcasts from version %d, but %s is version %d", u.Name, u.From, job.Name, max(job.Version, 1))
+		}
+		if job.Upcasters == nil {
+			job.Upcasters = slices.Repeat([]string{"nil"}, job.Version-1)
+		}
+		job.Upcasters[u.From-1] = u.Name
+	}
+	return nil
+}
 
-	// Resolve the full type name including package if needed
-	if strings.Contains(depType, ".") {
-		parts := strings.Split(depType, ".")
-		if len(parts) >= 2 {
-			pkgName := parts[0]
-			if _, ok := importMap[pkgName]; ok {
-				// Type is already fully qualified with package name
-				return depType, nil
+// parseVersion reads the version a Version method returns. It must be an
+// integer literal, so that generate can check the upcasters against it.
+func parseVersion(method *ast.FuncDecl) (int, error) {
+	if method.Body != nil && len(method.Body.List) == 1 {
+		if ret, ok := method.Body.List[0].(*ast.ReturnStmt); ok && len(ret.Results) == 1 {
+			if lit, ok := ret.Results[0].(*ast.BasicLit); ok && lit.Kind == token.INT {
+				version, err := strconv.Atoi(lit.Value)
+				if err == nil && version >= 1 {
+					return version, nil
+				}
 			}
 		}
 	}
+	return 0, fmt.Errorf("must return a positive integer literal")
+}
 
-	return depType, nil
+// parseTypeName reads the name a TypeName method returns, which must be a
+// string literal so that the factory can switch on it.
+func parseTypeName(method *ast.FuncDecl) (string, error) {
+	if method.Body != nil && len(method.Body.List) == 1 {
+		if ret, ok := method.Body.List[0].(*ast.ReturnStmt); ok && len(ret.Results) == 1 {
+			if lit, ok := ret.Results[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				name, err := strconv.Unquote(lit.Value)
+				if err == nil && name != "" {
+					return name, nil
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("must return a non-empty string literal")
 }
 
-// exprToString converts an AST expression to its string representation
-func exprToString(expr ast.Expr) string {
-	switch e := expr.(type) {
-	case *ast.Ident:
-		return e.Name
-	case *ast.SelectorExpr:
-		return exprToString(e.X) + "." + e.Sel.Name
-	case *ast.StarExpr:
-		return "*" + exprToString(e.X)
-	case *ast.ArrayType:
-		return "[]" + exprToString(e.Elt)
-	case *ast.MapType:
-		return "map[" + exprToString(e.Key) + "]" + exprToString(e.Value)
-	case *ast.StructType:
-		return "struct{}"
-	default:
-		return fmt.Sprintf("%T", e)
+// newFieldInfo describes a struct field, reading its json tag the way
+// encoding/json does
+func newFieldInfo(name, fieldType string, tag string) FieldInfo {
+	info := FieldInfo{Name: name, Type: fieldType, JSONName: name}
+	if !ast.IsExported(name) {
+		info.JSONName = "-"
+		return info
+	}
+
+	jsonTag, ok := reflect.StructTag(tag).Lookup("json")
+	if !ok {
+		return info
+	}
+	if jsonTag == "-" {
+		info.JSONName = "-"
+		return info
+	}
+
+	tagName, opts, _ := strings.Cut(jsonTag, ",")
+	if tagName != "" {
+		info.JSONName = tagName
+	}
+	for _, opt := range strings.Split(opts, ",") {
+		switch opt {
+		case "omitempty":
+			info.OmitEmpty = true
+		case "string":
+			info.Quoted = true
+		}
 	}
+	return info
 }
 
 // detectExistingJobDependency detects the dependency type used by existing jobs in a directory
 func detectExistingJobDependency(jobsDir string) (string, string, error) {
-	jobs, _, depType, depImport, err := parseJobsDirectory(jobsDir)
+	jobs, _, depType, depImport, err := parseJobsDirectory(jobsDir, "")
 	if err != nil {
 		// If parsing fails, it might be because there are no jobs yet
 		return "struct{}", "", nil
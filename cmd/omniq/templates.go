@@ -46,43 +46,126 @@ func (j *{{.JobName}}) Run({{.RunParams}}) {
 const generateTemplate = `package {{.Package}}
 
 import (
-	"encoding/json"
-	
+{{range .StdImports}}	{{.}}
+{{end}}
 	"github.com/eugen-bondarev/omniq"
-
+{{range .Imports}}	{{.}}
+{{end}}
 {{if .DepImport}}	"{{.DepImport}}"{{end}}
 )
 
 // Jobs
 {{range .Jobs}}func (j *{{.Name}}) Type() string {
-	return "{{.Name}}"
+	return {{printf "%q" .TypeName}}
 }
 
 {{end}}{{range .Jobs}}func (j *{{.Name}}) GetIDContainer() *omniq.WithID {
 	return &j.WithID
 }
 
-{{end}}{{range .Jobs}}func New{{.Name}}(id omniq.JobID, data string) *{{.Name}} {
+{{end}}{{range .Jobs}}{{if .Options}}{{.Options}}{{end}}{{end}}{{range .Jobs}}{{if .Codec}}{{.Codec}}
+{{end}}{{end}}{{range .Jobs}}func New{{.Name}}(id omniq.JobID, payload omniq.Payload) (*{{.Name}}, error) {
+{{- if .Version}}
+	payload, err := omniq.Upcast(payload, {{.Version}}{{range .Upcasters}}, {{.}}{{end}})
+	if err != nil {
+		return nil, fmt.Errorf("decoding {{.Name}} %s: %w", id, err)
+	}
+{{- end}}
 	var j {{.Name}}
-	json.Unmarshal([]byte(data), &j)
+	if err := payload.Decode(&j); err != nil {
+		return nil, fmt.Errorf("decoding {{.Name}} %s: %w", id, err)
+	}
 	j.ID = id
-	return &j
+	return &j, nil
 }
 
 {{end}}// Registry
 type JobFactory struct{}
 
-func (f *JobFactory) Instantiate(t string, id omniq.JobID, data string) omniq.Job[{{.DepType}}] {
-	var j omniq.Job[{{.DepType}}]
+func (f *JobFactory) Instantiate(t string, id omniq.JobID, payload omniq.Payload) (omniq.Job[{{.DepType}}], error) {
 	switch t {
-{{range .Jobs}}	case "{{.Name}}":
-		j = New{{.Name}}(id, data)
-{{end}}	default:
-		panic("Unknown job type: " + t)
+{{range .Jobs}}	case {{printf "%q" .TypeName}}{{range .Aliases}}, {{printf "%q" .}}{{end}}:
+		j, err := New{{.Name}}(id, payload)
+		if err != nil {
+			return nil, err
+		}
+		return j, nil
+{{end}}	}
+	return nil, fmt.Errorf("%w: %q", omniq.ErrUnknownJobType, t)
+}
+
+// Client schedules the jobs with typed arguments. The options the jobs
+// declare, such as their queue, priority and uniqueness, apply as usual.
+type Client struct {
+	scheduler *omniq.Scheduler[{{.DepType}}]
+}
+
+func NewClient(scheduler *omniq.Scheduler[{{.DepType}}]) *Client {
+	return &Client{scheduler: scheduler}
+}
+
+{{range .Jobs}}{{.Client}}{{end}}`
+
+const generateTestTemplate = `package {{.Package}}
+
+import (
+{{range .StdImports}}	{{.}}
+{{end}}
+	"github.com/eugen-bondarev/omniq"
+{{range .Imports}}	{{.}}
+{{end}})
+
+func samplePtr[T any](v T) *T {
+	return &v
+}
+
+{{range .Jobs}}func Test{{.Name}}RoundTrip(t *testing.T) {
+	want := &{{.Name}}{ {{- .Sample -}} }
+	want.ID = "00000000-0000-0000-0000-000000000001"
+	payload, err := omniq.EncodePayload(want)
+	if err != nil {
+		t.Fatalf("encoding: %v", err)
+	}
+{{range .Aliases}}	if _, err := (&JobFactory{}).Instantiate({{printf "%q" .}}, want.ID, payload); err != nil {
+		t.Errorf("instantiating as {{.}}: %v", err)
+	}
+{{end}}	got, err := (&JobFactory{}).Instantiate(want.Type(), want.ID, payload)
+	if err != nil {
+		t.Fatalf("instantiating: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("the job changed in the round trip:\n got %#v\nwant %#v", got, want)
 	}
-	return j
 }
-`
+
+func Fuzz{{.Name}}(f *testing.F) {
+	seed, err := omniq.EncodePayload(&{{.Name}}{ {{- .Sample -}} })
+	if err != nil {
+		f.Fatalf("encoding: %v", err)
+	}
+	f.Add(seed.Data)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		payload := omniq.Payload{Codec: seed.Codec, Version: seed.Version, Data: data}
+		j, err := New{{.Name}}("fuzz", payload)
+		if err != nil {
+			return
+		}
+		// What decodes must survive another round trip unchanged
+		again, err := omniq.EncodePayload(j)
+		if err != nil {
+			t.Fatalf("encoding a decoded job: %v", err)
+		}
+		j2, err := New{{.Name}}("fuzz", again)
+		if err != nil {
+			t.Fatalf("decoding a re-encoded job: %v", err)
+		}
+		if !reflect.DeepEqual(j, j2) {
+			t.Errorf("the job changed in a second round trip:\n got %#v\nwant %#v", j2, j)
+		}
+	})
+}
+
+{{end}}`
 
 const generateFileDirective = `//go:generate sh -c "cd .. && go run github.com/eugen-bondarev/omniq/cmd/omniq generate jobs"
 
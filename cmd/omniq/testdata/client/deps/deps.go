@@ -0,0 +1,6 @@
+// Package deps holds the dependencies the client fixture's jobs run with.
+package deps
+
+type Services struct {
+	Mailer string
+}
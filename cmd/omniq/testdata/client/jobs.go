@@ -0,0 +1,47 @@
+package client
+
+import (
+	neturl "net/url"
+	"time"
+
+	"github.com/eugen-bondarev/omniq"
+	"github.com/eugen-bondarev/omniq/cmd/omniq/testdata/client/deps"
+)
+
+// Audit is embedded by jobs that record who scheduled them.
+type Audit struct {
+	By string
+}
+
+// SendEmail applies its queue and uniqueness through the client.
+//
+//omniq:queue mail
+//omniq:unique To
+type SendEmail struct {
+	omniq.WithID
+	To      string
+	Subject string `json:"subject,omitempty"`
+	Sent    *time.Time
+	secret  string
+}
+
+func (j *SendEmail) Run(d *deps.Services) {}
+
+// Crawl has fields of an imported package renamed in this file.
+type Crawl struct {
+	omniq.WithID
+	Query   neturl.Values
+	Visited map[string]neturl.Values
+	Cache   []byte `json:"-"`
+}
+
+func (j *Crawl) Run(d *deps.Services) {}
+
+// Cleanup embeds a struct, which its Args embeds too.
+type Cleanup struct {
+	omniq.WithID
+	*Audit
+	Before time.Duration
+}
+
+func (j *Cleanup) Run(d *deps.Services) {}
@@ -0,0 +1,77 @@
+package codec
+
+import (
+	"time"
+
+	"github.com/eugen-bondarev/omniq"
+)
+
+type Level int
+
+type Address struct {
+	Street string
+	City   string
+}
+
+// ScalarJob has only fields the generator encodes itself.
+type ScalarJob struct {
+	omniq.WithID
+	Name    string
+	Count   int64   `json:"count"`
+	Ratio   float32 `json:",omitempty"`
+	Enabled bool
+	Data    []byte
+	Skipped string `json:"-"`
+}
+
+func (j *ScalarJob) Run(d struct{}) {}
+
+// NamedJob has fields of named types, which go through encoding/json.
+type NamedJob struct {
+	omniq.WithID
+	Level   Level
+	Address Address
+	Home    *Address
+}
+
+func (j *NamedJob) Run(d struct{}) {}
+
+type PointerJob struct {
+	omniq.WithID
+	Note  *string
+	Limit *int `json:",omitempty"`
+	Deep  **bool
+}
+
+func (j *PointerJob) Run(d struct{}) {}
+
+type CollectionJob struct {
+	omniq.WithID
+	Tags     []string
+	Matrix   [][]float64
+	Labels   map[string]string `json:",omitempty"`
+	Counts   map[string][]int
+	Optional []*string
+}
+
+func (j *CollectionJob) Run(d struct{}) {}
+
+type TimeJob struct {
+	omniq.WithID
+	At      time.Time
+	Every   time.Duration
+	Retries []time.Time
+	Until   *time.Time `json:",omitempty"`
+}
+
+func (j *TimeJob) Run(d struct{}) {}
+
+// EmbeddedJob embeds a struct besides omniq.WithID, so it keeps using
+// encoding/json.
+type EmbeddedJob struct {
+	omniq.WithID
+	Address
+	Note string
+}
+
+func (j *EmbeddedJob) Run(d struct{}) {}
@@ -0,0 +1,39 @@
+package directives
+
+import "github.com/eugen-bondarev/omniq"
+
+// SendEmail goes through the mail queue and is retried with the default
+// exponential backoff.
+//
+//omniq:type send_email alias=EmailJob
+//omniq:queue mail
+//omniq:retries 3
+//omniq:timeout 30s
+type SendEmail struct {
+	omniq.WithID
+	To string
+}
+
+func (j *SendEmail) Run(d struct{}) {}
+
+// Report is scheduled once per day and customer.
+//
+//omniq:unique Day,Customer
+//omniq:priority -10
+//omniq:retries 5 backoff=linear delay=1m30s
+//omniq:timeout 1h
+type Report struct {
+	omniq.WithID
+	Customer string `json:"customer"`
+	Day      string
+	Format   string
+}
+
+func (j *Report) Run(d struct{}) {}
+
+// Ping has no directives and so no option methods.
+type Ping struct {
+	omniq.WithID
+}
+
+func (j *Ping) Run(d struct{}) {}
@@ -0,0 +1,87 @@
+package lint
+
+import (
+	"time"
+
+	"github.com/eugen-bondarev/omniq"
+)
+
+// CleanJob stores all of its fields.
+type CleanJob struct {
+	omniq.WithID
+	Text string
+	At   time.Time
+}
+
+func (j *CleanJob) Run(d struct{}) {}
+
+type UnexportedJob struct {
+	omniq.WithID
+	Text  string
+	count int
+}
+
+func (j *UnexportedJob) Run(d struct{}) {}
+
+type SkippedJob struct {
+	omniq.WithID
+	Text  string
+	Cache map[string]chan int `json:"-"`
+}
+
+func (j *SkippedJob) Run(d struct{}) {}
+
+type ChanJob struct {
+	omniq.WithID
+	Done chan struct{}
+}
+
+func (j *ChanJob) Run(d struct{}) {}
+
+type FuncJob struct {
+	omniq.WithID
+	Callback func() error
+}
+
+func (j *FuncJob) Run(d struct{}) {}
+
+type InterfaceJob struct {
+	omniq.WithID
+	Value any
+}
+
+func (j *InterfaceJob) Run(d struct{}) {}
+
+type DurationJob struct {
+	omniq.WithID
+	Every time.Duration
+}
+
+func (j *DurationJob) Run(d struct{}) {}
+
+type Node struct {
+	Next *Node
+}
+
+type CycleJob struct {
+	omniq.WithID
+	Head Node
+}
+
+func (j *CycleJob) Run(d struct{}) {}
+
+type Inner struct {
+	Name string
+}
+
+type Other struct {
+	Name string
+}
+
+type ConflictJob struct {
+	omniq.WithID
+	Inner
+	Other
+}
+
+func (j *ConflictJob) Run(d struct{}) {}
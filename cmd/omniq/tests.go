@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// generatedTestFile is where generate --tests writes the tests
+const generatedTestFile = "jobs_gen_test.go"
+
+// maxSampleDepth stops sample values from following recursive types forever
+const maxSampleDepth = 4
+
+// sampler writes Go expressions for non-zero values of the fields of a job,
+// which the generated tests round-trip. Fields it cannot fill, such as
+// interfaces and types that encode themselves, stay zero.
+type sampler struct {
+	qualifier types.Qualifier
+	n         int
+}
+
+// sampleFields writes the fields of a composite literal of the struct, e.g.
+// `Name: "Name", Count: 1`.
+func (s *sampler) sampleFields(st *types.Struct, path string, depth int) string {
+	var fields []string
+	for i := range st.NumFields() {
+		v := st.Field(i)
+		if !v.Exported() || isOmniqType(v.Type(), "WithID") {
+			continue
+		}
+		if tag, _ := reflect.StructTag(st.Tag(i)).Lookup("json"); tag == "-" {
+			continue
+		}
+		if value := s.sample(v.Type(), strings.TrimPrefix(path+"."+v.Name(), "."), depth); value != "" {
+			fields = append(fields, v.Name()+": "+value)
+		}
+	}
+	return strings.Join(fields, ", ")
+}
+
+// sample writes a non-zero value of type t, or nothing if it cannot.
+func (s *sampler) sample(t types.Type, path string, depth int) string {
+	if depth > maxSampleDepth {
+		return ""
+	}
+	if named, ok := types.Unalias(t).(*types.Named); ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "time" && named.Obj().Name() == "Time" {
+		return fmt.Sprintf("%s(2024, %s, 2, 3, 4, 5, 0, %s)", s.qualified("Date", named), s.qualified("January", named), s.qualified("UTC", named))
+	}
+	if isJSONMarshaler(t) {
+		return ""
+	}
+	// Only name the type once a value is certain, as naming it records the
+	// import
+	typeName := func() string { return types.TypeString(t, s.qualifier) }
+
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		s.n++
+		var lit string
+		switch {
+		case u.Info()&types.IsString != 0:
+			lit = strconv.Quote(path)
+		case u.Info()&types.IsBoolean != 0:
+			lit = "true"
+		case u.Info()&types.IsInteger != 0:
+			lit = strconv.Itoa(s.n%100 + 1)
+		case u.Info()&types.IsFloat != 0:
+			lit = strconv.Itoa(s.n%100+1) + ".5"
+		default:
+			return ""
+		}
+		if _, isBasic := types.Unalias(t).(*types.Basic); isBasic {
+			return lit
+		}
+		return typeName() + "(" + lit + ")"
+	case *types.Pointer:
+		elem := s.sample(u.Elem(), path, depth+1)
+		if elem == "" {
+			return ""
+		}
+		if _, ok := u.Elem().Underlying().(*types.Struct); ok {
+			return "&" + elem
+		}
+		return "samplePtr[" + types.TypeString(u.Elem(), s.qualifier) + "](" + elem + ")"
+	case *types.Slice:
+		if elem := s.sample(u.Elem(), path, depth+1); elem != "" {
+			return typeName() + "{" + elem + "}"
+		}
+	case *types.Array:
+		if elem := s.sample(u.Elem(), path, depth+1); elem != "" && u.Len() > 0 {
+			return typeName() + "{" + elem + "}"
+		}
+	case *types.Map:
+		if !isJSONMapKey(u.Key()) {
+			return ""
+		}
+		key, elem := s.sample(u.Key(), path, depth+1), s.sample(u.Elem(), path, depth+1)
+		if key != "" && elem != "" {
+			return typeName() + "{" + key + ": " + elem + "}"
+		}
+	case *types.Struct:
+		return typeName() + "{" + s.sampleFields(u, path, depth+1) + "}"
+	}
+	return ""
+}
+
+// qualified refers to a member of the package of named, like time.UTC.
+func (s *sampler) qualified(name string, named *types.Named) string {
+	return s.qualifier(named.Obj().Pkg()) + "." + name
+}
+
+// generateTests writes the round-trip tests and fuzz targets of the jobs next
+// to the generated code and returns the file name
+func generateTests(jobsDir, packageName string, jobs []JobInfo) (string, error) {
+	importNames := map[string]string{"reflect": "reflect", "testing": "testing", "omniq": omniqPath}
+	stdImports, imports := map[string]bool{"reflect": true, "testing": true}, map[string]bool{}
+	for _, job := range jobs {
+		for path, name := range job.TestImports {
+			if err := addImport(path, name, importNames, stdImports, imports); err != nil {
+				return "", fmt.Errorf("%s: %v", job.Name, err)
+			}
+		}
+	}
+
+	data := GenerationData{
+		Package:    packageName,
+		Jobs:       jobs,
+		StdImports: importSpecs(stdImports),
+		Imports:    importSpecs(imports),
+	}
+	tmpl, err := template.New("tests").Parse(generateTestTemplate)
+	if err != nil {
+		return "", fmt.Errorf("parsing test template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("executing test template: %v", err)
+	}
+	formatted, err := format.Source(buf.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("formatting generated tests: %v", err)
+	}
+
+	testFile := filepath.Join(jobsDir, generatedTestFile)
+	if err := os.WriteFile(testFile, formatted, 0644); err != nil {
+		return "", fmt.Errorf("writing generated tests: %v", err)
+	}
+	return testFile, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// versionsFile records the stored fields of every job at each version, so
+// that generate can tell when they change without a Version bump.
+const versionsFile = "jobs_versions.json"
+
+// jobVersions maps stored type names to versions to the fields stored at that
+// version.
+type jobVersions map[string]map[string][]string
+
+func loadJobVersions(jobsDir string) (jobVersions, error) {
+	content, err := os.ReadFile(filepath.Join(jobsDir, versionsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return jobVersions{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	versions := jobVersions{}
+	if err := json.Unmarshal(content, &versions); err != nil {
+		return nil, fmt.Errorf("reading %s: %v", versionsFile, err)
+	}
+	return versions, nil
+}
+
+func (v jobVersions) save(jobsDir string) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(jobsDir, versionsFile), append(content, '\n'), 0644)
+}
+
+// storedFields describes what a job stores: the key and type of each field
+// and any embedded types, sorted since their order does not matter.
+func storedFields(job JobInfo) []string {
+	fields := []string{}
+	for _, field := range job.Fields {
+		if field.JSONName != "-" {
+			fields = append(fields, field.JSONName+" "+field.Type)
+		}
+	}
+	for _, embedded := range job.Embedded {
+		fields = append(fields, "embedded "+embedded)
+	}
+	slices.Sort(fields)
+	return fields
+}
+
+// check compares the jobs with the recorded versions. It returns a warning for
+// each job whose fields changed while its version stayed the same, and one for
+// each recorded type no job is stored as any more. Versions seen for the first
+// time are recorded; changed ones keep the old record, so the warning stays
+// until the version is bumped. A job renamed with an alias takes over the
+// record of its old name.
+func (v jobVersions) check(jobs []JobInfo) (changed, stale []string) {
+	known := map[string]bool{}
+	for _, job := range jobs {
+		known[job.TypeName] = true
+		for _, alias := range job.Aliases {
+			known[alias] = true
+			if _, ok := v[job.TypeName]; !ok && v[alias] != nil {
+				v[job.TypeName] = v[alias]
+				delete(v, alias)
+			}
+		}
+
+		version := strconv.Itoa(max(job.Version, 1))
+		fields := storedFields(job)
+		recorded, ok := v[job.TypeName][version]
+		if !ok {
+			if v[job.TypeName] == nil {
+				v[job.TypeName] = map[string][]string{}
+			}
+			v[job.TypeName][version] = fields
+			continue
+		}
+		if slices.Equal(recorded, fields) {
+			continue
+		}
+
+		var added, removed []string
+		for _, f := range fields {
+			if !slices.Contains(recorded, f) {
+				added = append(added, f)
+			}
+		}
+		for _, f := range recorded {
+			if !slices.Contains(fields, f) {
+				removed = append(removed, f)
+			}
+		}
+		changed = append(changed, fmt.Sprintf("%s changed since version %s was recorded (added %q, removed %q) but its Version() was not bumped; "+
+			"jobs already stored may not decode. Bump the version, or remove the entry from %s if the change is compatible",
+			job.Name, version, added, removed, versionsFile))
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(v)) {
+		if !known[name] {
+			stale = append(stale, fmt.Sprintf("no job is stored as %q any more, so pending jobs of that type cannot be run; "+
+				"if a job was renamed, add %stype alias=%s to it, otherwise remove the entry from %s", name, directivePrefix, name, versionsFile))
+		}
+	}
+	return changed, stale
+}
+
+// runCheck handles the check command, which reports job changes without a
+// version bump and stored types no job has any more, and fails if there are
+// any. It does not write anything.
+func runCheck(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	buildTags := fs.String("tags", "", "comma-separated build tags the jobs package is loaded with")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		return fmt.Errorf("check command requires a jobs directory argument")
+	}
+
+	jobsDir := fs.Arg(0)
+	jobs, _, _, _, err := parseJobsDirectory(jobsDir, *buildTags)
+	if err != nil {
+		return err
+	}
+	versions, err := loadJobVersions(jobsDir)
+	if err != nil {
+		return err
+	}
+
+	changed, stale := versions.check(jobs)
+	for _, w := range append(changed, stale...) {
+		fmt.Println(w)
+	}
+	var problems []string
+	if len(changed) > 0 {
+		problems = append(problems, fmt.Sprintf("%d job(s) changed without a version bump", len(changed)))
+	}
+	if len(stale) > 0 {
+		problems = append(problems, fmt.Sprintf("%d stored type(s) have no job any more", len(stale)))
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func versionedJob(name string, version int, fields ...string) JobInfo {
+	job := JobInfo{Name: name, TypeName: name, Version: version}
+	for _, f := range fields {
+		job.Fields = append(job.Fields, FieldInfo{Name: f, Type: "string", JSONName: f})
+	}
+	return job
+}
+
+func TestVersionsCheck(t *testing.T) {
+	v := jobVersions{}
+
+	// The first run records every job and warns about none
+	changed, stale := v.check([]JobInfo{versionedJob("Email", 0, "To"), versionedJob("Report", 0, "Day")})
+	if len(changed) > 0 || len(stale) > 0 {
+		t.Fatalf("first run warned %q, %q", changed, stale)
+	}
+	if want := []string{"To string"}; !slices.Equal(v["Email"]["1"], want) {
+		t.Fatalf("recorded Email as %q, want %q", v["Email"]["1"], want)
+	}
+
+	// A new field without a bump is reported, and keeps the old record
+	changed, stale = v.check([]JobInfo{versionedJob("Email", 0, "To", "Subject"), versionedJob("Report", 0, "Day")})
+	if len(changed) != 1 || !strings.Contains(changed[0], "Email changed since version 1") || len(stale) > 0 {
+		t.Fatalf("missing bump warned %q, %q", changed, stale)
+	}
+	if len(v["Email"]["1"]) != 1 {
+		t.Fatalf("missing bump changed the record to %q", v["Email"]["1"])
+	}
+
+	// Bumping the version records the new fields next to the old ones
+	changed, stale = v.check([]JobInfo{versionedJob("Email", 2, "To", "Subject"), versionedJob("Report", 0, "Day")})
+	if len(changed) > 0 || len(stale) > 0 {
+		t.Fatalf("bump warned %q, %q", changed, stale)
+	}
+	if len(v["Email"]) != 2 {
+		t.Fatalf("bump recorded versions %v, want 1 and 2", v["Email"])
+	}
+
+	// A removed type is stale, not changed
+	changed, stale = v.check([]JobInfo{versionedJob("Email", 2, "To", "Subject")})
+	if len(changed) > 0 || len(stale) != 1 || !strings.Contains(stale[0], `"Report"`) {
+		t.Fatalf("removed type warned %q, %q", changed, stale)
+	}
+}
+
+func TestRunCheck(t *testing.T) {
+	dir := copyFixture(t, "lint")
+	if err := runCheck([]string{dir}); err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+
+	v := jobVersions{
+		"CleanJob":   {"1": {"Text string"}},
+		"RemovedJob": {"1": {"Text string"}},
+	}
+	if err := v.save(dir); err != nil {
+		t.Fatal(err)
+	}
+	err := runCheck([]string{dir})
+	if err == nil || err.Error() != "1 job(s) changed without a version bump, 1 stored type(s) have no job any more" {
+		t.Errorf("got %v, want both counts", err)
+	}
+}
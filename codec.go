@@ -0,0 +1,190 @@
+package omniq
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrUnknownCodec = errors.New("omniq: unknown codec")
+
+// Codec encodes job state for storage. Its name is stored with every job, so
+// jobs are decoded with the codec that encoded them even after the storage or
+// the job type switched to another one.
+type Codec interface {
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// Encoded is implemented by jobs that are stored with a codec other than the
+// one their storage uses.
+type Encoded interface {
+	Codec() Codec
+}
+
+var (
+	// JSONCodec is the default. Only JSON payloads can be matched by
+	// JobFilter.Payload.
+	JSONCodec Codec = jsonCodec{}
+	GobCodec  Codec = gobCodec{}
+)
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{}
+)
+
+func init() {
+	for _, c := range []Codec{JSONCodec, GobCodec, MsgPackCodec, ProtobufCodec} {
+		RegisterCodec(c)
+	}
+}
+
+// RegisterCodec makes a codec available for decoding under its name. The
+// built-in codecs are registered already; custom ones have to be registered
+// before jobs encoded with them are loaded.
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[c.Name()] = c
+}
+
+// LookupCodec returns the registered codec of that name. Jobs stored before
+// codecs existed have no codec name and are JSON.
+func LookupCodec(name string) (Codec, error) {
+	if name == "" {
+		return JSONCodec, nil
+	}
+
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCodec, name)
+	}
+	return c, nil
+}
+
+// Payload is the encoded state of a job, the name of the codec that encoded
+// it and the job's version at the time, see Versioned.
+type Payload struct {
+	Codec   string
+	Version int
+	Data    []byte
+}
+
+// version treats payloads stored before versioning as version 1.
+func (p Payload) version() int {
+	return max(p.Version, 1)
+}
+
+// IsJSON reports whether the payload was encoded with JSONCodec.
+func (p Payload) IsJSON() bool {
+	return p.Codec == "" || p.Codec == JSONCodec.Name()
+}
+
+// Decode decodes the payload into v with the codec that encoded it. JSON
+// payloads were validated when they were encoded, so they are handed straight
+// to the UnmarshalJSON of types that have one.
+func (p Payload) Decode(v any) error {
+	if u, ok := v.(json.Unmarshaler); ok && p.IsJSON() {
+		return u.UnmarshalJSON(p.Data)
+	}
+
+	c, err := LookupCodec(p.Codec)
+	if err != nil {
+		return err
+	}
+	return c.Unmarshal(p.Data, v)
+}
+
+// EncodePayload encodes the job like a storage without a codec of its own
+// does, e.g. to test that a job survives being stored.
+func EncodePayload(j any) (Payload, error) {
+	return encodeJob(j, nil)
+}
+
+// codecStorage is implemented by the storages that take a codec, so the
+// scheduler can encode jobs the way they do.
+type codecStorage interface {
+	jobCodec() Codec
+}
+
+// encodeJob encodes the job with its own codec if it is Encoded, and with
+// fallback otherwise. A nil fallback means JSONCodec.
+func encodeJob(j any, fallback Codec) (Payload, error) {
+	c := fallback
+	if e, ok := j.(Encoded); ok {
+		c = e.Codec()
+	}
+	if c == nil {
+		c = JSONCodec
+	}
+
+	data, err := c.Marshal(j)
+	if err != nil {
+		return Payload{}, err
+	}
+	return Payload{Codec: c.Name(), Version: jobVersion(j), Data: data}, nil
+}
+
+// storedPayload is how storages that keep jobs as JSON documents hold a
+// payload: JSON inline, where it stays readable, anything else base64-encoded
+// in Data. Documents written before codecs existed only have State. Version 1
+// is left out, so documents of unversioned jobs keep their shape.
+type storedPayload struct {
+	State   json.RawMessage `json:",omitempty"`
+	Codec   string          `json:",omitempty"`
+	Version int             `json:",omitempty"`
+	Data    []byte          `json:",omitempty"`
+}
+
+func newStoredPayload(p Payload) storedPayload {
+	var version int
+	if p.version() > 1 {
+		version = p.Version
+	}
+	if p.IsJSON() {
+		return storedPayload{State: p.Data, Version: version}
+	}
+	return storedPayload{Codec: p.Codec, Version: version, Data: p.Data}
+}
+
+func (s storedPayload) payload() Payload {
+	if s.Codec == "" {
+		return Payload{Codec: JSONCodec.Name(), Version: s.version(), Data: s.State}
+	}
+	return Payload{Codec: s.Codec, Version: s.version(), Data: s.Data}
+}
+
+func (s storedPayload) version() int {
+	return max(s.Version, 1)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                       { return "json" }
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// gobCodec encodes each job as a self-describing gob stream. Interface fields
+// need their concrete types registered with gob.Register.
+type gobCodec struct{}
+
+func (gobCodec) Name() string { return "gob" }
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
@@ -0,0 +1,13 @@
+package omniq
+
+import "github.com/vmihailenco/msgpack/v5"
+
+// MsgPackCodec encodes jobs as MessagePack. Fields are keyed by name, or by
+// the msgpack struct tag.
+var MsgPackCodec Codec = msgPackCodec{}
+
+type msgPackCodec struct{}
+
+func (msgPackCodec) Name() string                       { return "msgpack" }
+func (msgPackCodec) Marshal(v any) ([]byte, error)      { return msgpack.Marshal(v) }
+func (msgPackCodec) Unmarshal(data []byte, v any) error { return msgpack.Unmarshal(data, v) }
@@ -0,0 +1,48 @@
+package omniq
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ProtobufCodec encodes jobs that are protobuf messages themselves or that
+// implement ProtoJob.
+var ProtobufCodec Codec = protobufCodec{}
+
+// ProtoJob is implemented by jobs that keep their state in a protobuf message.
+// Proto returns that message; decoding fills in the message it returns, so it
+// has to allocate one when the field is nil.
+type ProtoJob interface {
+	Proto() proto.Message
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string { return "protobuf" }
+
+func (protobufCodec) Marshal(v any) ([]byte, error) {
+	m, err := protoMessage(v)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(m)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v any) error {
+	m, err := protoMessage(v)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(data, m)
+}
+
+func protoMessage(v any) (proto.Message, error) {
+	switch v := v.(type) {
+	case proto.Message:
+		return v, nil
+	case ProtoJob:
+		return v.Proto(), nil
+	}
+	return nil, fmt.Errorf("omniq: %T is neither a proto.Message nor a ProtoJob", v)
+}
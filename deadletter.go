@@ -0,0 +1,148 @@
+package omniq
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrDeadLetterNotSupported = errors.New("omniq: storage does not keep dead letters")
+
+// DeadLetter is a job that was taken out of the queue because it cannot be run.
+// If the storage could not even read the job's record, Payload holds the record
+// as it was stored, with the codec name "raw", and Type is empty.
+type DeadLetter struct {
+	ID       JobID
+	Type     string
+	Queue    string
+	Payload  Payload
+	Attempts int
+	Error    string
+	FailedAt time.Time
+}
+
+// deadLetterEntry is how the document storages keep a DeadLetter.
+type deadLetterEntry struct {
+	ID    JobID
+	Type  string
+	Queue string `json:",omitempty"`
+	storedPayload
+	Attempts int `json:",omitempty"`
+	Error    string
+	FailedAt time.Time
+}
+
+func (e deadLetterEntry) deadLetter() DeadLetter {
+	return DeadLetter{ID: e.ID, Type: e.Type, Queue: e.Queue, Payload: e.payload(), Attempts: e.Attempts, Error: e.Error, FailedAt: e.FailedAt}
+}
+
+// rawRecordCodec names the payload of a dead letter whose record did not parse.
+const rawRecordCodec = "raw"
+
+// corruptRecordError is returned for a stored record that does not parse.
+type corruptRecordError struct {
+	record []byte
+	err    error
+}
+
+func (e *corruptRecordError) Error() string {
+	return "omniq: stored job does not parse: " + e.err.Error()
+}
+
+func (e *corruptRecordError) Unwrap() error { return e.err }
+
+func (e *corruptRecordError) payload() Payload {
+	return Payload{Codec: rawRecordCodec, Data: e.record}
+}
+
+// corruptDeadLetter keeps a record that does not parse as it was stored.
+func corruptDeadLetter(id JobID, record []byte, attempts int, reason string) deadLetterEntry {
+	return deadLetterEntry{ID: id, Queue: DefaultQueue, storedPayload: storedPayload{Codec: rawRecordCodec, Data: record}, Attempts: attempts, Error: reason, FailedAt: time.Now()}
+}
+
+// DeadLetters returns the jobs the storage set aside, oldest first.
+func (s *Scheduler[T]) DeadLetters() ([]DeadLetter, error) {
+	storage, ok := s.storage.(DeadLetterStorage)
+	if !ok {
+		return nil, ErrDeadLetterNotSupported
+	}
+	return storage.DeadLetters()
+}
+
+// deadLetter sets aside a job the factory could not instantiate. Storages
+// without dead letters keep it claimed, so it comes back once the lease
+// expires, e.g. after a deploy that knows its type.
+func (s *Scheduler[T]) deadLetter(j *PoisonJob[T]) {
+	storage, ok := s.storage.(DeadLetterStorage)
+	if !ok {
+		log.Printf("Cannot run job %s (%s), retrying after the lease: %v", j.ID, j.TypeName, j.Err)
+		return
+	}
+	if err := storage.DeadLetter(j.ID, j.Err.Error()); err != nil {
+		log.Println("Error dead-lettering job:", err)
+		return
+	}
+	log.Printf("Moved job %s (%s) to the dead letters: %v", j.ID, j.TypeName, j.Err)
+}
+
+// deadLetterFile keeps dead letters as JSON lines next to a file-based storage.
+type deadLetterFile struct {
+	mu   sync.Mutex
+	name string
+}
+
+func newDeadLetterFile(name string) *deadLetterFile {
+	return &deadLetterFile{name: name}
+}
+
+func (d *deadLetterFile) add(e deadLetterEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	f, err := os.OpenFile(d.name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// list skips lines that do not parse, such as an entry torn by a crash.
+func (d *deadLetterFile) list() ([]DeadLetter, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	content, err := os.ReadFile(d.name)
+	if errors.Is(err, os.ErrNotExist) {
+		return []DeadLetter{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	letters := []DeadLetter{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+	for scanner.Scan() {
+		var e deadLetterEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err == nil {
+			letters = append(letters, e.deadLetter())
+		}
+	}
+	sort.SliceStable(letters, func(a, b int) bool { return letters[a].FailedAt.Before(letters[b].FailedAt) })
+	return letters, scanner.Err()
+}
@@ -26,6 +26,9 @@ func (j *Job2) Run(d deps.Dependencies) {
 }
 
 // EmailJob demonstrates dependency injection for SMTP service
+//
+//omniq:retries 3 backoff=exp
+//omniq:timeout 30s
 type EmailJob struct {
 	omniq.WithID
 	To      string
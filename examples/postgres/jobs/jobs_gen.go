@@ -1,7 +1,13 @@
 package jobs
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	"github.com/eugen-bondarev/omniq"
+	"github.com/eugen-bondarev/omniq/genjson"
+
 	"github.com/eugen-bondarev/omniq/examples/postgres/deps"
 )
 
@@ -30,49 +36,216 @@ func (j *EmailJob) GetIDContainer() *omniq.WithID {
 	return &j.WithID
 }
 
-func NewJob1(id omniq.JobID, data map[string]any) *Job1 {
-	return &Job1{
-		WithID: omniq.WithID{
-			ID: id,
-		},
-		MyData: data["MyData"].(string),
+func (j *EmailJob) Retries() omniq.RetryPolicy {
+	return omniq.RetryPolicy{Retries: 3, Backoff: omniq.BackoffExponential}
+}
+
+func (j *EmailJob) Timeout() time.Duration {
+	return 30 * time.Second
+}
+
+func (j *Job1) MarshalJSON() ([]byte, error) {
+	b := make([]byte, 0, 18+len(j.ID)+len(j.MyData))
+	b = append(b, '{')
+	b = genjson.Key(b, `"ID":`)
+	b = genjson.AppendString(b, string(j.ID))
+	b = genjson.Key(b, `"MyData":`)
+	b = genjson.AppendString(b, j.MyData)
+	return append(b, '}'), nil
+}
+
+func (j *Job1) UnmarshalJSON(data []byte) error {
+	d := genjson.NewDecoder(data)
+	err := d.Fields(func(key []byte) error {
+		switch genjson.MatchKey(key, "ID", "MyData") {
+		case "ID":
+			var id string
+			if err := d.String(&id); err != nil {
+				return err
+			}
+			j.ID = omniq.JobID(id)
+			return nil
+		case "MyData":
+			return d.String(&j.MyData)
+		default:
+			return d.Skip()
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return d.End()
+}
+
+func (j *Job2) MarshalJSON() ([]byte, error) {
+	b := make([]byte, 0, 34+len(j.ID))
+	var err error
+	b = append(b, '{')
+	b = genjson.Key(b, `"ID":`)
+	b = genjson.AppendString(b, string(j.ID))
+	b = genjson.Key(b, `"Answer":`)
+	if b, err = genjson.AppendFloat(b, float64(j.Answer), 64); err != nil {
+		return nil, err
+	}
+	return append(b, '}'), nil
+}
+
+func (j *Job2) UnmarshalJSON(data []byte) error {
+	d := genjson.NewDecoder(data)
+	err := d.Fields(func(key []byte) error {
+		switch genjson.MatchKey(key, "ID", "Answer") {
+		case "ID":
+			var id string
+			if err := d.String(&id); err != nil {
+				return err
+			}
+			j.ID = omniq.JobID(id)
+			return nil
+		case "Answer":
+			return genjson.Float(d, &j.Answer)
+		default:
+			return d.Skip()
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return d.End()
+}
+
+func (j *EmailJob) MarshalJSON() ([]byte, error) {
+	b := make([]byte, 0, 33+len(j.ID)+len(j.To)+len(j.Subject)+len(j.Body))
+	b = append(b, '{')
+	b = genjson.Key(b, `"ID":`)
+	b = genjson.AppendString(b, string(j.ID))
+	b = genjson.Key(b, `"To":`)
+	b = genjson.AppendString(b, j.To)
+	b = genjson.Key(b, `"Subject":`)
+	b = genjson.AppendString(b, j.Subject)
+	b = genjson.Key(b, `"Body":`)
+	b = genjson.AppendString(b, j.Body)
+	return append(b, '}'), nil
+}
+
+func (j *EmailJob) UnmarshalJSON(data []byte) error {
+	d := genjson.NewDecoder(data)
+	err := d.Fields(func(key []byte) error {
+		switch genjson.MatchKey(key, "ID", "To", "Subject", "Body") {
+		case "ID":
+			var id string
+			if err := d.String(&id); err != nil {
+				return err
+			}
+			j.ID = omniq.JobID(id)
+			return nil
+		case "To":
+			return d.String(&j.To)
+		case "Subject":
+			return d.String(&j.Subject)
+		case "Body":
+			return d.String(&j.Body)
+		default:
+			return d.Skip()
+		}
+	})
+	if err != nil {
+		return err
 	}
+	return d.End()
 }
 
-func NewJob2(id omniq.JobID, data map[string]any) *Job2 {
-	return &Job2{
-		WithID: omniq.WithID{
-			ID: id,
-		},
-		Answer: data["Answer"].(float64),
+func NewJob1(id omniq.JobID, payload omniq.Payload) (*Job1, error) {
+	var j Job1
+	if err := payload.Decode(&j); err != nil {
+		return nil, fmt.Errorf("decoding Job1 %s: %w", id, err)
 	}
+	j.ID = id
+	return &j, nil
 }
 
-func NewEmailJob(id omniq.JobID, data map[string]any) *EmailJob {
-	return &EmailJob{
-		WithID: omniq.WithID{
-			ID: id,
-		},
-		To:      data["To"].(string),
-		Subject: data["Subject"].(string),
-		Body:    data["Body"].(string),
+func NewJob2(id omniq.JobID, payload omniq.Payload) (*Job2, error) {
+	var j Job2
+	if err := payload.Decode(&j); err != nil {
+		return nil, fmt.Errorf("decoding Job2 %s: %w", id, err)
 	}
+	j.ID = id
+	return &j, nil
+}
+
+func NewEmailJob(id omniq.JobID, payload omniq.Payload) (*EmailJob, error) {
+	var j EmailJob
+	if err := payload.Decode(&j); err != nil {
+		return nil, fmt.Errorf("decoding EmailJob %s: %w", id, err)
+	}
+	j.ID = id
+	return &j, nil
 }
 
 // Registry
 type JobFactory struct{}
 
-func (f *JobFactory) Instantiate(t string, id omniq.JobID, data map[string]any) omniq.Job[deps.Dependencies] {
-	var j omniq.Job[deps.Dependencies]
+func (f *JobFactory) Instantiate(t string, id omniq.JobID, payload omniq.Payload) (omniq.Job[deps.Dependencies], error) {
 	switch t {
 	case "Job1":
-		j = NewJob1(id, data)
+		j, err := NewJob1(id, payload)
+		if err != nil {
+			return nil, err
+		}
+		return j, nil
 	case "Job2":
-		j = NewJob2(id, data)
+		j, err := NewJob2(id, payload)
+		if err != nil {
+			return nil, err
+		}
+		return j, nil
 	case "EmailJob":
-		j = NewEmailJob(id, data)
-	default:
-		panic("Unknown job type: " + t)
+		j, err := NewEmailJob(id, payload)
+		if err != nil {
+			return nil, err
+		}
+		return j, nil
 	}
-	return j
+	return nil, fmt.Errorf("%w: %q", omniq.ErrUnknownJobType, t)
+}
+
+// Client schedules the jobs with typed arguments. The options the jobs
+// declare, such as their queue, priority and uniqueness, apply as usual.
+type Client struct {
+	scheduler *omniq.Scheduler[deps.Dependencies]
+}
+
+func NewClient(scheduler *omniq.Scheduler[deps.Dependencies]) *Client {
+	return &Client{scheduler: scheduler}
+}
+
+// Job1Args holds the fields of Job1.
+type Job1Args struct {
+	MyData string
+}
+
+// Job1 schedules Job1, due right away unless an option says otherwise.
+func (c *Client) Job1(ctx context.Context, args Job1Args, opts ...omniq.ScheduleOption) (omniq.JobID, error) {
+	return c.scheduler.Schedule(ctx, &Job1{MyData: args.MyData}, opts...)
+}
+
+// Job2Args holds the fields of Job2.
+type Job2Args struct {
+	Answer float64
+}
+
+// Job2 schedules Job2, due right away unless an option says otherwise.
+func (c *Client) Job2(ctx context.Context, args Job2Args, opts ...omniq.ScheduleOption) (omniq.JobID, error) {
+	return c.scheduler.Schedule(ctx, &Job2{Answer: args.Answer}, opts...)
+}
+
+// EmailJobArgs holds the fields of EmailJob.
+type EmailJobArgs struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// EmailJob schedules EmailJob, due right away unless an option says otherwise.
+func (c *Client) EmailJob(ctx context.Context, args EmailJobArgs, opts ...omniq.ScheduleOption) (omniq.JobID, error) {
+	return c.scheduler.Schedule(ctx, &EmailJob{To: args.To, Subject: args.Subject, Body: args.Body}, opts...)
 }
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"time"
+
+	"github.com/eugen-bondarev/omniq"
+	"github.com/lib/pq"
+)
+
+// pqListener adapts pq.Listener to omniq.PGListener.
+type pqListener struct {
+	listener      *pq.Listener
+	notifications chan omniq.PGNotification
+}
+
+func newPQListener(connStr string) *pqListener {
+	l := &pqListener{notifications: make(chan omniq.PGNotification, 64)}
+	l.listener = pq.NewListener(connStr, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		switch ev {
+		case pq.ListenerEventDisconnected:
+			l.notifications <- omniq.PGNotification{Kind: omniq.PGDisconnected}
+		case pq.ListenerEventReconnected:
+			l.notifications <- omniq.PGNotification{Kind: omniq.PGReconnected}
+		}
+	})
+
+	go func() {
+		for n := range l.listener.Notify {
+			// pq sends nil after reconnecting, which the event callback already reported
+			if n != nil {
+				l.notifications <- omniq.PGNotification{Kind: omniq.PGNotify, Payload: n.Extra}
+			}
+		}
+	}()
+	return l
+}
+
+func (l *pqListener) Listen(channel string) error {
+	return l.listener.Listen(channel)
+}
+
+func (l *pqListener) Notifications() <-chan omniq.PGNotification {
+	return l.notifications
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
@@ -50,7 +51,9 @@ func init() {
 	// jsonStorage := omniq.NewJSONStorage("jobs.json", factory)
 	// s = omniq.NewWithDependencies(jsonStorage)
 
-	pgStorage, err := omniq.NewPGStorage(db, factory, omniq.WithTableName("lorem_ipsum"))
+	listener := newPQListener(pgConfig.getConnectionString())
+
+	pgStorage, err := omniq.NewPGStorage(db, factory, omniq.WithTableName("lorem_ipsum"), omniq.WithListener(listener))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -64,16 +67,19 @@ func close() {
 func schedule() {
 	j1 := &jobs.Job1{MyData: "Hello"}
 	j2 := &jobs.Job2{Answer: 42}
-	emailJob := &jobs.EmailJob{
-		To:      "user@example.com",
-		Subject: "Welcome!",
-		Body:    "<h1>Hello from the job scheduler!</h1>",
-	}
 
 	scheduler.ScheduleIn(j1, 2*time.Second)
 	scheduler.ScheduleIn(j2, 1*time.Second)
-	scheduler.ScheduleIn(emailJob, 3*time.Second)
 
+	client := jobs.NewClient(scheduler)
+	_, err := client.EmailJob(context.Background(), jobs.EmailJobArgs{
+		To:      "user@example.com",
+		Subject: "Welcome!",
+		Body:    "<h1>Hello from the job scheduler!</h1>",
+	}, omniq.In(3*time.Second))
+	if err != nil {
+		log.Println("Error scheduling email:", err)
+	}
 }
 
 func listen() {
@@ -1,5 +1,45 @@
 package omniq
 
+import "errors"
+
+var ErrUnknownJobType = errors.New("omniq: unknown job type")
+
+// JobFactory turns a stored job back into a Job. The payload carries the name
+// of the codec that encoded it; Payload.Decode picks that codec. Instantiate
+// fails with ErrUnknownJobType for types it does not know.
 type JobFactory[T any] interface {
-	Instantiate(t string, id JobID, data string) Job[T]
+	Instantiate(t string, id JobID, payload Payload) (Job[T], error)
+}
+
+// PoisonJob stands in for a stored job the factory could not instantiate,
+// because its type is unknown or its payload does not decode. The scheduler
+// never runs it; it moves it to the dead letters instead.
+type PoisonJob[T any] struct {
+	WithID
+	TypeName string
+	Payload  Payload
+	Err      error
+}
+
+func (j *PoisonJob[T]) Run(T)                   {}
+func (j *PoisonJob[T]) Type() string            { return j.TypeName }
+func (j *PoisonJob[T]) GetIDContainer() *WithID { return &j.WithID }
+
+// Instantiate calls the factory and returns a *PoisonJob carrying the error if
+// it fails. Storages use it in GetDue, so one bad job does not hold up the
+// others.
+func Instantiate[T any](factory JobFactory[T], t string, id JobID, payload Payload) Job[T] {
+	j, err := factory.Instantiate(t, id, payload)
+	if err != nil {
+		return &PoisonJob[T]{WithID: WithID{ID: id}, TypeName: t, Payload: payload, Err: err}
+	}
+	return j
+}
+
+// instantiateClaimed is Instantiate for a job GetDue hands out for the given
+// time.
+func instantiateClaimed[T any](factory JobFactory[T], t string, id JobID, payload Payload, attempts int) Job[T] {
+	j := Instantiate(factory, t, id, payload)
+	j.GetIDContainer().SetAttempts(attempts)
+	return j
 }
@@ -0,0 +1,161 @@
+package omniq
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	fsBlobLockSuffix = ".lock"
+	fsBlobTempSuffix = ".tmp"
+	// fsBlobStaleLock is how old a lock file may get before it is considered
+	// abandoned by a crashed process.
+	fsBlobStaleLock = 10 * time.Second
+)
+
+// fsBlobStore implements BlobStore on a local directory. Generations are
+// content hashes, like S3 ETags, and conditional writes are serialized with
+// lock files so several processes may share the directory.
+type fsBlobStore struct {
+	root string
+}
+
+func NewFSBlobStore(root string) (*fsBlobStore, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &fsBlobStore{root: root}, nil
+}
+
+// path maps the key to a file under the root. Keys that are absolute or
+// contain ".." are rejected, so no key reaches outside of it.
+func (s *fsBlobStore) path(key string) (string, error) {
+	name := filepath.FromSlash(key)
+	if !filepath.IsLocal(name) || slices.Contains(strings.Split(key, "/"), "..") {
+		return "", fmt.Errorf("%w: %q", ErrBlobInvalidKey, key)
+	}
+	return filepath.Join(s.root, name), nil
+}
+
+func (s *fsBlobStore) generation(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *fsBlobStore) lock(path string) (func(), error) {
+	lockPath := path + fsBlobLockSuffix
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > fsBlobStaleLock {
+			os.Remove(lockPath)
+			continue
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (s *fsBlobStore) Get(key string) ([]byte, string, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "", ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return data, s.generation(data), nil
+}
+
+func (s *fsBlobStore) Put(key string, data []byte, ifGeneration string) (string, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+
+	unlock, err := s.lock(path)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	current, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		if ifGeneration != "" {
+			return "", ErrBlobPreconditionFailed
+		}
+	case err != nil:
+		return "", err
+	default:
+		if ifGeneration != s.generation(current) {
+			return "", ErrBlobPreconditionFailed
+		}
+	}
+
+	tmp := path + "." + uuid.New().String() + fsBlobTempSuffix
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return s.generation(data), nil
+}
+
+func (s *fsBlobStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *fsBlobStore) List(prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(s.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, fsBlobLockSuffix) || strings.HasSuffix(path, fsBlobTempSuffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	return keys, err
+}
@@ -0,0 +1,264 @@
+package genjson_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/eugen-bondarev/omniq"
+	"github.com/eugen-bondarev/omniq/genjson"
+)
+
+type Attachment struct {
+	Name string
+	Size int64
+}
+
+type BenchJob struct {
+	omniq.WithID
+	To          string            `json:"to"`
+	Cc          []string          `json:"cc,omitempty"`
+	Subject     string            `json:"subject"`
+	Body        string            `json:"body"`
+	Attempt     int               `json:"attempt"`
+	Priority    uint8             `json:"priority"`
+	Score       float64           `json:"score"`
+	Urgent      bool              `json:"urgent"`
+	SendAt      time.Time         `json:"send_at"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Attachments []*Attachment     `json:"attachments"`
+}
+
+// reflectBenchJob has the fields of BenchJob but not its methods, so
+// encoding/json handles it by reflection.
+type reflectBenchJob BenchJob
+
+// The methods below are what `omniq generate` emits for BenchJob.
+
+func (j *BenchJob) MarshalJSON() ([]byte, error) {
+	b := make([]byte, 0, 246+len(j.ID)+len(j.To)+len(j.Subject)+len(j.Body))
+	var err error
+	b = append(b, '{')
+	b = genjson.Key(b, `"ID":`)
+	b = genjson.AppendString(b, string(j.ID))
+	b = genjson.Key(b, `"to":`)
+	b = genjson.AppendString(b, j.To)
+	if len(j.Cc) != 0 {
+		b = genjson.Key(b, `"cc":`)
+		if j.Cc == nil {
+			b = append(b, "null"...)
+		} else {
+			b = append(b, '[')
+			for i1, e2 := range j.Cc {
+				if i1 > 0 {
+					b = append(b, ',')
+				}
+				b = genjson.AppendString(b, e2)
+			}
+			b = append(b, ']')
+		}
+	}
+	b = genjson.Key(b, `"subject":`)
+	b = genjson.AppendString(b, j.Subject)
+	b = genjson.Key(b, `"body":`)
+	b = genjson.AppendString(b, j.Body)
+	b = genjson.Key(b, `"attempt":`)
+	b = genjson.AppendInt(b, int64(j.Attempt))
+	b = genjson.Key(b, `"priority":`)
+	b = genjson.AppendUint(b, uint64(j.Priority))
+	b = genjson.Key(b, `"score":`)
+	if b, err = genjson.AppendFloat(b, float64(j.Score), 64); err != nil {
+		return nil, err
+	}
+	b = genjson.Key(b, `"urgent":`)
+	b = genjson.AppendBool(b, j.Urgent)
+	b = genjson.Key(b, `"send_at":`)
+	if b, err = genjson.AppendTime(b, j.SendAt); err != nil {
+		return nil, err
+	}
+	if len(j.Headers) != 0 {
+		b = genjson.Key(b, `"headers":`)
+		if j.Headers == nil {
+			b = append(b, "null"...)
+		} else {
+			b = append(b, '{')
+			for _, k3 := range genjson.SortedKeys(j.Headers) {
+				b = genjson.Key(b, ``)
+				b = genjson.AppendString(b, k3)
+				b = append(b, ':')
+				b = genjson.AppendString(b, j.Headers[k3])
+			}
+			b = append(b, '}')
+		}
+	}
+	b = genjson.Key(b, `"attachments":`)
+	if b, err = genjson.AppendValue(b, j.Attachments); err != nil {
+		return nil, err
+	}
+	return append(b, '}'), nil
+}
+
+func (j *BenchJob) UnmarshalJSON(data []byte) error {
+	d := genjson.NewDecoder(data)
+	err := d.Fields(func(key []byte) error {
+		switch genjson.MatchKey(key, "ID", "to", "cc", "subject", "body", "attempt", "priority", "score", "urgent", "send_at", "headers", "attachments") {
+		case "ID":
+			var id string
+			if err := d.String(&id); err != nil {
+				return err
+			}
+			j.ID = omniq.JobID(id)
+			return nil
+		case "to":
+			return d.String(&j.To)
+		case "cc":
+			if d.Null() {
+				j.Cc = nil
+			} else {
+				s1 := make([]string, 0)
+				if err := d.Array(func() error {
+					var e2 string
+					if err := d.String(&e2); err != nil {
+						return err
+					}
+					s1 = append(s1, e2)
+					return nil
+				}); err != nil {
+					return err
+				}
+				j.Cc = s1
+			}
+			return nil
+		case "subject":
+			return d.String(&j.Subject)
+		case "body":
+			return d.String(&j.Body)
+		case "attempt":
+			return genjson.Int(d, &j.Attempt)
+		case "priority":
+			return genjson.Uint(d, &j.Priority)
+		case "score":
+			return genjson.Float(d, &j.Score)
+		case "urgent":
+			return d.Bool(&j.Urgent)
+		case "send_at":
+			return d.Time(&j.SendAt)
+		case "headers":
+			if d.Null() {
+				j.Headers = nil
+			} else {
+				m3 := make(map[string]string)
+				if err := d.Object(func(k4 string) error {
+					var e5 string
+					if err := d.String(&e5); err != nil {
+						return err
+					}
+					m3[k4] = e5
+					return nil
+				}); err != nil {
+					return err
+				}
+				j.Headers = m3
+			}
+			return nil
+		case "attachments":
+			return d.Value(&j.Attachments)
+		default:
+			return d.Skip()
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return d.End()
+}
+
+func newBenchJob() *BenchJob {
+	return &BenchJob{
+		WithID:   omniq.WithID{ID: "3f2b8c1e-9d4a-4f6b-8e2a-1c5d7f9b0a3e"},
+		To:       "someone@example.com",
+		Cc:       []string{"first@example.com", "second@example.com"},
+		Subject:  "Your order <#1234> has shipped",
+		Body:     "Hello,\n\nyour order is on its way & should arrive on Friday.\n\nThanks!",
+		Attempt:  2,
+		Priority: 5,
+		Score:    0.875,
+		Urgent:   true,
+		SendAt:   time.Date(2024, 5, 17, 9, 30, 0, 0, time.UTC),
+		Headers:  map[string]string{"X-Campaign": "spring", "Reply-To": "support@example.com"},
+		Attachments: []*Attachment{
+			{Name: "invoice.pdf", Size: 48213},
+		},
+	}
+}
+
+func TestBenchJobRoundTrip(t *testing.T) {
+	job := newBenchJob()
+	data, err := json.Marshal(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := json.Marshal((*reflectBenchJob)(job))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(want) {
+		t.Fatalf("generated MarshalJSON wrote\n%s\nencoding/json writes\n%s", data, want)
+	}
+
+	var got BenchJob
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&got, job) {
+		t.Errorf("round trip gave %+v, want %+v", got, *job)
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	job := newBenchJob()
+	b.Run("Generated", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := job.MarshalJSON(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Reflect", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := json.Marshal((*reflectBenchJob)(job)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	data, err := newBenchJob().MarshalJSON()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("Generated", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+		for b.Loop() {
+			var job BenchJob
+			if err := job.UnmarshalJSON(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Reflect", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+		for b.Loop() {
+			var job reflectBenchJob
+			if err := json.Unmarshal(data, &job); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,516 @@
+package genjson
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+	"unsafe"
+)
+
+var ErrSyntax = errors.New("genjson: invalid JSON")
+
+// maxDepth is how deeply objects and arrays may nest, the limit encoding/json
+// has too. Decoding recurses, so deeper input would exhaust the stack.
+const maxDepth = 10000
+
+// Decoder reads a single JSON value. Like encoding/json, it leaves values
+// untouched when it reads null into them and ignores object keys nobody asks for.
+type Decoder struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+func NewDecoder(data []byte) *Decoder {
+	return &Decoder{data: data}
+}
+
+func (d *Decoder) syntaxError(what string) error {
+	return fmt.Errorf("%w: %s at offset %d", ErrSyntax, what, d.pos)
+}
+
+func (d *Decoder) skipSpace() {
+	for d.pos < len(d.data) {
+		switch d.data[d.pos] {
+		case ' ', '\t', '\n', '\r':
+			d.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (d *Decoder) peek() byte {
+	d.skipSpace()
+	if d.pos >= len(d.data) {
+		return 0
+	}
+	return d.data[d.pos]
+}
+
+func (d *Decoder) literal(lit string) bool {
+	if len(d.data)-d.pos >= len(lit) && string(d.data[d.pos:d.pos+len(lit)]) == lit {
+		d.pos += len(lit)
+		return true
+	}
+	return false
+}
+
+// Null consumes a null and reports whether there was one.
+func (d *Decoder) Null() bool {
+	return d.peek() == 'n' && d.literal("null")
+}
+
+// End checks that nothing but whitespace follows the value.
+func (d *Decoder) End() error {
+	d.skipSpace()
+	if d.pos < len(d.data) {
+		return d.syntaxError("unexpected data after value")
+	}
+	return nil
+}
+
+// Object calls fn for each key of an object, with the decoder positioned at
+// the value, which fn must consume.
+func (d *Decoder) Object(fn func(key string) error) error {
+	return d.object(func(key []byte) error {
+		return fn(string(key))
+	})
+}
+
+// Fields is Object for structs, whose keys are only matched against field
+// names. The key is only valid until fn returns.
+func (d *Decoder) Fields(fn func(key []byte) error) error {
+	return d.object(fn)
+}
+
+// enter opens an object or array, failing if that nests them too deeply. The
+// caller calls leave once it is closed.
+func (d *Decoder) enter() error {
+	d.depth++
+	if d.depth > maxDepth {
+		return d.syntaxError("exceeded max depth")
+	}
+	d.pos++
+	return nil
+}
+
+func (d *Decoder) leave() {
+	d.depth--
+}
+
+func (d *Decoder) object(fn func(key []byte) error) error {
+	if d.Null() {
+		return nil
+	}
+	if d.peek() != '{' {
+		return d.typeError("object")
+	}
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+	if d.peek() == '}' {
+		d.pos++
+		return nil
+	}
+	for {
+		if d.peek() != '"' {
+			return d.syntaxError("expected object key")
+		}
+		key, err := d.readStringBytes()
+		if err != nil {
+			return err
+		}
+		if d.peek() != ':' {
+			return d.syntaxError("expected colon")
+		}
+		d.pos++
+		if err := fn(key); err != nil {
+			return err
+		}
+
+		switch d.peek() {
+		case ',':
+			d.pos++
+		case '}':
+			d.pos++
+			return nil
+		default:
+			return d.syntaxError("expected comma or end of object")
+		}
+	}
+}
+
+// Array calls fn for each element of an array, which fn must consume.
+func (d *Decoder) Array(fn func() error) error {
+	if d.Null() {
+		return nil
+	}
+	if d.peek() != '[' {
+		return d.typeError("array")
+	}
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+	if d.peek() == ']' {
+		d.pos++
+		return nil
+	}
+	for {
+		if err := fn(); err != nil {
+			return err
+		}
+
+		switch d.peek() {
+		case ',':
+			d.pos++
+		case ']':
+			d.pos++
+			return nil
+		default:
+			return d.syntaxError("expected comma or end of array")
+		}
+	}
+}
+
+func (d *Decoder) String(v *string) error {
+	if d.Null() {
+		return nil
+	}
+	if d.peek() != '"' {
+		return d.typeError("string")
+	}
+	s, err := d.readString()
+	if err != nil {
+		return err
+	}
+	*v = s
+	return nil
+}
+
+func (d *Decoder) Bool(v *bool) error {
+	switch {
+	case d.Null():
+	case d.peek() == 't' && d.literal("true"):
+		*v = true
+	case d.peek() == 'f' && d.literal("false"):
+		*v = false
+	default:
+		return d.typeError("bool")
+	}
+	return nil
+}
+
+// Int reads a number into any signed integer type.
+func Int[T ~int | ~int8 | ~int16 | ~int32 | ~int64](d *Decoder, v *T) error {
+	if d.Null() {
+		return nil
+	}
+	num, err := d.readNumber()
+	if err != nil {
+		return err
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || int64(T(n)) != n {
+		return fmt.Errorf("genjson: cannot decode number %s into %T", num, *v)
+	}
+	*v = T(n)
+	return nil
+}
+
+// Uint reads a number into any unsigned integer type.
+func Uint[T ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr](d *Decoder, v *T) error {
+	if d.Null() {
+		return nil
+	}
+	num, err := d.readNumber()
+	if err != nil {
+		return err
+	}
+	n, err := strconv.ParseUint(num, 10, 64)
+	if err != nil || uint64(T(n)) != n {
+		return fmt.Errorf("genjson: cannot decode number %s into %T", num, *v)
+	}
+	*v = T(n)
+	return nil
+}
+
+// Float reads a number into either float type.
+func Float[T ~float32 | ~float64](d *Decoder, v *T) error {
+	if d.Null() {
+		return nil
+	}
+	num, err := d.readNumber()
+	if err != nil {
+		return err
+	}
+	bits := 64
+	if unsafe.Sizeof(*v) == 4 {
+		bits = 32
+	}
+	f, err := strconv.ParseFloat(num, bits)
+	if err != nil {
+		return fmt.Errorf("genjson: cannot decode number %s into %T", num, *v)
+	}
+	*v = T(f)
+	return nil
+}
+
+func (d *Decoder) Time(v *time.Time) error {
+	if d.Null() {
+		return nil
+	}
+	if d.peek() != '"' {
+		return d.typeError("time")
+	}
+	s, err := d.readString()
+	if err != nil {
+		return err
+	}
+	return v.UnmarshalText([]byte(s))
+}
+
+// Bytes reads a base64 string.
+func (d *Decoder) Bytes(v *[]byte) error {
+	if d.Null() {
+		*v = nil
+		return nil
+	}
+	if d.peek() != '"' {
+		return d.typeError("base64 string")
+	}
+	s, err := d.readString()
+	if err != nil {
+		return err
+	}
+	b, err := base64.StdEncoding.AppendDecode(make([]byte, 0, base64.StdEncoding.DecodedLen(len(s))), []byte(s))
+	if err != nil {
+		return err
+	}
+	*v = b
+	return nil
+}
+
+// MatchKey returns the field name an object key refers to, or an empty
+// string if none does. Like encoding/json, an exact match wins and a
+// case-insensitive one is accepted otherwise.
+func MatchKey(key []byte, names ...string) string {
+	for _, name := range names {
+		if string(key) == name {
+			return name
+		}
+	}
+	for _, name := range names {
+		if bytes.EqualFold(key, []byte(name)) {
+			return name
+		}
+	}
+	return ""
+}
+
+// Value decodes the next value with encoding/json, for fields the generator
+// has no direct decoding for.
+func (d *Decoder) Value(v any) error {
+	raw, err := d.Raw()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// Raw returns the next value as it appears in the input.
+func (d *Decoder) Raw() ([]byte, error) {
+	d.skipSpace()
+	start := d.pos
+	if err := d.Skip(); err != nil {
+		return nil, err
+	}
+	return d.data[start:d.pos], nil
+}
+
+// Skip consumes the next value.
+func (d *Decoder) Skip() error {
+	switch c := d.peek(); {
+	case c == '{':
+		return d.Object(func(string) error { return d.Skip() })
+	case c == '[':
+		return d.Array(d.Skip)
+	case c == '"':
+		_, err := d.readString()
+		return err
+	case c == 't' && d.literal("true"), c == 'f' && d.literal("false"), c == 'n' && d.literal("null"):
+		return nil
+	case c == '-' || c >= '0' && c <= '9':
+		_, err := d.readNumber()
+		return err
+	default:
+		return d.syntaxError("expected value")
+	}
+}
+
+func (d *Decoder) typeError(want string) error {
+	start := d.pos
+	if err := d.Skip(); err != nil {
+		return err
+	}
+	return fmt.Errorf("genjson: cannot decode %s into %s", d.data[start:d.pos], want)
+}
+
+// readNumber consumes a number, checking it against the JSON grammar.
+func (d *Decoder) readNumber() (string, error) {
+	d.skipSpace()
+	start := d.pos
+	digits := func() int {
+		n := 0
+		for d.pos < len(d.data) && d.data[d.pos] >= '0' && d.data[d.pos] <= '9' {
+			d.pos++
+			n++
+		}
+		return n
+	}
+
+	if d.pos < len(d.data) && d.data[d.pos] == '-' {
+		d.pos++
+	}
+	if d.pos < len(d.data) && d.data[d.pos] == '0' {
+		d.pos++
+	} else if digits() == 0 {
+		if d.pos == start {
+			return "", d.typeError("number")
+		}
+		return "", d.syntaxError("invalid number")
+	}
+	if d.pos < len(d.data) && d.data[d.pos] == '.' {
+		d.pos++
+		if digits() == 0 {
+			return "", d.syntaxError("invalid number")
+		}
+	}
+	if d.pos < len(d.data) && (d.data[d.pos] == 'e' || d.data[d.pos] == 'E') {
+		d.pos++
+		if d.pos < len(d.data) && (d.data[d.pos] == '+' || d.data[d.pos] == '-') {
+			d.pos++
+		}
+		if digits() == 0 {
+			return "", d.syntaxError("invalid number")
+		}
+	}
+	return string(d.data[start:d.pos]), nil
+}
+
+// readString consumes a string.
+func (d *Decoder) readString() (string, error) {
+	b, err := d.readStringBytes()
+	return string(b), err
+}
+
+// readStringBytes consumes a string. Strings without escapes or invalid
+// UTF-8 are returned as a slice of the input rather than copied.
+func (d *Decoder) readStringBytes() ([]byte, error) {
+	d.pos++ // opening quote
+	start := d.pos
+	for d.pos < len(d.data) {
+		c := d.data[d.pos]
+		switch {
+		case c == '"':
+			s := d.data[start:d.pos]
+			d.pos++
+			if !utf8.Valid(s) {
+				return []byte(string([]rune(string(s)))), nil
+			}
+			return s, nil
+		case c == '\\':
+			return d.readEscapedString(start)
+		case c < 0x20:
+			return nil, d.syntaxError("control character in string")
+		}
+		d.pos++
+	}
+	return nil, d.syntaxError("unterminated string")
+}
+
+func (d *Decoder) readEscapedString(start int) ([]byte, error) {
+	b := append([]byte(nil), d.data[start:d.pos]...)
+	for d.pos < len(d.data) {
+		c := d.data[d.pos]
+		switch {
+		case c == '"':
+			d.pos++
+			if !utf8.Valid(b) {
+				return []byte(string([]rune(string(b)))), nil
+			}
+			return b, nil
+		case c < 0x20:
+			return nil, d.syntaxError("control character in string")
+		case c != '\\':
+			b = append(b, c)
+			d.pos++
+			continue
+		}
+
+		d.pos++
+		if d.pos >= len(d.data) {
+			break
+		}
+		esc := d.data[d.pos]
+		d.pos++
+		switch esc {
+		case '"', '\\', '/':
+			b = append(b, esc)
+		case 'b':
+			b = append(b, '\b')
+		case 'f':
+			b = append(b, '\f')
+		case 'n':
+			b = append(b, '\n')
+		case 'r':
+			b = append(b, '\r')
+		case 't':
+			b = append(b, '\t')
+		case 'u':
+			r, ok := d.readHex()
+			if !ok {
+				return nil, d.syntaxError("invalid unicode escape")
+			}
+			if utf16.IsSurrogate(r) {
+				r2 := utf8.RuneError
+				save := d.pos
+				if d.literal(`\u`) {
+					if next, ok := d.readHex(); ok {
+						r2 = next
+					}
+				}
+				if dec := utf16.DecodeRune(r, r2); dec != utf8.RuneError {
+					r = dec
+				} else {
+					d.pos = save
+					r = utf8.RuneError
+				}
+			}
+			b = utf8.AppendRune(b, r)
+		default:
+			return nil, d.syntaxError("invalid escape")
+		}
+	}
+	return nil, d.syntaxError("unterminated string")
+}
+
+func (d *Decoder) readHex() (rune, bool) {
+	if len(d.data)-d.pos < 4 {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(string(d.data[d.pos:d.pos+4]), 16, 16)
+	if err != nil {
+		return 0, false
+	}
+	d.pos += 4
+	return rune(n), true
+}
@@ -0,0 +1,201 @@
+package genjson_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/eugen-bondarev/omniq/genjson"
+)
+
+var decodeStrings = []string{
+	`""`,
+	`"plain"`,
+	`"escapes \" \\ \/ \b \f \n \r \t"`,
+	`"unicode é   🎉"`,
+	`"lone surrogates \ud800 \udc00 \ud800x"`,
+	"\"invalid \xff bytes\"",
+}
+
+func decodeString(data string) (string, error) {
+	var s string
+	d := genjson.NewDecoder([]byte(data))
+	if err := d.String(&s); err != nil {
+		return "", err
+	}
+	return s, d.End()
+}
+
+func TestDecoderString(t *testing.T) {
+	for _, data := range decodeStrings {
+		var want string
+		if err := json.Unmarshal([]byte(data), &want); err != nil {
+			t.Fatalf("json.Unmarshal(%s): %v", data, err)
+		}
+		if got, err := decodeString(data); err != nil || got != want {
+			t.Errorf("String(%s) = %q, %v, want %q", data, got, err, want)
+		}
+	}
+}
+
+func FuzzDecoderString(f *testing.F) {
+	for _, data := range decodeStrings {
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data string) {
+		if !strings.HasPrefix(strings.TrimLeft(data, " \t\r\n"), `"`) {
+			return
+		}
+		var want string
+		wantErr := json.Unmarshal([]byte(data), &want)
+		got, err := decodeString(data)
+		if (err != nil) != (wantErr != nil) || err == nil && got != want {
+			t.Errorf("String(%q) = %q, %v, want %q, %v", data, got, err, want, wantErr)
+		}
+	})
+}
+
+func TestDecoderInvalid(t *testing.T) {
+	inputs := []string{
+		``,
+		`"unterminated`,
+		"\"control\x01\"",
+		`"bad escape \x"`,
+		`"bad unicode \u12"`,
+		`{"a" 1}`,
+		`{"a":1,}`,
+		`{"a":1 "b":2}`,
+		`[1,]`,
+		`[1 2]`,
+		`{1:2}`,
+		`tru`,
+		`01`,
+		`1.`,
+		`1e`,
+		`-`,
+		`{} {}`,
+	}
+	for _, data := range inputs {
+		d := genjson.NewDecoder([]byte(data))
+		err := d.Skip()
+		if err == nil {
+			err = d.End()
+		}
+		if !errors.Is(err, genjson.ErrSyntax) {
+			t.Errorf("decoding %q: got %v, want a syntax error", data, err)
+		}
+	}
+}
+
+func TestDecoderMaxDepth(t *testing.T) {
+	for _, open := range []string{"[", `{"a":`} {
+		data := strings.Repeat(open, 1_000_000)
+		if err := genjson.NewDecoder([]byte(data)).Skip(); !errors.Is(err, genjson.ErrSyntax) {
+			t.Errorf("decoding 1000000 nested %q: got %v, want a syntax error", open, err)
+		}
+	}
+
+	// encoding/json accepts up to 10000 levels, so must the decoder
+	data := strings.Repeat("[", 10000) + strings.Repeat("]", 10000)
+	if err := genjson.NewDecoder([]byte(data)).Skip(); err != nil {
+		t.Errorf("decoding 10000 nested arrays: %v", err)
+	}
+}
+
+func TestDecoderNumbers(t *testing.T) {
+	var i8 int8
+	if err := genjson.Int(genjson.NewDecoder([]byte(`-128`)), &i8); err != nil || i8 != -128 {
+		t.Errorf("Int(-128) = %d, %v", i8, err)
+	}
+	for _, data := range []string{`128`, `1.5`, `1e2`, `"1"`} {
+		if err := genjson.Int(genjson.NewDecoder([]byte(data)), &i8); err == nil {
+			t.Errorf("Int(%s) into int8 succeeded", data)
+		}
+	}
+
+	var u uint16
+	if err := genjson.Uint(genjson.NewDecoder([]byte(`65535`)), &u); err != nil || u != 65535 {
+		t.Errorf("Uint(65535) = %d, %v", u, err)
+	}
+	for _, data := range []string{`65536`, `-1`} {
+		if err := genjson.Uint(genjson.NewDecoder([]byte(data)), &u); err == nil {
+			t.Errorf("Uint(%s) into uint16 succeeded", data)
+		}
+	}
+
+	var f32 float32
+	if err := genjson.Float(genjson.NewDecoder([]byte(`1e39`)), &f32); err == nil {
+		t.Error("Float(1e39) into float32 succeeded")
+	}
+	var f64 float64
+	if err := genjson.Float(genjson.NewDecoder([]byte(`-1.25E-3`)), &f64); err != nil || f64 != -1.25e-3 {
+		t.Errorf("Float(-1.25E-3) = %v, %v", f64, err)
+	}
+}
+
+func TestDecoderNull(t *testing.T) {
+	s, n, b := "kept", 7, true
+	for _, decode := range []func(*genjson.Decoder) error{
+		func(d *genjson.Decoder) error { return d.String(&s) },
+		func(d *genjson.Decoder) error { return genjson.Int(d, &n) },
+		func(d *genjson.Decoder) error { return d.Bool(&b) },
+	} {
+		if err := decode(genjson.NewDecoder([]byte(` null `))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s != "kept" || n != 7 || !b {
+		t.Errorf("null changed the values to %q, %d, %v", s, n, b)
+	}
+}
+
+func TestDecoderFields(t *testing.T) {
+	data := `{"Name":"a","unknown":{"nested":[1,{"x":null}]},"AGE":3,"name":"b"}`
+	var name string
+	var age int
+	d := genjson.NewDecoder([]byte(data))
+	err := d.Fields(func(key []byte) error {
+		switch genjson.MatchKey(key, "name", "age") {
+		case "name":
+			return d.String(&name)
+		case "age":
+			return genjson.Int(d, &age)
+		default:
+			return d.Skip()
+		}
+	})
+	if err == nil {
+		err = d.End()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+	if err := json.Unmarshal([]byte(data), &want); err != nil {
+		t.Fatal(err)
+	}
+	if name != want.Name || age != want.Age {
+		t.Errorf("got %q, %d, encoding/json got %q, %d", name, age, want.Name, want.Age)
+	}
+}
+
+func TestMatchKey(t *testing.T) {
+	cases := []struct {
+		key, want string
+	}{
+		{"name", "name"},
+		{"Name", "Name"},
+		{"NAME", "name"},
+		{"other", ""},
+	}
+	for _, c := range cases {
+		if got := genjson.MatchKey([]byte(c.key), "name", "Name"); got != c.want {
+			t.Errorf("MatchKey(%q) = %q, want %q", c.key, got, c.want)
+		}
+	}
+}
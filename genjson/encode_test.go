@@ -0,0 +1,102 @@
+package genjson_test
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/eugen-bondarev/omniq/genjson"
+)
+
+var encodeStrings = []string{
+	"",
+	"plain",
+	`quote " and backslash \`,
+	"<script>&amp;</script>",
+	"\n\r\t\b\f\x00\x1f\x7f",
+	"héllo wörld ✓ 🎉",
+	"line separator ",
+	"invalid \xff\xfe bytes",
+	"truncated \xe2\x82",
+	"\xed\xa0\x80 surrogate",
+}
+
+func TestAppendString(t *testing.T) {
+	for _, s := range encodeStrings {
+		want, _ := json.Marshal(s)
+		if got := genjson.AppendString(nil, s); string(got) != string(want) {
+			t.Errorf("AppendString(%q) = %s, want %s", s, got, want)
+		}
+	}
+}
+
+func FuzzAppendString(f *testing.F) {
+	for _, s := range encodeStrings {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		want, _ := json.Marshal(s)
+		if got := genjson.AppendString(nil, s); string(got) != string(want) {
+			t.Errorf("AppendString(%q) = %s, want %s", s, got, want)
+		}
+	})
+}
+
+func TestAppendFloat(t *testing.T) {
+	floats := []float64{0, math.Copysign(0, -1), 1, -1.5, 0.1, 1e-6, 1e-7, 123456789, 1e20, 1e21, 1e-100, math.MaxFloat64, math.SmallestNonzeroFloat64}
+	for _, f := range floats {
+		want, _ := json.Marshal(f)
+		got, err := genjson.AppendFloat(nil, f, 64)
+		if err != nil || string(got) != string(want) {
+			t.Errorf("AppendFloat(%v, 64) = %s, %v, want %s", f, got, err, want)
+		}
+
+		f32 := float32(f)
+		want, wantErr := json.Marshal(f32)
+		got, err = genjson.AppendFloat(nil, float64(f32), 32)
+		if (err != nil) != (wantErr != nil) || string(got) != string(want) {
+			t.Errorf("AppendFloat(%v, 32) = %s, %v, want %s", f32, got, err, want)
+		}
+	}
+
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, err := genjson.AppendFloat(nil, f, 64); err == nil {
+			t.Errorf("AppendFloat(%v) succeeded, encoding/json fails", f)
+		}
+	}
+}
+
+func TestAppendTime(t *testing.T) {
+	times := []time.Time{{}, time.Date(2024, 2, 29, 13, 4, 5, 123456789, time.FixedZone("", 5*3600+1800))}
+	for _, v := range times {
+		want, _ := json.Marshal(v)
+		got, err := genjson.AppendTime(nil, v)
+		if err != nil || string(got) != string(want) {
+			t.Errorf("AppendTime(%v) = %s, %v, want %s", v, got, err, want)
+		}
+	}
+	if _, err := genjson.AppendTime(nil, time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Error("AppendTime succeeded for a year outside RFC 3339, encoding/json fails")
+	}
+}
+
+func TestAppendBytes(t *testing.T) {
+	for _, v := range [][]byte{nil, {}, []byte("hello, world"), {0, 0xff, 0xfe}} {
+		want, _ := json.Marshal(v)
+		if got := genjson.AppendBytes(nil, v); string(got) != string(want) {
+			t.Errorf("AppendBytes(%v) = %s, want %s", v, got, want)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	b := []byte{'{'}
+	b = genjson.Key(b, `"a":`)
+	b = append(b, '1')
+	b = genjson.Key(b, `"b":`)
+	b = append(b, '2', '}')
+	if string(b) != `{"a":1,"b":2}` {
+		t.Errorf("got %s", b)
+	}
+}
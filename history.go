@@ -0,0 +1,261 @@
+package omniq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+)
+
+var ErrHistoryNotSupported = errors.New("omniq: storage does not keep a job history")
+
+// historyReapInterval is how often the scheduler enforces the retention policy.
+const historyReapInterval = time.Minute
+
+type JobStatus string
+
+const (
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+// HistoryRecord describes a single run of a job. State is the job encoded
+// with the storage's codec: its JSON, or for other codecs an object holding
+// the codec name and the base64-encoded data.
+type HistoryRecord struct {
+	ID         JobID
+	Type       string
+	State      json.RawMessage
+	Status     JobStatus
+	Attempts   int
+	Error      string `json:",omitempty"`
+	Worker     string
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+func (r HistoryRecord) Duration() time.Duration {
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// WithHistory makes the scheduler archive every job it runs, provided the
+// storage implements HistoryStorage. Records older than maxAge and all but the
+// newest maxRows are removed in the background; zero disables either limit.
+func WithHistory(maxAge time.Duration, maxRows int) schedulerOption {
+	return func(opts *schedulerOptions) {
+		opts.history = true
+		opts.historyMaxAge = maxAge
+		opts.historyMaxRows = maxRows
+	}
+}
+
+// WithWorkerID sets the name recorded in the history as the worker that ran
+// the job. It defaults to the host name and the process ID.
+func WithWorkerID(id string) schedulerOption {
+	return func(opts *schedulerOptions) {
+		opts.workerID = id
+	}
+}
+
+func defaultWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// History returns the archived runs of the job, oldest first.
+func (s *Scheduler[T]) History(id JobID) ([]HistoryRecord, error) {
+	storage, ok := s.storage.(HistoryStorage)
+	if !ok {
+		return nil, ErrHistoryNotSupported
+	}
+	return storage.History(id)
+}
+
+// run runs the job, turning a panic or a timeout into a failure, and archives
+// the outcome of every attempt. Failed Retrying jobs go back to the storage,
+// due after their backoff. Only if the storage cannot take them are they
+// retried in process.
+func (s *Scheduler[T]) run(j Job[T], container T) {
+	policy := jobRetries(j)
+	storage, requeue := s.storage.(RetryStorage[T])
+	// Attempts the storage counted include runs cut short by an exit
+	for attempt := max(j.GetIDContainer().GetAttempts(), 1); ; attempt++ {
+		started := time.Now()
+		var err error
+		j, err = s.runJob(j, container, jobTimeout(j))
+		if err != nil {
+			log.Println("Error running job", j.GetIDContainer().GetID(), err)
+		}
+		if s.options.history {
+			s.archive(j, started, attempt, err)
+		}
+		if err == nil || attempt > policy.Retries {
+			return
+		}
+
+		delay := policy.delay(attempt)
+		if requeue {
+			err := storage.PushRetry(j, time.Now().Add(delay), attempt)
+			if err == nil {
+				s.waker.wake()
+				return
+			}
+			log.Println("Error rescheduling job", j.GetIDContainer().GetID(), err)
+		}
+		time.Sleep(delay)
+	}
+}
+
+// runJob runs the job and returns it as it is afterwards. A job that times
+// out is given up on but keeps running, so with a timeout it runs on a copy,
+// and runJob returns j as it was before the run for archiving and retrying.
+func (s *Scheduler[T]) runJob(j Job[T], container T, timeout time.Duration) (Job[T], error) {
+	if timeout <= 0 {
+		return j, runRecovered(j, container)
+	}
+	c, err := s.copyJob(j)
+	if err != nil {
+		log.Println("Error copying job", j.GetIDContainer().GetID(), "to run it with a timeout, running it without:", err)
+		return j, runRecovered(j, container)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- runRecovered(c, container)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return c, err
+	case <-timer.C:
+		return j, fmt.Errorf("%w after %v", ErrJobTimeout, timeout)
+	}
+}
+
+// copyJob copies the job by encoding and decoding it with the storage's
+// codec, so the copy holds what the storage would.
+func (s *Scheduler[T]) copyJob(j Job[T]) (Job[T], error) {
+	t := reflect.TypeOf(j)
+	if t.Kind() != reflect.Pointer {
+		return nil, fmt.Errorf("omniq: %s is not a pointer", t)
+	}
+	payload, err := encodeJob(j, s.codec())
+	if err != nil {
+		return nil, err
+	}
+	c := reflect.New(t.Elem()).Interface().(Job[T])
+	if err := payload.Decode(c); err != nil {
+		return nil, err
+	}
+	c.GetIDContainer().SetID(j.GetIDContainer().GetID())
+	c.GetIDContainer().SetAttempts(j.GetIDContainer().GetAttempts())
+	return c, nil
+}
+
+// codec returns the codec the storage encodes jobs with, nil for JSON.
+func (s *Scheduler[T]) codec() Codec {
+	if storage, ok := s.storage.(codecStorage); ok {
+		return storage.jobCodec()
+	}
+	return nil
+}
+
+func runRecovered[T any](j Job[T], container T) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	j.Run(container)
+	return nil
+}
+
+func (s *Scheduler[T]) archive(j Job[T], started time.Time, attempt int, runErr error) {
+	storage, ok := s.storage.(HistoryStorage)
+	if !ok {
+		return
+	}
+	payload, err := encodeJob(j, s.codec())
+	if err != nil {
+		log.Println("Error archiving job:", err)
+		return
+	}
+	state := json.RawMessage(payload.Data)
+	if !payload.IsJSON() {
+		if state, err = json.Marshal(newStoredPayload(payload)); err != nil {
+			log.Println("Error archiving job:", err)
+			return
+		}
+	}
+
+	rec := HistoryRecord{
+		ID:         j.GetIDContainer().GetID(),
+		Type:       j.Type(),
+		State:      state,
+		Status:     JobSucceeded,
+		Attempts:   attempt,
+		Worker:     s.options.workerID,
+		StartedAt:  started,
+		FinishedAt: time.Now(),
+	}
+	if runErr != nil {
+		rec.Status = JobFailed
+		rec.Error = runErr.Error()
+	}
+	if err := storage.Archive(rec); err != nil {
+		log.Println("Error archiving job:", err)
+	}
+}
+
+// reapHistory enforces the retention policy until the process exits. It runs
+// even without limits, since storages may use PruneHistory for other upkeep.
+func (s *Scheduler[T]) reapHistory() {
+	storage, ok := s.storage.(HistoryStorage)
+	if !ok {
+		log.Println("Storage does not keep a job history, WithHistory has no effect")
+		return
+	}
+
+	ticker := time.NewTicker(historyReapInterval)
+	defer ticker.Stop()
+	for {
+		var before time.Time
+		if s.options.historyMaxAge > 0 {
+			before = time.Now().Add(-s.options.historyMaxAge)
+		}
+		if _, err := storage.PruneHistory(before, s.options.historyMaxRows); err != nil {
+			log.Println("Error pruning job history:", err)
+		}
+		<-ticker.C
+	}
+}
+
+// historyExpired returns the indices of the entries PruneHistory should
+// remove, given their finish times.
+func historyExpired(finished []time.Time, before time.Time, keep int) []int {
+	order := make([]int, len(finished))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return finished[order[a]].Before(finished[order[b]]) })
+
+	excess := 0
+	if keep > 0 && len(order) > keep {
+		excess = len(order) - keep
+	}
+	expired := []int{}
+	for n, i := range order {
+		if n < excess || finished[i].Before(before) {
+			expired = append(expired, i)
+		}
+	}
+	return expired
+}
@@ -0,0 +1,131 @@
+package omniq
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// historyFile keeps history records as JSON lines next to a file-based
+// storage. Archiving only appends; pruning rewrites the file.
+type historyFile struct {
+	mu   sync.Mutex
+	name string
+}
+
+func newHistoryFile(name string) *historyFile {
+	return &historyFile{name: name}
+}
+
+func (h *historyFile) archive(rec HistoryRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	f, err := os.OpenFile(h.name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// read skips lines that do not parse, such as a record torn by a crash.
+func (h *historyFile) read() ([]HistoryRecord, error) {
+	content, err := os.ReadFile(h.name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	recs := []HistoryRecord{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+	for scanner.Scan() {
+		var rec HistoryRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err == nil {
+			recs = append(recs, rec)
+		}
+	}
+	return recs, scanner.Err()
+}
+
+func (h *historyFile) history(id JobID) ([]HistoryRecord, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	recs, err := h.read()
+	if err != nil {
+		return nil, err
+	}
+	found := []HistoryRecord{}
+	for _, rec := range recs {
+		if rec.ID == id {
+			found = append(found, rec)
+		}
+	}
+	sort.SliceStable(found, func(a, b int) bool { return found[a].FinishedAt.Before(found[b].FinishedAt) })
+	return found, nil
+}
+
+func (h *historyFile) prune(before time.Time, keep int) (int, error) {
+	if before.IsZero() && keep == 0 {
+		return 0, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	recs, err := h.read()
+	if err != nil {
+		return 0, err
+	}
+	finished := make([]time.Time, len(recs))
+	for i, rec := range recs {
+		finished[i] = rec.FinishedAt
+	}
+	expired := historyExpired(finished, before, keep)
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	remove := make(map[int]bool, len(expired))
+	for _, i := range expired {
+		remove[i] = true
+	}
+	var buf bytes.Buffer
+	for i, rec := range recs {
+		if remove[i] {
+			continue
+		}
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return 0, err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	tmp := h.name + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, h.name); err != nil {
+		return 0, err
+	}
+	return len(expired), nil
+}
@@ -10,6 +10,9 @@ type JobID string
 
 type WithID struct {
 	ID JobID
+	// attempts is how often the storage has handed out the job, the claim
+	// that returned it included. It is not stored with the job's state.
+	attempts int
 }
 
 func (w *WithID) GetID() JobID {
@@ -19,3 +22,29 @@ func (w *WithID) GetID() JobID {
 func (w *WithID) SetID(id JobID) {
 	w.ID = id
 }
+
+// GetAttempts returns how often GetDue has handed out the job so far, 0 if the
+// storage does not count claims.
+func (w *WithID) GetAttempts() int {
+	return w.attempts
+}
+
+// SetAttempts is called by storages in GetDue, see GetAttempts.
+func (w *WithID) SetAttempts(n int) {
+	w.attempts = n
+}
+
+// DefaultQueue is the queue of jobs that do not name one.
+const DefaultQueue = "default"
+
+// Queued is implemented by jobs that belong to a queue other than DefaultQueue.
+type Queued interface {
+	Queue() string
+}
+
+func jobQueue[T any](j Job[T]) string {
+	if q, ok := j.(Queued); ok && q.Queue() != "" {
+		return q.Queue()
+	}
+	return DefaultQueue
+}
@@ -0,0 +1,132 @@
+package omniq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrJobTimeout = errors.New("omniq: job timed out")
+
+// Backoff is how the delay between retries grows.
+type Backoff string
+
+const (
+	BackoffConstant    Backoff = "const"
+	BackoffLinear      Backoff = "linear"
+	BackoffExponential Backoff = "exp"
+)
+
+// maxRetryDelay caps the delay between retries, so exponential backoff does
+// not overflow.
+const maxRetryDelay = 24 * time.Hour
+
+// RetryPolicy says how often a failed job is run again and how long the
+// scheduler waits in between. Delay defaults to a second.
+type RetryPolicy struct {
+	Retries int
+	Backoff Backoff
+	Delay   time.Duration
+}
+
+// delay is the wait before the given retry, counting from 1.
+func (p RetryPolicy) delay(retry int) time.Duration {
+	d := p.Delay
+	if d <= 0 {
+		d = time.Second
+	}
+	switch p.Backoff {
+	case BackoffLinear:
+		d *= time.Duration(retry)
+	case BackoffExponential:
+		for i := 1; i < retry && d < maxRetryDelay; i++ {
+			d *= 2
+		}
+	}
+	return min(d, maxRetryDelay)
+}
+
+// Retrying is implemented by jobs that are run again when they fail. Storages
+// that implement RetryStorage get the job back, due after the backoff, so any
+// scheduler may run the retry. With other storages retries happen in the
+// process that claimed the job; if it exits, the remaining ones are lost.
+type Retrying interface {
+	Retries() RetryPolicy
+}
+
+// TimeLimited is implemented by jobs whose runs count as failed when they take
+// longer than Timeout. Run cannot be interrupted, so a run that times out is
+// abandoned rather than stopped, and a retry may overlap with it.
+type TimeLimited interface {
+	Timeout() time.Duration
+}
+
+// Unique is implemented by jobs of which only one may be pending per value of
+// the returned fields, keyed by their JSON names. Scheduling a duplicate
+// enqueues nothing and gives the job the ID of the pending one. The check
+// uses QueryStorage and is not atomic, so concurrent schedulers may still
+// enqueue a duplicate, and jobs stored with codecs other than JSON are never
+// found.
+type Unique interface {
+	UniqueFields() map[string]any
+}
+
+// Prioritized is implemented by jobs that are started before others claimed
+// in the same batch. Higher priorities start first; the default is 0.
+type Prioritized interface {
+	Priority() int
+}
+
+func jobRetries[T any](j Job[T]) RetryPolicy {
+	if r, ok := j.(Retrying); ok {
+		return r.Retries()
+	}
+	return RetryPolicy{}
+}
+
+func jobTimeout[T any](j Job[T]) time.Duration {
+	if t, ok := j.(TimeLimited); ok {
+		return t.Timeout()
+	}
+	return 0
+}
+
+func jobPriority[T any](j Job[T]) int {
+	if p, ok := j.(Prioritized); ok {
+		return p.Priority()
+	}
+	return 0
+}
+
+// uniqueKey identifies the pending job a Unique job would duplicate, empty
+// for jobs that are not Unique.
+func uniqueKey[T any](j Job[T]) (string, map[string]any, error) {
+	u, ok := j.(Unique)
+	if !ok {
+		return "", nil, nil
+	}
+	fields := u.UniqueFields()
+	content, err := json.Marshal(fields)
+	if err != nil {
+		return "", nil, fmt.Errorf("omniq: encoding the unique fields of %s: %w", j.Type(), err)
+	}
+	return j.Type() + string(content), fields, nil
+}
+
+// pendingDuplicate returns the ID of a pending job that j would duplicate.
+func (s *Scheduler[T]) pendingDuplicate(j Job[T]) (JobID, error) {
+	key, fields, err := uniqueKey(j)
+	if key == "" || err != nil {
+		return "", err
+	}
+	storage, ok := s.storage.(QueryStorage)
+	if !ok {
+		return "", fmt.Errorf("%w: %s is unique", ErrQueryNotSupported, j.Type())
+	}
+	page, err := storage.Query(JobFilter{Types: []string{j.Type()}, Payload: fields, Limit: 1})
+	if err != nil || len(page.Jobs) == 0 {
+		return "", err
+	}
+	return page.Jobs[0].ID, nil
+}
@@ -0,0 +1,452 @@
+package omniq
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type journalOp string
+
+const (
+	journalPush     journalOp = "push"
+	journalClaim    journalOp = "claim"
+	journalComplete journalOp = "complete"
+)
+
+// journalRecord is a single line of the journal. Push records carry the full
+// job, and the attempts so far for retries, claim records carry the lease
+// expiry in Time and the attempts so far, complete records only the ID.
+// Records hold absolute values, so applying one twice changes nothing.
+type journalRecord struct {
+	Op       journalOp
+	ID       JobID
+	Time     time.Time `json:",omitzero"`
+	Type     string    `json:",omitempty"`
+	Queue    string    `json:",omitempty"`
+	Attempts int       `json:",omitempty"`
+	storedPayload
+}
+
+type journalEntry struct {
+	ID    JobID
+	Time  time.Time
+	Type  string
+	Queue string `json:",omitempty"`
+	storedPayload
+	Attempts int `json:",omitempty"`
+}
+
+type journalStorageOptions struct {
+	compactThreshold int
+	codec            Codec
+}
+
+func newDefaultJournalStorageOptions() journalStorageOptions {
+	return journalStorageOptions{compactThreshold: 1000}
+}
+
+type journalStorageOption func(*journalStorageOptions)
+
+// WithCompactThreshold sets how many records the journal may hold before it is
+// folded into the snapshot.
+func WithCompactThreshold(n int) journalStorageOption {
+	return func(opts *journalStorageOptions) {
+		opts.compactThreshold = n
+	}
+}
+
+// WithJournalCodec sets the codec jobs are encoded with, unless they name
+// their own. Payloads of other codecs are stored base64-encoded.
+func WithJournalCodec(c Codec) journalStorageOption {
+	return func(opts *journalStorageOptions) {
+		opts.codec = c
+	}
+}
+
+type journalStorage[T any] struct {
+	mu           sync.Mutex
+	fileName     string
+	snapshotName string
+	journal      *os.File
+	records      int
+	entries      map[JobID]*journalEntry
+	factory      JobFactory[T]
+	options      journalStorageOptions
+	history      *historyFile
+	dead         *deadLetterFile
+}
+
+// NewJournalStorage opens (or creates) an append-only journal at fileName and a
+// snapshot next to it at fileName + ".snapshot", and rebuilds the pending jobs
+// from both.
+func NewJournalStorage[T any](fileName string, factory JobFactory[T], opts ...journalStorageOption) (*journalStorage[T], error) {
+	options := newDefaultJournalStorageOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	s := &journalStorage[T]{
+		fileName:     fileName,
+		snapshotName: fileName + ".snapshot",
+		entries:      map[JobID]*journalEntry{},
+		factory:      factory,
+		options:      options,
+		history:      newHistoryFile(fileName + ".history"),
+		dead:         newDeadLetterFile(fileName + ".dead"),
+	}
+	if err := s.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := s.replay(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *journalStorage[T]) loadSnapshot() error {
+	content, err := os.ReadFile(s.snapshotName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	entries := []*journalEntry{}
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		s.entries[e.ID] = e
+	}
+	return nil
+}
+
+// replay applies the journal on top of the snapshot. A torn record at the end
+// of the file (a crash mid-write) is cut off so new records start on a clean
+// line. A record that does not parse anywhere else is corruption, and an error.
+func (s *journalStorage[T]) replay() error {
+	f, err := os.OpenFile(s.fileName, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return err
+		}
+
+		var rec journalRecord
+		if err := json.Unmarshal(bytes.TrimSpace(line), &rec); err != nil {
+			if _, err := r.Peek(1); errors.Is(err, io.EOF) {
+				break
+			}
+			f.Close()
+			return fmt.Errorf("omniq: journal %s is corrupt at line %d: %w", s.fileName, n, err)
+		}
+		s.apply(rec)
+		s.records++
+		offset += int64(len(line))
+	}
+
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	s.journal = f
+	return nil
+}
+
+func (s *journalStorage[T]) apply(rec journalRecord) {
+	switch rec.Op {
+	case journalPush:
+		s.entries[rec.ID] = &journalEntry{ID: rec.ID, Time: rec.Time, Type: rec.Type, Queue: rec.Queue, storedPayload: rec.storedPayload, Attempts: rec.Attempts}
+	case journalClaim:
+		if e, ok := s.entries[rec.ID]; ok {
+			e.Time = rec.Time
+			e.Attempts = rec.Attempts
+		}
+	case journalComplete:
+		delete(s.entries, rec.ID)
+	}
+}
+
+func (s *journalStorage[T]) append(recs ...journalRecord) error {
+	var buf bytes.Buffer
+	for _, rec := range recs {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	if _, err := s.journal.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if err := s.journal.Sync(); err != nil {
+		return err
+	}
+	for _, rec := range recs {
+		s.apply(rec)
+	}
+	s.records += len(recs)
+
+	// The records are durable already, so a failed compaction only means a
+	// longer journal until the next one succeeds
+	if s.records >= s.options.compactThreshold {
+		if err := s.compact(); err != nil {
+			log.Println("Error compacting the journal:", err)
+		}
+	}
+	return nil
+}
+
+// compact writes the pending jobs to a new snapshot and empties the journal.
+// Records hold absolute values, so a crash between the two steps only means
+// some records are applied twice, to the same effect.
+func (s *journalStorage[T]) compact() error {
+	entries := make([]*journalEntry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	content, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.snapshotName + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.snapshotName); err != nil {
+		return err
+	}
+
+	if err := s.journal.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := s.journal.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	s.records = 0
+	return nil
+}
+
+func (s *journalStorage[T]) jobCodec() Codec {
+	return s.options.codec
+}
+
+func (s *journalStorage[T]) Push(j Job[T], t time.Time) error {
+	payload, err := encodeJob(j, s.options.codec)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := JobID(uuid.New().String())
+	if err := s.append(journalRecord{Op: journalPush, ID: id, Time: t, Type: j.Type(), Queue: jobQueue(j), storedPayload: newStoredPayload(payload)}); err != nil {
+		return err
+	}
+	j.GetIDContainer().SetID(id)
+	return nil
+}
+
+// PushRetry appends a push record, which replaces the job if it is still
+// there. Its attempts carry over to the next claim.
+func (s *journalStorage[T]) PushRetry(j Job[T], t time.Time, attempts int) error {
+	payload, err := encodeJob(j, s.options.codec)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := j.GetIDContainer().GetID()
+	return s.append(journalRecord{Op: journalPush, ID: id, Time: t, Type: j.Type(), Queue: jobQueue(j), Attempts: attempts, storedPayload: newStoredPayload(payload)})
+}
+
+// PushMany appends all jobs to the journal with a single write and fsync.
+func (s *journalStorage[T]) PushMany(items []Scheduled[T]) ([]JobID, error) {
+	errs := &BulkError{}
+	payloads := encodeScheduled(items, s.options.codec, errs)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]JobID, len(items))
+	recs := make([]journalRecord, 0, len(items))
+	for i, item := range items {
+		if payloads[i].Codec == "" {
+			continue
+		}
+		ids[i] = JobID(uuid.New().String())
+		recs = append(recs, journalRecord{Op: journalPush, ID: ids[i], Time: item.At, Type: item.Job.Type(), Queue: jobQueue(item.Job), storedPayload: newStoredPayload(payloads[i])})
+	}
+	if len(recs) > 0 {
+		if err := s.append(recs...); err != nil {
+			return nil, err
+		}
+	}
+	for i, item := range items {
+		if ids[i] != "" {
+			item.Job.GetIDContainer().SetID(ids[i])
+		}
+	}
+	return ids, errs.err()
+}
+
+func (s *journalStorage[T]) Delete(id JobID) error {
+	return s.DeleteMany([]JobID{id})
+}
+
+func (s *journalStorage[T]) DeleteMany(ids []JobID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recs := make([]journalRecord, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := s.entries[id]; ok {
+			recs = append(recs, journalRecord{Op: journalComplete, ID: id})
+		}
+	}
+	if len(recs) == 0 {
+		return nil
+	}
+	return s.append(recs...)
+}
+
+func (s *journalStorage[T]) GetDue() ([]Job[T], error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var due []*journalEntry
+	for _, e := range s.entries {
+		if !e.Time.After(now) {
+			due = append(due, e)
+		}
+	}
+	sort.Slice(due, func(a, b int) bool { return due[a].Time.Before(due[b].Time) })
+
+	claims := make([]journalRecord, 0, len(due))
+	jobs := make([]Job[T], 0, len(due))
+	for _, e := range due {
+		claims = append(claims, journalRecord{Op: journalClaim, ID: e.ID, Time: now.Add(claimLease), Attempts: e.Attempts + 1})
+		jobs = append(jobs, instantiateClaimed(s.factory, e.Type, e.ID, e.payload(), e.Attempts+1))
+	}
+	if len(claims) > 0 {
+		if err := s.append(claims...); err != nil {
+			return nil, err
+		}
+	}
+	return jobs, nil
+}
+
+func (s *journalStorage[T]) NextDue() (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next time.Time
+	for _, e := range s.entries {
+		if next.IsZero() || e.Time.Before(next) {
+			next = e.Time
+		}
+	}
+	return next, !next.IsZero(), nil
+}
+
+func (s *journalStorage[T]) Query(f JobFilter) (JobPage, error) {
+	s.mu.Lock()
+	jobs := make([]JobInfo, 0, len(s.entries))
+	for _, e := range s.entries {
+		jobs = append(jobs, JobInfo{ID: e.ID, Type: e.Type, Queue: cmp.Or(e.Queue, DefaultQueue), DueAt: e.Time, Attempts: e.Attempts, Payload: e.payload()})
+	}
+	s.mu.Unlock()
+
+	return queryJobs(jobs, f, time.Now())
+}
+
+// DeadLetter moves the job to fileName + ".dead" and completes it in the journal.
+func (s *journalStorage[T]) DeadLetter(id JobID, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[id]
+	if !ok {
+		return nil
+	}
+	err := s.dead.add(deadLetterEntry{ID: e.ID, Type: e.Type, Queue: cmp.Or(e.Queue, DefaultQueue), storedPayload: e.storedPayload, Attempts: e.Attempts, Error: reason, FailedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+	return s.append(journalRecord{Op: journalComplete, ID: id})
+}
+
+func (s *journalStorage[T]) DeadLetters() ([]DeadLetter, error) {
+	return s.dead.list()
+}
+
+// Archive appends the record to fileName + ".history", which is kept apart from
+// the journal so compaction never has to carry it.
+func (s *journalStorage[T]) Archive(rec HistoryRecord) error {
+	return s.history.archive(rec)
+}
+
+func (s *journalStorage[T]) History(id JobID) ([]HistoryRecord, error) {
+	return s.history.history(id)
+}
+
+func (s *journalStorage[T]) PruneHistory(before time.Time, keep int) (int, error) {
+	return s.history.prune(before, keep)
+}
+
+// Close compacts the journal and releases the underlying file.
+func (s *journalStorage[T]) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.compact(); err != nil {
+		return err
+	}
+	return s.journal.Close()
+}
@@ -0,0 +1,165 @@
+package omniq_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eugen-bondarev/omniq"
+	"github.com/eugen-bondarev/omniq/storagetest"
+)
+
+func TestJournalStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, factory omniq.JobFactory[struct{}]) omniq.SchedulerStorage[struct{}] {
+		// A low threshold so the suite also runs across compactions
+		s, err := omniq.NewJournalStorage(filepath.Join(t.TempDir(), "jobs.journal"), factory, omniq.WithCompactThreshold(7))
+		if err != nil {
+			t.Fatalf("NewJournalStorage: %v", err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestJournalStorageTornRecord(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "jobs.journal")
+	s, err := omniq.NewJournalStorage(fileName, &storagetest.Factory{})
+	if err != nil {
+		t.Fatalf("NewJournalStorage: %v", err)
+	}
+	if err := s.Push(&storagetest.TextJob{Text: "kept"}, time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+
+	// A crash halfway through writing the next record
+	f, err := os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"Op":"push","ID":"torn`)
+	f.Close()
+
+	s, err = omniq.NewJournalStorage(fileName, &storagetest.Factory{})
+	if err != nil {
+		t.Fatalf("reopening after a torn record: %v", err)
+	}
+	due, err := s.GetDue()
+	if err != nil {
+		t.Fatalf("GetDue: %v", err)
+	}
+	if len(due) != 1 || due[0].(*storagetest.TextJob).Text != "kept" {
+		t.Errorf("GetDue returned %v, want the job pushed before the torn record", due)
+	}
+}
+
+func TestJournalStorageCorruptRecord(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "jobs.journal")
+	s, err := omniq.NewJournalStorage(fileName, &storagetest.Factory{})
+	if err != nil {
+		t.Fatalf("NewJournalStorage: %v", err)
+	}
+	for _, text := range []string{"a", "b", "c"} {
+		if err := s.Push(&storagetest.TextJob{Text: text}, time.Now()); err != nil {
+			t.Fatalf("Push: %v", err)
+		}
+	}
+
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(content), "\n")
+	lines[1] = "garbage\n"
+	if err := os.WriteFile(fileName, []byte(strings.Join(lines, "")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := omniq.NewJournalStorage(fileName, &storagetest.Factory{}); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("reopening a journal with a corrupt record in the middle returned %v, want an error for line 2", err)
+	}
+	after, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(strings.Join(lines, "")) {
+		t.Errorf("the corrupt journal was cut from %d to %d bytes", len(strings.Join(lines, "")), len(after))
+	}
+}
+
+// TestJournalStorageReplayAfterCompaction reopens a journal as if the process
+// died between writing the snapshot and emptying the journal, so every record
+// is applied a second time.
+func TestJournalStorageReplayAfterCompaction(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "jobs.journal")
+	s, err := omniq.NewJournalStorage(fileName, &storagetest.Factory{})
+	if err != nil {
+		t.Fatalf("NewJournalStorage: %v", err)
+	}
+	if err := s.Push(&storagetest.TextJob{Text: "retried"}, time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	// Closing compacts, so the push is in the snapshot and only the claim in
+	// the journal
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	s, err = omniq.NewJournalStorage(fileName, &storagetest.Factory{})
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	if _, err := s.GetDue(); err != nil {
+		t.Fatalf("GetDue: %v", err)
+	}
+
+	journal, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := os.WriteFile(fileName, journal, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = omniq.NewJournalStorage(fileName, &storagetest.Factory{})
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	page, err := s.Query(omniq.JobFilter{})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if page.Total != 1 || page.Jobs[0].Attempts != 1 {
+		t.Errorf("Query after replaying twice returned %+v, want one job with 1 attempt", page.Jobs)
+	}
+}
+
+func TestJournalStorageCompactionFails(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "jobs.journal")
+	s, err := omniq.NewJournalStorage(fileName, &storagetest.Factory{}, omniq.WithCompactThreshold(1))
+	if err != nil {
+		t.Fatalf("NewJournalStorage: %v", err)
+	}
+	// The snapshot cannot be written while a directory takes its place
+	if err := os.Mkdir(fileName+".snapshot.tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Push(&storagetest.TextJob{Text: "kept"}, time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("Push failed although the record was written: %v", err)
+	}
+
+	s, err = omniq.NewJournalStorage(fileName, &storagetest.Factory{})
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	due, err := s.GetDue()
+	if err != nil {
+		t.Fatalf("GetDue: %v", err)
+	}
+	if len(due) != 1 || due[0].(*storagetest.TextJob).Text != "kept" {
+		t.Errorf("GetDue returned %v, want the pushed job from the journal", due)
+	}
+}
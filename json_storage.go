@@ -1,85 +1,292 @@
 package omniq
 
 import (
+	"cmp"
 	"encoding/json"
 	"os"
+	"slices"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type jsonEntry struct {
-	ID    JobID
-	Time  time.Time
-	State any
-	Type  string
+	ID   JobID
+	Time time.Time
+	storedPayload
+	Type     string
+	Queue    string `json:",omitempty"`
+	Attempts int    `json:",omitempty"`
+}
+
+type jsonStorageOptions struct {
+	codec Codec
+}
+
+type jsonStorageOption func(*jsonStorageOptions)
+
+// WithJSONStorageCodec sets the codec jobs are encoded with, unless they name
+// their own. Payloads of other codecs are stored base64-encoded.
+func WithJSONStorageCodec(c Codec) jsonStorageOption {
+	return func(opts *jsonStorageOptions) {
+		opts.codec = c
+	}
 }
 
 type jsonStorage[T any] struct {
+	mu       sync.Mutex
 	fileName string
 	factory  JobFactory[T]
+	options  jsonStorageOptions
+	history  *historyFile
+	dead     *deadLetterFile
 }
 
-func NewJSONStorage[T any](fileName string, factory JobFactory[T]) *jsonStorage[T] {
-	os.Create(fileName)
+func NewJSONStorage[T any](fileName string, factory JobFactory[T], opts ...jsonStorageOption) *jsonStorage[T] {
+	options := jsonStorageOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	// Create the file if it is missing, keeping the jobs of an existing one
+	if f, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY, 0644); err == nil {
+		f.Close()
+	}
 
-	return &jsonStorage[T]{fileName: fileName, factory: factory}
+	return &jsonStorage[T]{fileName: fileName, factory: factory, options: options, history: newHistoryFile(fileName + ".history"), dead: newDeadLetterFile(fileName + ".dead")}
 }
 
-func (s *jsonStorage[T]) Push(j Job[T], t time.Time) error {
+func (s *jsonStorage[T]) read() ([]jsonEntry, error) {
 	content, err := os.ReadFile(s.fileName)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	entries := []jsonEntry{}
-	json.Unmarshal(content, &entries)
+	if len(content) == 0 {
+		return entries, nil
+	}
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (s *jsonStorage[T]) write(entries []jsonEntry) error {
+	content, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.fileName, content, 0644)
+}
+
+func (s *jsonStorage[T]) jobCodec() Codec {
+	return s.options.codec
+}
+
+func (s *jsonStorage[T]) Push(j Job[T], t time.Time) error {
+	payload, err := encodeJob(j, s.options.codec)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	j.GetIDContainer().SetID(JobID(uuid.New().String()))
-	entries = append(entries, jsonEntry{ID: j.GetIDContainer().GetID(), Time: t, State: j, Type: j.Type()})
-	content, err = json.Marshal(entries)
+	entries, err := s.read()
 	if err != nil {
 		return err
 	}
-	os.WriteFile(s.fileName, content, 0644)
+
+	id := JobID(uuid.New().String())
+	entries = append(entries, jsonEntry{ID: id, Time: t, storedPayload: newStoredPayload(payload), Type: j.Type(), Queue: jobQueue(j)})
+	if err := s.write(entries); err != nil {
+		return err
+	}
+	j.GetIDContainer().SetID(id)
 	return nil
 }
 
-func (s *jsonStorage[T]) Delete(id JobID) error {
-	content, err := os.ReadFile(s.fileName)
+func (s *jsonStorage[T]) PushRetry(j Job[T], t time.Time, attempts int) error {
+	payload, err := encodeJob(j, s.options.codec)
 	if err != nil {
 		return err
 	}
-	entries := []jsonEntry{}
-	json.Unmarshal(content, &entries)
-	for t, e := range entries {
-		if e.ID == id {
-			entries = append(entries[:t], entries[t+1:]...)
-			break
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	id := j.GetIDContainer().GetID()
+	entries = slices.DeleteFunc(entries, func(e jsonEntry) bool { return e.ID == id })
+	entries = append(entries, jsonEntry{ID: id, Time: t, storedPayload: newStoredPayload(payload), Type: j.Type(), Queue: jobQueue(j), Attempts: attempts})
+	return s.write(entries)
+}
+
+// PushMany enqueues all jobs with a single write of the file.
+func (s *jsonStorage[T]) PushMany(items []Scheduled[T]) ([]JobID, error) {
+	errs := &BulkError{}
+	payloads := encodeScheduled(items, s.options.codec, errs)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]JobID, len(items))
+	for i, item := range items {
+		if payloads[i].Codec == "" {
+			continue
+		}
+		ids[i] = JobID(uuid.New().String())
+		entries = append(entries, jsonEntry{ID: ids[i], Time: item.At, storedPayload: newStoredPayload(payloads[i]), Type: item.Job.Type(), Queue: jobQueue(item.Job)})
+	}
+	if err := s.write(entries); err != nil {
+		return nil, err
+	}
+	for i, item := range items {
+		if ids[i] != "" {
+			item.Job.GetIDContainer().SetID(ids[i])
 		}
 	}
-	content, err = json.Marshal(entries)
+	return ids, errs.err()
+}
+
+func (s *jsonStorage[T]) Delete(id JobID) error {
+	return s.DeleteMany([]JobID{id})
+}
+
+func (s *jsonStorage[T]) DeleteMany(ids []JobID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.read()
 	if err != nil {
 		return err
 	}
-	os.WriteFile(s.fileName, content, 0644)
-	return nil
+
+	remove := make(map[JobID]bool, len(ids))
+	for _, id := range ids {
+		remove[id] = true
+	}
+	kept := entries[:0]
+	for _, e := range entries {
+		if !remove[e.ID] {
+			kept = append(kept, e)
+		}
+	}
+	return s.write(kept)
 }
 
 func (s *jsonStorage[T]) GetDue() ([]Job[T], error) {
-	now := time.Now()
-	due := []Job[T]{}
-	entries := []jsonEntry{}
-	content, err := os.ReadFile(s.fileName)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.read()
 	if err != nil {
 		return nil, err
 	}
-	json.Unmarshal(content, &entries)
+
+	now := time.Now()
+	due := []jsonEntry{}
+	for i, e := range entries {
+		if !e.Time.After(now) {
+			due = append(due, e)
+			entries[i].Time = now.Add(claimLease)
+			entries[i].Attempts++
+		}
+	}
+	if len(due) == 0 {
+		return []Job[T]{}, nil
+	}
+	if err := s.write(entries); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(due, func(a, b int) bool { return due[a].Time.Before(due[b].Time) })
+	jobs := make([]Job[T], 0, len(due))
+	for _, e := range due {
+		jobs = append(jobs, instantiateClaimed(s.factory, e.Type, e.ID, e.payload(), e.Attempts+1))
+	}
+	return jobs, nil
+}
+
+func (s *jsonStorage[T]) NextDue() (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.read()
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	var next time.Time
 	for _, e := range entries {
-		if e.Time.Before(now) {
-			j := s.factory.Instantiate(e.Type, e.ID, e.State.(string))
-			due = append(due, j)
+		if next.IsZero() || e.Time.Before(next) {
+			next = e.Time
 		}
 	}
-	return due, nil
+	return next, !next.IsZero(), nil
+}
+
+func (s *jsonStorage[T]) Query(f JobFilter) (JobPage, error) {
+	s.mu.Lock()
+	entries, err := s.read()
+	s.mu.Unlock()
+	if err != nil {
+		return JobPage{}, err
+	}
+
+	jobs := make([]JobInfo, len(entries))
+	for i, e := range entries {
+		jobs[i] = JobInfo{ID: e.ID, Type: e.Type, Queue: cmp.Or(e.Queue, DefaultQueue), DueAt: e.Time, Attempts: e.Attempts, Payload: e.payload()}
+	}
+	return queryJobs(jobs, f, time.Now())
+}
+
+// DeadLetter moves the job to fileName + ".dead".
+func (s *jsonStorage[T]) DeadLetter(id JobID, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.read()
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(entries, func(e jsonEntry) bool { return e.ID == id })
+	if i < 0 {
+		return nil
+	}
+	e := entries[i]
+	err = s.dead.add(deadLetterEntry{ID: e.ID, Type: e.Type, Queue: cmp.Or(e.Queue, DefaultQueue), storedPayload: e.storedPayload, Attempts: e.Attempts, Error: reason, FailedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+	return s.write(slices.Delete(entries, i, i+1))
+}
+
+func (s *jsonStorage[T]) DeadLetters() ([]DeadLetter, error) {
+	return s.dead.list()
+}
+
+// Archive appends the record to fileName + ".history".
+func (s *jsonStorage[T]) Archive(rec HistoryRecord) error {
+	return s.history.archive(rec)
+}
+
+func (s *jsonStorage[T]) History(id JobID) ([]HistoryRecord, error) {
+	return s.history.history(id)
+}
+
+func (s *jsonStorage[T]) PruneHistory(before time.Time, keep int) (int, error) {
+	return s.history.prune(before, keep)
 }
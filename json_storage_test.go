@@ -0,0 +1,33 @@
+package omniq_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eugen-bondarev/omniq"
+	"github.com/eugen-bondarev/omniq/storagetest"
+)
+
+func TestJSONStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, factory omniq.JobFactory[struct{}]) omniq.SchedulerStorage[struct{}] {
+		return omniq.NewJSONStorage(filepath.Join(t.TempDir(), "jobs.json"), factory)
+	})
+}
+
+func TestJSONStorageReopen(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "jobs.json")
+	s := omniq.NewJSONStorage(fileName, &storagetest.Factory{})
+	if err := s.Push(&storagetest.TextJob{Text: "kept"}, time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+
+	s = omniq.NewJSONStorage(fileName, &storagetest.Factory{})
+	due, err := s.GetDue()
+	if err != nil {
+		t.Fatalf("GetDue: %v", err)
+	}
+	if len(due) != 1 || due[0].(*storagetest.TextJob).Text != "kept" {
+		t.Errorf("GetDue returned %v after reopening, want the job pushed before", due)
+	}
+}
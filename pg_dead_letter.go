@@ -0,0 +1,78 @@
+package omniq
+
+import (
+	"context"
+	"time"
+)
+
+// pgDeadLetterSQL moves a job to the dead letter table in one statement. It
+// takes the ID, the reason and the time of failure.
+func pgDeadLetterSQL(o pgStorageOptions) string {
+	return `WITH moved AS (
+  DELETE FROM ` + o.table() + ` WHERE id = $1 RETURNING id, type, queue, state, codec, version, payload, attempts
+)
+INSERT INTO ` + o.qualify(o.deadLetterTable) + ` (id, type, queue, state, codec, version, payload, attempts, error, failed_at)
+SELECT id, type, queue, state, codec, version, payload, attempts, $2, $3 FROM moved`
+}
+
+func pgDeadLettersSQL(o pgStorageOptions) string {
+	return "SELECT id, type, queue, state, codec, version, payload, attempts, error, failed_at FROM " +
+		o.qualify(o.deadLetterTable) + " ORDER BY failed_at"
+}
+
+func pgScanDeadLetter(row pgScanner) (DeadLetter, error) {
+	var d DeadLetter
+	var id, codec string
+	var version int
+	var state, payload []byte
+	err := row.Scan(&id, &d.Type, &d.Queue, &state, &codec, &version, &payload, &d.Attempts, &d.Error, &d.FailedAt)
+	d.ID = JobID(id)
+	d.Payload = pgPayload(state, codec, version, payload)
+	return d, err
+}
+
+func (s *pgStorage[T]) DeadLetter(id JobID, reason string) error {
+	_, err := s.db.Exec(pgDeadLetterSQL(s.options), string(id), reason, time.Now())
+	return err
+}
+
+func (s *pgStorage[T]) DeadLetters() ([]DeadLetter, error) {
+	rows, err := s.db.Query(pgDeadLettersSQL(s.options))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	letters := []DeadLetter{}
+	for rows.Next() {
+		d, err := pgScanDeadLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, d)
+	}
+	return letters, rows.Err()
+}
+
+func (s *pgxStorage[T]) DeadLetter(id JobID, reason string) error {
+	_, err := s.pool.Exec(context.Background(), pgDeadLetterSQL(s.options), string(id), reason, time.Now())
+	return err
+}
+
+func (s *pgxStorage[T]) DeadLetters() ([]DeadLetter, error) {
+	rows, err := s.pool.Query(context.Background(), pgDeadLettersSQL(s.options))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	letters := []DeadLetter{}
+	for rows.Next() {
+		d, err := pgScanDeadLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, d)
+	}
+	return letters, rows.Err()
+}
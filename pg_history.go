@@ -0,0 +1,160 @@
+package omniq
+
+import (
+	"context"
+	"time"
+)
+
+func pgArchiveSQL(o pgStorageOptions) string {
+	return "INSERT INTO " + o.qualify(o.historyTable) +
+		" (id, type, state, status, attempts, error, worker, started_at, finished_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)"
+}
+
+func pgHistorySQL(o pgStorageOptions) string {
+	return "SELECT id, type, state, status, attempts, error, worker, started_at, finished_at FROM " +
+		o.qualify(o.historyTable) + " WHERE id = $1 ORDER BY finished_at"
+}
+
+// pgPruneHistoryByAgeSQL only deletes from the default partition of a
+// partitioned history. The other partitions are dropped whole, so a row stays
+// until all of its partition is past the cutoff.
+func pgPruneHistoryByAgeSQL(o pgStorageOptions) string {
+	if o.historyPartitioning != PGPartitionNone {
+		return "DELETE FROM " + o.qualify(pgDefaultPartitionName(o)) + " WHERE finished_at < $1"
+	}
+	return "DELETE FROM " + o.qualify(o.historyTable) + " WHERE finished_at < $1"
+}
+
+// pgPruneHistoryByCountSQL takes the number of rows to keep. Rows finishing at
+// the same instant as the oldest one kept may go with it.
+func pgPruneHistoryByCountSQL(o pgStorageOptions) string {
+	h := o.qualify(o.historyTable)
+	return "DELETE FROM " + h + " WHERE finished_at <= (SELECT finished_at FROM " + h + " ORDER BY finished_at DESC OFFSET $1 LIMIT 1)"
+}
+
+func pgArchiveArgs(rec HistoryRecord) []any {
+	return []any{string(rec.ID), rec.Type, []byte(rec.State), string(rec.Status), rec.Attempts, rec.Error, rec.Worker, rec.StartedAt, rec.FinishedAt}
+}
+
+type pgScanner interface {
+	Scan(dest ...any) error
+}
+
+func pgScanHistory(row pgScanner) (HistoryRecord, error) {
+	var rec HistoryRecord
+	var id, status string
+	var state []byte
+	err := row.Scan(&id, &rec.Type, &state, &status, &rec.Attempts, &rec.Error, &rec.Worker, &rec.StartedAt, &rec.FinishedAt)
+	rec.ID = JobID(id)
+	rec.State = state
+	rec.Status = JobStatus(status)
+	return rec, err
+}
+
+func (s *pgStorage[T]) Archive(rec HistoryRecord) error {
+	_, err := s.db.Exec(pgArchiveSQL(s.options), pgArchiveArgs(rec)...)
+	return err
+}
+
+func (s *pgStorage[T]) History(id JobID) ([]HistoryRecord, error) {
+	rows, err := s.db.Query(pgHistorySQL(s.options), string(id))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recs := []HistoryRecord{}
+	for rows.Next() {
+		rec, err := pgScanHistory(rows)
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+	return recs, rows.Err()
+}
+
+// PruneHistory also maintains the history partitions, see WithHistoryPartitioning.
+// Rows in dropped partitions are not included in the count.
+func (s *pgStorage[T]) PruneHistory(before time.Time, keep int) (int, error) {
+	if s.options.historyPartitioning != PGPartitionNone {
+		if err := s.maintainHistoryPartitions(before); err != nil {
+			return 0, err
+		}
+	}
+	return pgPruneHistory(before, keep, func(query string, arg any) (int64, error) {
+		res, err := s.db.Exec(query, arg)
+		if err != nil {
+			return 0, err
+		}
+		return res.RowsAffected()
+	}, s.options)
+}
+
+func (s *pgxStorage[T]) Archive(rec HistoryRecord) error {
+	_, err := s.pool.Exec(context.Background(), pgArchiveSQL(s.options), pgArchiveArgs(rec)...)
+	return err
+}
+
+func (s *pgxStorage[T]) History(id JobID) ([]HistoryRecord, error) {
+	rows, err := s.pool.Query(context.Background(), pgHistorySQL(s.options), string(id))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recs := []HistoryRecord{}
+	for rows.Next() {
+		rec, err := pgScanHistory(rows)
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+	return recs, rows.Err()
+}
+
+// PruneHistory also maintains the history partitions, see WithHistoryPartitioning.
+// Rows in dropped partitions are not included in the count.
+func (s *pgxStorage[T]) PruneHistory(before time.Time, keep int) (int, error) {
+	if s.options.historyPartitioning != PGPartitionNone {
+		if err := s.maintainHistoryPartitions(before); err != nil {
+			return 0, err
+		}
+	}
+	return pgPruneHistory(before, keep, func(query string, arg any) (int64, error) {
+		tag, err := s.pool.Exec(context.Background(), query, arg)
+		return tag.RowsAffected(), err
+	}, s.options)
+}
+
+func (s *pgStorage[T]) maintainHistoryPartitions(before time.Time) error {
+	return pgWithTx(s.db, func(tx pgSchemaConn) error {
+		return pgMaintainHistoryPartitions(tx, s.options, time.Now(), before)
+	})
+}
+
+func (s *pgxStorage[T]) maintainHistoryPartitions(before time.Time) error {
+	return pgxWithTx(s.pool, func(tx pgSchemaConn) error {
+		return pgMaintainHistoryPartitions(tx, s.options, time.Now(), before)
+	})
+}
+
+func pgPruneHistory(before time.Time, keep int, exec func(query string, arg any) (int64, error), o pgStorageOptions) (int, error) {
+	var removed int64
+	if !before.IsZero() {
+		n, err := exec(pgPruneHistoryByAgeSQL(o), before)
+		if err != nil {
+			return 0, err
+		}
+		removed += n
+	}
+	if keep > 0 {
+		n, err := exec(pgPruneHistoryByCountSQL(o), keep)
+		if err != nil {
+			return int(removed), err
+		}
+		removed += n
+	}
+	return int(removed), nil
+}
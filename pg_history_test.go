@@ -0,0 +1,97 @@
+package omniq_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/eugen-bondarev/omniq"
+	"github.com/eugen-bondarev/omniq/storagetest"
+)
+
+// TestPGStorageHistoryPartitioning converts an existing history table and
+// checks that pruning drops whole partitions and deletes rows by age only
+// from the default partition.
+func TestPGStorageHistoryPartitioning(t *testing.T) {
+	db, schema := openTestDB(t)
+	archive := func(s omniq.HistoryStorage, finished time.Time) omniq.JobID {
+		t.Helper()
+		id := omniq.JobID(uuid.New().String())
+		rec := omniq.HistoryRecord{ID: id, Type: "TextJob", State: []byte("{}"), Status: omniq.JobSucceeded, Worker: "test", StartedAt: finished, FinishedAt: finished}
+		if err := s.Archive(rec); err != nil {
+			t.Fatalf("Archive: %v", err)
+		}
+		return id
+	}
+	partitions := func() []string {
+		t.Helper()
+		rows, err := db.Query("SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid WHERE i.inhparent = $1::regclass ORDER BY 1", schema+".omniq_jobs_history")
+		if err != nil {
+			t.Fatalf("listing partitions: %v", err)
+		}
+		defer rows.Close()
+		var names []string
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, name)
+		}
+		return names
+	}
+	partition := func(day time.Time) string {
+		return "omniq_jobs_history_p" + day.Format("20060102")
+	}
+
+	plain, err := omniq.NewPGStorage(db, &storagetest.Factory{}, omniq.WithSchema(schema))
+	if err != nil {
+		t.Fatalf("NewPGStorage: %v", err)
+	}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	old := archive(plain, today.AddDate(0, 0, -10))
+
+	s, err := omniq.NewPGStorage(db, &storagetest.Factory{}, omniq.WithSchema(schema), omniq.WithHistoryPartitioning(omniq.PGPartitionDaily))
+	if err != nil {
+		t.Fatalf("NewPGStorage converting the history: %v", err)
+	}
+	want := []string{"omniq_jobs_history_default"}
+	for i := range 4 {
+		want = append(want, partition(today.AddDate(0, 0, i)))
+	}
+	slices.Sort(want)
+	if got := partitions(); !slices.Equal(got, want) {
+		t.Fatalf("after converting, the partitions are %q, want %q", got, want)
+	}
+	if recs, err := s.History(old); err != nil || len(recs) != 1 {
+		t.Fatalf("History of a record from before the conversion returned %v, %v", recs, err)
+	}
+
+	current := archive(s, today.Add(time.Hour))
+	straddling := archive(s, today.AddDate(0, 0, 3).Add(time.Hour))
+	unpartitioned := archive(s, today.AddDate(0, 0, -2))
+
+	// Partitions up to the one starting in three days end before the cutoff
+	n, err := s.PruneHistory(today.AddDate(0, 0, 3).Add(2*time.Hour), 0)
+	if err != nil {
+		t.Fatalf("PruneHistory: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("PruneHistory deleted %d rows, want the 2 in the default partition", n)
+	}
+	want = []string{"omniq_jobs_history_default", partition(today.AddDate(0, 0, 3))}
+	if got := partitions(); !slices.Equal(got, want) {
+		t.Errorf("after pruning, the partitions are %q, want %q", got, want)
+	}
+	for id, kept := range map[omniq.JobID]bool{old: false, unpartitioned: false, current: false, straddling: true} {
+		recs, err := s.History(id)
+		if err != nil {
+			t.Fatalf("History: %v", err)
+		}
+		if (len(recs) == 1) != kept {
+			t.Errorf("History(%s) returned %d records after pruning, want kept = %v", id, len(recs), kept)
+		}
+	}
+}
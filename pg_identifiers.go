@@ -0,0 +1,133 @@
+package omniq
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// pgMaxIdentifierLength is NAMEDATALEN - 1 on a default postgres build.
+const pgMaxIdentifierLength = 63
+
+var pgIdentifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// WithSchema places the tables in the given schema instead of the first one on
+// the search path.
+func WithSchema(schema string) pgStorageOption {
+	return func(opts *pgStorageOptions) {
+		opts.schema = schema
+	}
+}
+
+// WithDeadLetterTableName names the table for jobs that cannot be run. It
+// defaults to the jobs table name with a "_dead" suffix.
+func WithDeadLetterTableName(tableName string) pgStorageOption {
+	return func(opts *pgStorageOptions) {
+		opts.deadLetterTable = tableName
+	}
+}
+
+// WithHistoryTableName names the table for finished jobs. It defaults to the
+// jobs table name with a "_history" suffix.
+func WithHistoryTableName(tableName string) pgStorageOption {
+	return func(opts *pgStorageOptions) {
+		opts.historyTable = tableName
+	}
+}
+
+// validate checks the batch size, fills in the derived table names and
+// normalizes all of them, see pgNormalizeIdentifier.
+func (o *pgStorageOptions) validate() error {
+	if o.batchSize < 1 {
+		return fmt.Errorf("omniq: batch size %d would never claim a job, it must be at least 1", o.batchSize)
+	}
+	if o.deadLetterTable == "" {
+		o.deadLetterTable = o.tableName + "_dead"
+	}
+	if o.historyTable == "" {
+		o.historyTable = o.tableName + "_history"
+	}
+	o.migrationLock = pgMigrationLock(*o)
+
+	names := []*string{&o.tableName, &o.deadLetterTable, &o.historyTable}
+	if o.schema != "" {
+		names = append(names, &o.schema)
+	}
+	for _, name := range names {
+		normalized, err := pgNormalizeIdentifier(*name)
+		if err != nil {
+			return err
+		}
+		*name = normalized
+	}
+
+	// Postgres would cut longer names short, so two long table names could
+	// end up sharing an index or migrations table, and refuses to notify on
+	// longer channels
+	for _, derived := range pgDerivedNames(*o) {
+		if len(derived) > pgMaxIdentifierLength {
+			return fmt.Errorf("omniq: invalid identifier %q derived from the options: longer than %d characters", derived, pgMaxIdentifierLength)
+		}
+	}
+	return nil
+}
+
+// pgDerivedNames lists the names of the migrations table, indexes and
+// partitions, which are built from the table names, and the notify channel,
+// which defaults to the schema and the table name.
+func pgDerivedNames(o pgStorageOptions) []string {
+	names := []string{
+		o.channel(),
+		pgMigrationsTableName(o),
+		o.tableName + "_time_idx",
+		o.historyTable + "_id_idx",
+		o.historyTable + "_finished_at_idx",
+	}
+	if o.historyPartitioning != PGPartitionNone {
+		names = append(names,
+			pgPartitionName(o, time.Time{}),
+			pgDefaultPartitionName(o)+"_id_idx",
+			pgDefaultPartitionName(o)+"_finished_at_idx",
+		)
+	}
+	return names
+}
+
+// pgNormalizeIdentifier rejects names that are not plain identifiers and folds
+// the rest to lower case, the way postgres treats unquoted identifiers, so
+// quoting them does not change which table they refer to.
+func pgNormalizeIdentifier(name string) (string, error) {
+	if !pgIdentifierPattern.MatchString(name) {
+		return "", fmt.Errorf("omniq: invalid identifier %q: must consist of letters, digits and underscores and not start with a digit", name)
+	}
+	if len(name) > pgMaxIdentifierLength {
+		return "", fmt.Errorf("omniq: invalid identifier %q: longer than %d characters", name, pgMaxIdentifierLength)
+	}
+	return strings.ToLower(name), nil
+}
+
+// pgQuoteIdent quotes a single identifier.
+func pgQuoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// qualify quotes name and prefixes it with the schema, if one is set.
+func (o pgStorageOptions) qualify(name string) string {
+	if o.schema == "" {
+		return pgQuoteIdent(name)
+	}
+	return pgQuoteIdent(o.schema) + "." + pgQuoteIdent(name)
+}
+
+func (o pgStorageOptions) table() string {
+	return o.qualify(o.tableName)
+}
+
+// identifier returns the pending table as a pgx.Identifier-style slice.
+func (o pgStorageOptions) identifier() []string {
+	if o.schema == "" {
+		return []string{o.tableName}
+	}
+	return []string{o.schema, o.tableName}
+}
@@ -0,0 +1,83 @@
+package omniq
+
+type PGNotificationKind int
+
+const (
+	PGNotify PGNotificationKind = iota
+	// PGDisconnected means notifications may be lost until PGReconnected.
+	PGDisconnected
+	PGReconnected
+)
+
+type PGNotification struct {
+	Kind    PGNotificationKind
+	Payload string
+}
+
+// PGListener delivers notifications from a dedicated LISTEN connection. It is
+// usually a thin wrapper around pq.Listener or a pgx connection, see
+// examples/postgres for one.
+type PGListener interface {
+	Listen(channel string) error
+	Notifications() <-chan PGNotification
+}
+
+// WithListener makes pgStorage wake the scheduler on NOTIFY instead of having
+// it poll. Every pgStorage notifies on push whether it listens or not.
+func WithListener(l PGListener) pgStorageOption {
+	return func(opts *pgStorageOptions) {
+		opts.listener = l
+	}
+}
+
+// WithNotifyChannel overrides the channel used for NOTIFY, which defaults to
+// the table name.
+func WithNotifyChannel(channel string) pgStorageOption {
+	return func(opts *pgStorageOptions) {
+		opts.notifyChannel = channel
+	}
+}
+
+func (o pgStorageOptions) channel() string {
+	if o.notifyChannel != "" {
+		return o.notifyChannel
+	}
+	if o.schema != "" {
+		return o.schema + "." + o.tableName
+	}
+	return o.tableName
+}
+
+func (s *pgStorage[T]) startListening() error {
+	if err := s.options.listener.Listen(s.options.channel()); err != nil {
+		return err
+	}
+	s.listening.Store(true)
+
+	go s.watch()
+	return nil
+}
+
+// watch turns notifications into wake-ups. The scheduler asks NextDue after
+// every wake-up, so a wake-up is all a push or a reconnect needs to cause.
+func (s *pgStorage[T]) watch() {
+	for n := range s.options.listener.Notifications() {
+		switch n.Kind {
+		case PGDisconnected:
+			s.listening.Store(false)
+		case PGReconnected:
+			s.listening.Store(true)
+		}
+		s.waker.wake()
+	}
+	s.listening.Store(false)
+	s.waker.wake()
+}
+
+func (s *pgStorage[T]) Wakeup() <-chan struct{} {
+	return s.waker.C()
+}
+
+func (s *pgStorage[T]) Listening() bool {
+	return s.listening.Load()
+}
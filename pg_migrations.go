@@ -0,0 +1,311 @@
+package omniq
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrSchemaOutdated = errors.New("omniq: database schema is outdated, run the migrations")
+
+type pgMigration struct {
+	version int
+	name    string
+	up      func(o pgStorageOptions) []string
+}
+
+// pgMigrations must only ever be appended to. Deployments record the versions
+// they applied, so editing an existing entry does not reach them.
+var pgMigrations = []pgMigration{
+	{
+		version: 1,
+		name:    "create jobs table",
+		up: func(o pgStorageOptions) []string {
+			return []string{fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+  id UUID NOT NULL,
+  time TIMESTAMPTZ NOT NULL,
+  state JSONB NOT NULL DEFAULT '{}',
+  type VARCHAR NOT NULL
+)`, o.table())}
+		},
+	},
+	{
+		// Claims move the due time past the lease and finished jobs are
+		// deleted, so every row is pending and a plain index on time is what
+		// the claim query needs.
+		version: 2,
+		name:    "add primary key and due time index",
+		up: func(o pgStorageOptions) []string {
+			return []string{
+				fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (id)", o.table()),
+				fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (time)", pgQuoteIdent(o.tableName+"_time_idx"), o.table()),
+			}
+		},
+	},
+	{
+		version: 3,
+		name:    "create history table",
+		up: func(o pgStorageOptions) []string {
+			history := o.qualify(o.historyTable)
+			return []string{
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+  id UUID NOT NULL,
+  type VARCHAR NOT NULL,
+  state JSONB NOT NULL DEFAULT '{}',
+  status VARCHAR NOT NULL,
+  attempts INT NOT NULL,
+  error TEXT NOT NULL DEFAULT '',
+  worker VARCHAR NOT NULL,
+  started_at TIMESTAMPTZ NOT NULL,
+  finished_at TIMESTAMPTZ NOT NULL
+)`, history),
+				fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (id)", pgQuoteIdent(o.historyTable+"_id_idx"), history),
+				fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (finished_at)", pgQuoteIdent(o.historyTable+"_finished_at_idx"), history),
+			}
+		},
+	},
+	{
+		// Attempts counts claims, which tells claimed jobs from ones that are
+		// merely scheduled for later.
+		version: 4,
+		name:    "add queue and attempts",
+		up: func(o pgStorageOptions) []string {
+			return []string{
+				fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS queue VARCHAR NOT NULL DEFAULT '%s'", o.table(), DefaultQueue),
+				fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0", o.table()),
+			}
+		},
+	},
+	{
+		// JSON payloads stay in state, where JobFilter.Payload can match them;
+		// other codecs write payload and leave state empty.
+		version: 5,
+		name:    "add codec and binary payload",
+		up: func(o pgStorageOptions) []string {
+			return []string{
+				fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS codec VARCHAR NOT NULL DEFAULT 'json'", o.table()),
+				fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS payload BYTEA", o.table()),
+			}
+		},
+	},
+	{
+		version: 6,
+		name:    "create dead letter table",
+		up: func(o pgStorageOptions) []string {
+			return []string{fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+  id UUID PRIMARY KEY,
+  type VARCHAR NOT NULL,
+  queue VARCHAR NOT NULL,
+  state JSONB NOT NULL DEFAULT '{}',
+  codec VARCHAR NOT NULL,
+  payload BYTEA,
+  attempts INT NOT NULL,
+  error TEXT NOT NULL,
+  failed_at TIMESTAMPTZ NOT NULL
+)`, o.qualify(o.deadLetterTable))}
+		},
+	},
+	{
+		// Rows stored before versioning are version 1, like jobs that do not
+		// implement Versioned.
+		version: 7,
+		name:    "add payload version",
+		up: func(o pgStorageOptions) []string {
+			return []string{
+				fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1", o.table()),
+				fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1", o.qualify(o.deadLetterTable)),
+			}
+		},
+	},
+}
+
+// WithAutoMigrate controls whether NewPGStorage applies pending migrations.
+// Disable it when the application's role may not run DDL; NewPGStorage then
+// only checks that the schema is current and fails with ErrSchemaOutdated.
+func WithAutoMigrate(enabled bool) pgStorageOption {
+	return func(opts *pgStorageOptions) {
+		opts.autoMigrate = enabled
+	}
+}
+
+func pgMigrationsTableName(o pgStorageOptions) string {
+	return o.tableName + "_schema_migrations"
+}
+
+func pgMigrationsTable(o pgStorageOptions) string {
+	return o.qualify(pgMigrationsTableName(o))
+}
+
+// pgMigrationLock returns the key of the advisory lock held while migrating,
+// given the table names as passed to the options. Names are folded to lower
+// case, like postgres folds the unquoted table names, so instances that spell
+// them differently still exclude each other.
+func pgMigrationLock(o pgStorageOptions) string {
+	name := pgMigrationsTableName(o)
+	if o.schema != "" {
+		name = o.schema + "." + name
+	}
+	return strings.ToLower(name)
+}
+
+func pgMigrationsTableDDL(o pgStorageOptions) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+  version INT PRIMARY KEY,
+  name VARCHAR NOT NULL,
+  applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`, pgMigrationsTable(o))
+}
+
+// pgSchemaConn is what the migrations need from a connection or transaction,
+// so they run on database/sql and on pgx alike.
+type pgSchemaConn interface {
+	exec(query string, args ...any) error
+	queryInt(query string, args ...any) (int, error)
+	queryStrings(query string, args ...any) ([]string, error)
+}
+
+type sqlSchemaConn struct {
+	q interface {
+		Exec(query string, args ...any) (sql.Result, error)
+		QueryRow(query string, args ...any) *sql.Row
+		Query(query string, args ...any) (*sql.Rows, error)
+	}
+}
+
+func (c sqlSchemaConn) exec(query string, args ...any) error {
+	_, err := c.q.Exec(query, args...)
+	return err
+}
+
+func (c sqlSchemaConn) queryInt(query string, args ...any) (int, error) {
+	var n int
+	err := c.q.QueryRow(query, args...).Scan(&n)
+	return n, err
+}
+
+func (c sqlSchemaConn) queryStrings(query string, args ...any) ([]string, error) {
+	rows, err := c.q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+// pgWithTx runs fn in a transaction that is committed if fn succeeds.
+func pgWithTx(db *sql.DB, fn func(tx pgSchemaConn) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(sqlSchemaConn{tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func pgMigrate(db *sql.DB, o pgStorageOptions) error {
+	return pgWithTx(db, func(tx pgSchemaConn) error {
+		return pgApplyMigrations(tx, o)
+	})
+}
+
+// pgApplyMigrations applies all pending migrations inside the caller's
+// transaction. The advisory lock serializes instances that start at the same
+// time, see pgMigrationLock.
+func pgApplyMigrations(tx pgSchemaConn, o pgStorageOptions) error {
+	if err := tx.exec("SELECT pg_advisory_xact_lock(hashtext($1))", o.migrationLock); err != nil {
+		return err
+	}
+	if o.schema != "" {
+		if err := tx.exec("CREATE SCHEMA IF NOT EXISTS " + pgQuoteIdent(o.schema)); err != nil {
+			return err
+		}
+	}
+	if err := tx.exec(pgMigrationsTableDDL(o)); err != nil {
+		return err
+	}
+
+	current, err := tx.queryInt("SELECT COALESCE(MAX(version), 0) FROM " + pgMigrationsTable(o))
+	if err != nil {
+		return err
+	}
+
+	for _, m := range pgMigrations {
+		if m.version <= current {
+			continue
+		}
+		for _, stmt := range m.up(o) {
+			if err := tx.exec(stmt); err != nil {
+				return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+			}
+		}
+		err := tx.exec("INSERT INTO "+pgMigrationsTable(o)+" (version, name) VALUES ($1, $2)", m.version, m.name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func pgCheckSchema(conn pgSchemaConn, o pgStorageOptions) error {
+	current, err := conn.queryInt("SELECT COALESCE(MAX(version), 0) FROM " + pgMigrationsTable(o))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSchemaOutdated, err)
+	}
+	if latest := pgMigrations[len(pgMigrations)-1].version; current < latest {
+		return fmt.Errorf("%w: at version %d, want %d", ErrSchemaOutdated, current, latest)
+	}
+	return nil
+}
+
+// PGMigrationScript renders the migrations after version from as a single SQL
+// script, for applying them by hand or from a deployment pipeline. It accepts
+// the same options as NewPGStorage; only the ones naming tables and
+// WithHistoryPartitioning matter. With partitioning, the script converts the
+// history table, and the storage creates the partitions when it starts.
+func PGMigrationScript(from int, opts ...pgStorageOption) (string, error) {
+	o := newDefaultPGStorageOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := o.validate(); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("BEGIN;\n\n")
+	fmt.Fprintf(&b, "SELECT pg_advisory_xact_lock(hashtext('%s'));\n\n", o.migrationLock)
+	if o.schema != "" {
+		fmt.Fprintf(&b, "CREATE SCHEMA IF NOT EXISTS %s;\n\n", pgQuoteIdent(o.schema))
+	}
+	fmt.Fprintf(&b, "%s;\n", pgMigrationsTableDDL(o))
+	for _, m := range pgMigrations {
+		if m.version <= from {
+			continue
+		}
+		fmt.Fprintf(&b, "\n-- %d: %s\n", m.version, m.name)
+		for _, stmt := range m.up(o) {
+			fmt.Fprintf(&b, "%s;\n", stmt)
+		}
+		fmt.Fprintf(&b, "INSERT INTO %s (version, name) VALUES (%d, '%s');\n", pgMigrationsTable(o), m.version, m.name)
+	}
+	if o.historyPartitioning != PGPartitionNone {
+		b.WriteString("\n-- history partitioning\n")
+		b.WriteString(pgPartitionHistoryScript(o))
+	}
+	b.WriteString("\nCOMMIT;\n")
+	return b.String(), nil
+}
@@ -0,0 +1,80 @@
+package omniq_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/eugen-bondarev/omniq"
+)
+
+func TestPGMigrationScriptLocks(t *testing.T) {
+	cases := []struct {
+		name   string
+		script func() (string, error)
+		locks  []string
+	}{
+		{"Default", func() (string, error) { return omniq.PGMigrationScript(0) }, []string{"omniq_jobs_schema_migrations"}},
+		{"Schema", func() (string, error) { return omniq.PGMigrationScript(0, omniq.WithSchema("work")) }, []string{"work.omniq_jobs_schema_migrations"}},
+	}
+	for _, c := range cases {
+		script, err := c.script()
+		if err != nil {
+			t.Fatalf("%s: PGMigrationScript: %v", c.name, err)
+		}
+		var got []string
+		for _, line := range strings.Split(script, "\n") {
+			if key, ok := strings.CutPrefix(line, "SELECT pg_advisory_xact_lock(hashtext('"); ok {
+				got = append(got, strings.TrimSuffix(key, "'));"))
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(c.locks, ",") {
+			t.Errorf("%s: the script locks %q, want %q", c.name, got, c.locks)
+		}
+	}
+}
+
+func TestPGMigrationScriptDerivedNames(t *testing.T) {
+	// 48 characters are a valid table name, but not with "_schema_migrations"
+	long := strings.Repeat("j", 48)
+	if _, err := omniq.PGMigrationScript(0, omniq.WithTableName(long)); err == nil {
+		t.Errorf("a table name of %d characters was accepted, leaving no room for its migrations table", len(long))
+	}
+	history := strings.Repeat("h", 40)
+	if _, err := omniq.PGMigrationScript(0, omniq.WithHistoryTableName(history), omniq.WithHistoryPartitioning(omniq.PGPartitionDaily)); err == nil {
+		t.Errorf("a history table name of %d characters was accepted, leaving no room for the indexes of its default partition", len(history))
+	}
+	// The default channel is the schema and the table name, which are valid
+	// on their own
+	if _, err := omniq.PGMigrationScript(0, omniq.WithSchema(strings.Repeat("s", 40)), omniq.WithTableName(strings.Repeat("j", 25))); err == nil {
+		t.Error("a notify channel of 66 characters was accepted")
+	}
+	if _, err := omniq.PGMigrationScript(0, omniq.WithNotifyChannel(strings.Repeat("c", 64))); err == nil {
+		t.Error("WithNotifyChannel accepted 64 characters")
+	}
+	if _, err := omniq.PGMigrationScript(0, omniq.WithTableName(strings.Repeat("j", 30))); err != nil {
+		t.Errorf("PGMigrationScript: %v", err)
+	}
+}
+
+func TestPGMigrationScriptPartitioning(t *testing.T) {
+	script, err := omniq.PGMigrationScript(0, omniq.WithHistoryTableName("finished"), omniq.WithHistoryPartitioning(omniq.PGPartitionWeekly))
+	if err != nil {
+		t.Fatalf("PGMigrationScript: %v", err)
+	}
+	guard := `IF NOT EXISTS (SELECT 1 FROM pg_partitioned_table WHERE partrelid = '"finished"'::regclass) THEN`
+	convert := `CREATE TABLE "finished" (LIKE "finished_default" INCLUDING DEFAULTS) PARTITION BY RANGE (finished_at);`
+	if g, c := strings.Index(script, guard), strings.Index(script, convert); g < 0 || c < g {
+		t.Errorf("the script does not convert the history table once:\n%s", script)
+	}
+	if strings.Index(script, "COMMIT;") < strings.Index(script, convert) {
+		t.Error("the history table is converted outside the transaction")
+	}
+
+	script, err = omniq.PGMigrationScript(0)
+	if err != nil {
+		t.Fatalf("PGMigrationScript: %v", err)
+	}
+	if strings.Contains(script, "PARTITION") {
+		t.Errorf("the script partitions the history table without WithHistoryPartitioning:\n%s", script)
+	}
+}
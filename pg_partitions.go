@@ -0,0 +1,199 @@
+package omniq
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PGPartitionInterval is the range of finish times each history partition covers.
+type PGPartitionInterval int
+
+const (
+	PGPartitionNone PGPartitionInterval = iota
+	PGPartitionDaily
+	PGPartitionWeekly
+)
+
+// pgHistoryPartitionsAhead is how many partitions past the current one are
+// kept ready, so a missed maintenance run does not send rows to the default
+// partition.
+const pgHistoryPartitionsAhead = 3
+
+// pgPartitionSuffix is appended to the history table name, followed by the
+// first day of the partition.
+const (
+	pgPartitionSuffix        = "_p"
+	pgPartitionDateLayout    = "20060102"
+	pgDefaultPartitionSuffix = "_default"
+)
+
+// WithHistoryPartitioning partitions the history table by finish time. The
+// storage converts an existing table on startup, keeps the upcoming partitions
+// created and drops whole partitions once they fall out of the retention
+// window, instead of deleting their rows, so records are kept until the whole
+// partition is past the cutoff. Rows outside every partition, such as those
+// from before the conversion, live in "<history table>_default" and are still
+// pruned row by row.
+//
+// Maintenance runs DDL, so the database role needs to own the history table.
+func WithHistoryPartitioning(interval PGPartitionInterval) pgStorageOption {
+	return func(opts *pgStorageOptions) {
+		opts.historyPartitioning = interval
+	}
+}
+
+// start returns the beginning of the partition containing t.
+func (p PGPartitionInterval) start(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if p == PGPartitionWeekly {
+		// Weeks start on Monday
+		day = day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	}
+	return day
+}
+
+func (p PGPartitionInterval) next(start time.Time) time.Time {
+	if p == PGPartitionWeekly {
+		return start.AddDate(0, 0, 7)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+func pgPartitionName(o pgStorageOptions, start time.Time) string {
+	return o.historyTable + pgPartitionSuffix + start.Format(pgPartitionDateLayout)
+}
+
+func pgDefaultPartitionName(o pgStorageOptions) string {
+	return o.historyTable + pgDefaultPartitionSuffix
+}
+
+// pgMaintainHistoryPartitions converts the history table to a partitioned one
+// if it is not yet, creates the partitions up to pgHistoryPartitionsAhead past
+// now and drops those that end at or before the cutoff. A zero cutoff drops
+// nothing.
+func pgMaintainHistoryPartitions(tx pgSchemaConn, o pgStorageOptions, now, before time.Time) error {
+	history := o.qualify(o.historyTable)
+	if err := tx.exec("SELECT pg_advisory_xact_lock(hashtext($1))", history); err != nil {
+		return err
+	}
+
+	partitioned, err := tx.queryInt("SELECT COUNT(*) FROM pg_partitioned_table WHERE partrelid = $1::regclass", history)
+	if err != nil {
+		return err
+	}
+	if partitioned == 0 {
+		if err := pgPartitionHistory(tx, o); err != nil {
+			return err
+		}
+	}
+
+	start := o.historyPartitioning.start(now)
+	for i := 0; i <= pgHistoryPartitionsAhead; i++ {
+		end := o.historyPartitioning.next(start)
+		if err := pgCreateHistoryPartition(tx, o, start, end); err != nil {
+			return err
+		}
+		start = end
+	}
+
+	if before.IsZero() {
+		return nil
+	}
+	return pgDropHistoryPartitions(tx, o, before)
+}
+
+// pgPartitionHistory swaps the history table for a partitioned one and attaches
+// the old table, rows and indexes included, as its default partition.
+func pgPartitionHistory(tx pgSchemaConn, o pgStorageOptions) error {
+	history := o.qualify(o.historyTable)
+	for _, stmt := range pgPartitionHistorySQL(o) {
+		if err := tx.exec(stmt); err != nil {
+			return fmt.Errorf("partitioning %s: %w", history, err)
+		}
+	}
+	return nil
+}
+
+// pgPartitionHistoryScript renders pgPartitionHistory for PGMigrationScript,
+// under the lock pgMaintainHistoryPartitions takes and guarded so running the
+// script again leaves a partitioned table alone.
+func pgPartitionHistoryScript(o pgStorageOptions) string {
+	history := o.qualify(o.historyTable)
+	var b strings.Builder
+	fmt.Fprintf(&b, "SELECT pg_advisory_xact_lock(hashtext('%s'));\n", history)
+	b.WriteString("DO $$\nBEGIN\n")
+	fmt.Fprintf(&b, "IF NOT EXISTS (SELECT 1 FROM pg_partitioned_table WHERE partrelid = '%s'::regclass) THEN\n", history)
+	for _, stmt := range pgPartitionHistorySQL(o) {
+		fmt.Fprintf(&b, "%s;\n", stmt)
+	}
+	b.WriteString("END IF;\nEND $$;\n")
+	return b.String()
+}
+
+func pgPartitionHistorySQL(o pgStorageOptions) []string {
+	history := o.qualify(o.historyTable)
+	old := pgDefaultPartitionName(o)
+	return []string{
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", history, pgQuoteIdent(old)),
+		fmt.Sprintf("ALTER INDEX %s RENAME TO %s", o.qualify(o.historyTable+"_id_idx"), pgQuoteIdent(old+"_id_idx")),
+		fmt.Sprintf("ALTER INDEX %s RENAME TO %s", o.qualify(o.historyTable+"_finished_at_idx"), pgQuoteIdent(old+"_finished_at_idx")),
+		fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS) PARTITION BY RANGE (finished_at)", history, o.qualify(old)),
+		fmt.Sprintf("CREATE INDEX %s ON %s (id)", pgQuoteIdent(o.historyTable+"_id_idx"), history),
+		fmt.Sprintf("CREATE INDEX %s ON %s (finished_at)", pgQuoteIdent(o.historyTable+"_finished_at_idx"), history),
+		fmt.Sprintf("ALTER TABLE %s ATTACH PARTITION %s DEFAULT", history, o.qualify(old)),
+	}
+}
+
+// pgCreateHistoryPartition creates the partition for [start, end) unless it
+// exists. Postgres refuses a partition whose range already has rows in the
+// default partition; that range stays in the default partition.
+func pgCreateHistoryPartition(tx pgSchemaConn, o pgStorageOptions, start, end time.Time) error {
+	name := pgPartitionName(o, start)
+	exists, err := tx.queryInt("SELECT COUNT(*) FROM pg_class WHERE oid = to_regclass($1)", o.qualify(name))
+	if err != nil || exists > 0 {
+		return err
+	}
+
+	conflicting, err := tx.queryInt(
+		"SELECT COUNT(*) FROM "+o.qualify(pgDefaultPartitionName(o))+" WHERE finished_at >= $1 AND finished_at < $2",
+		start, end,
+	)
+	if err != nil || conflicting > 0 {
+		return err
+	}
+
+	return tx.exec(fmt.Sprintf(
+		"CREATE TABLE %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')",
+		o.qualify(name), o.qualify(o.historyTable), start.Format(time.RFC3339), end.Format(time.RFC3339),
+	))
+}
+
+func pgDropHistoryPartitions(tx pgSchemaConn, o pgStorageOptions, before time.Time) error {
+	names, err := tx.queryStrings(
+		"SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid WHERE i.inhparent = $1::regclass",
+		o.qualify(o.historyTable),
+	)
+	if err != nil {
+		return err
+	}
+
+	prefix := o.historyTable + pgPartitionSuffix
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		start, err := time.Parse(pgPartitionDateLayout, strings.TrimPrefix(name, prefix))
+		if err != nil {
+			continue
+		}
+		if o.historyPartitioning.next(start).After(before) {
+			continue
+		}
+		if err := tx.exec("DROP TABLE " + o.qualify(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
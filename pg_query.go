@@ -0,0 +1,147 @@
+package omniq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var pgStateConditions = map[JobState]string{
+	JobDue:       "time <= %[1]s",
+	JobScheduled: "(time > %[1]s AND attempts = 0)",
+	JobClaimed:   "(time > %[1]s AND attempts > 0)",
+}
+
+// pgQuery is a filter rendered as SQL. The page query takes the arguments of
+// the count query followed by the limit and offset.
+type pgQuery struct {
+	count     string
+	page      string
+	countArgs []any
+	pageArgs  []any
+}
+
+func pgQuerySQL(o pgStorageOptions, f JobFilter, now time.Time) (pgQuery, error) {
+	args := []any{}
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	where := []string{"TRUE"}
+	if len(f.Types) > 0 {
+		where = append(where, "type = ANY("+arg(pgArray(f.Types))+"::varchar[])")
+	}
+	if len(f.Queues) > 0 {
+		where = append(where, "queue = ANY("+arg(pgArray(f.Queues))+"::varchar[])")
+	}
+	if len(f.States) > 0 {
+		nowArg := arg(now)
+		states := []string{}
+		for _, state := range f.States {
+			cond, ok := pgStateConditions[state]
+			if !ok {
+				return pgQuery{}, fmt.Errorf("omniq: unknown job state %q", state)
+			}
+			states = append(states, fmt.Sprintf(cond, nowArg))
+		}
+		where = append(where, "("+strings.Join(states, " OR ")+")")
+	}
+	if !f.DueAfter.IsZero() {
+		where = append(where, "time >= "+arg(f.DueAfter))
+	}
+	if !f.DueBefore.IsZero() {
+		where = append(where, "time < "+arg(f.DueBefore))
+	}
+	if len(f.Payload) > 0 {
+		payload, err := json.Marshal(f.Payload)
+		if err != nil {
+			return pgQuery{}, err
+		}
+		where = append(where, "state @> "+arg(string(payload))+"::jsonb")
+	}
+
+	cond := strings.Join(where, " AND ")
+	q := pgQuery{
+		count:     "SELECT COUNT(*) FROM " + o.table() + " WHERE " + cond,
+		page:      "SELECT id, type, queue, time, attempts, state, codec, version, payload FROM " + o.table() + " WHERE " + cond + " ORDER BY time, id",
+		countArgs: args[:len(args):len(args)],
+	}
+	if f.Limit > 0 {
+		q.page += " LIMIT " + arg(f.Limit)
+	}
+	if f.Offset > 0 {
+		q.page += " OFFSET " + arg(f.Offset)
+	}
+	q.pageArgs = args
+	return q, nil
+}
+
+func pgScanJobInfo(row pgScanner, now time.Time) (JobInfo, error) {
+	var info JobInfo
+	var id, codec string
+	var version int
+	var state, payload []byte
+	err := row.Scan(&id, &info.Type, &info.Queue, &info.DueAt, &info.Attempts, &state, &codec, &version, &payload)
+	info.ID = JobID(id)
+	info.Payload = pgPayload(state, codec, version, payload)
+	info.State = jobState(info.DueAt, info.Attempts, now)
+	return info, err
+}
+
+func (s *pgStorage[T]) Query(f JobFilter) (JobPage, error) {
+	now := time.Now()
+	q, err := pgQuerySQL(s.options, f, now)
+	if err != nil {
+		return JobPage{}, err
+	}
+
+	result := JobPage{Jobs: []JobInfo{}}
+	if err := s.db.QueryRow(q.count, q.countArgs...).Scan(&result.Total); err != nil {
+		return JobPage{}, err
+	}
+	rows, err := s.db.Query(q.page, q.pageArgs...)
+	if err != nil {
+		return JobPage{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		info, err := pgScanJobInfo(rows, now)
+		if err != nil {
+			return JobPage{}, err
+		}
+		result.Jobs = append(result.Jobs, info)
+	}
+	return result, rows.Err()
+}
+
+func (s *pgxStorage[T]) Query(f JobFilter) (JobPage, error) {
+	now := time.Now()
+	q, err := pgQuerySQL(s.options, f, now)
+	if err != nil {
+		return JobPage{}, err
+	}
+
+	ctx := context.Background()
+	result := JobPage{Jobs: []JobInfo{}}
+	if err := s.pool.QueryRow(ctx, q.count, q.countArgs...).Scan(&result.Total); err != nil {
+		return JobPage{}, err
+	}
+	rows, err := s.pool.Query(ctx, q.page, q.pageArgs...)
+	if err != nil {
+		return JobPage{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		info, err := pgScanJobInfo(rows, now)
+		if err != nil {
+			return JobPage{}, err
+		}
+		result.Jobs = append(result.Jobs, info)
+	}
+	return result, rows.Err()
+}
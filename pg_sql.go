@@ -0,0 +1,141 @@
+package omniq
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SQL shared by the database/sql and the pgx storages.
+
+const pgNotifySQL = "SELECT pg_notify($1, $2)"
+
+// pgInsertColumnNames are the columns pgInsertSQL fills. state, codec,
+// version and payload come from pgPayloadArgs.
+var pgInsertColumnNames = []string{"id", "time", "state", "codec", "version", "payload", "type", "queue"}
+
+func pgInsertSQL(o pgStorageOptions) string {
+	return "INSERT INTO " + o.table() + " (id, time, state, codec, version, payload, type, queue) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"
+}
+
+// pgRetrySQL takes the parameters of pgInsertSQL followed by the attempts. A
+// job that is still stored is replaced.
+func pgRetrySQL(o pgStorageOptions) string {
+	return "INSERT INTO " + o.table() + " (id, time, state, codec, version, payload, type, queue, attempts) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)" +
+		" ON CONFLICT (id) DO UPDATE SET time = EXCLUDED.time, state = EXCLUDED.state, codec = EXCLUDED.codec, version = EXCLUDED.version," +
+		" payload = EXCLUDED.payload, type = EXCLUDED.type, queue = EXCLUDED.queue, attempts = EXCLUDED.attempts"
+}
+
+// pgInsertChunk is how many rows a multi-row INSERT carries, which keeps it
+// well below the 65535 parameters postgres accepts per statement.
+const pgInsertChunk = 1000
+
+// pgInsertColumns is the number of parameters pgInsertSQL takes per row.
+const pgInsertColumns = 8
+
+// pgInsertManySQL inserts n rows, taking the same parameters as pgInsertSQL
+// for each.
+func pgInsertManySQL(o pgStorageOptions, n int) string {
+	var b strings.Builder
+	b.WriteString("INSERT INTO " + o.table() + " (id, time, state, codec, version, payload, type, queue) VALUES ")
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for c := 1; c <= pgInsertColumns; c++ {
+			if c > 1 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "$%d", pgInsertColumns*i+c)
+		}
+		b.WriteByte(')')
+	}
+	return b.String()
+}
+
+func pgDeleteSQL(o pgStorageOptions) string {
+	return "DELETE FROM " + o.table() + " WHERE id = $1"
+}
+
+// pgDeleteManySQL takes the IDs as an array literal, see pgArray.
+func pgDeleteManySQL(o pgStorageOptions) string {
+	return "DELETE FROM " + o.table() + " WHERE id = ANY($1::uuid[])"
+}
+
+// pgClaimSQL claims the due jobs by moving them past the lease. Rows locked by
+// a concurrent claim are skipped instead of waited for. It takes now, the
+// lease expiry and the batch size.
+func pgClaimSQL(o pgStorageOptions) string {
+	return `WITH due AS (
+  SELECT id, time FROM ` + o.table() + ` WHERE time <= $1 ORDER BY time LIMIT $3 FOR UPDATE SKIP LOCKED
+)
+UPDATE ` + o.table() + ` AS j SET time = $2, attempts = j.attempts + 1 FROM due WHERE j.id = due.id
+RETURNING j.id, due.time, j.state, j.codec, j.version, j.payload, j.type, j.attempts`
+}
+
+func pgNextDueSQL(o pgStorageOptions) string {
+	return "SELECT MIN(time) FROM " + o.table()
+}
+
+type pgClaimedRow struct {
+	id       string
+	t        time.Time
+	state    []byte
+	codec    string
+	version  int
+	payload  []byte
+	typ      string
+	attempts int
+}
+
+// pgEmptyState is what the state column holds for payloads of codecs other
+// than JSON.
+var pgEmptyState = []byte("{}")
+
+// pgPayloadArgs returns the state, codec, version and payload column values
+// of p.
+func pgPayloadArgs(p Payload) (state []byte, codec string, version int, payload []byte) {
+	if p.IsJSON() {
+		return p.Data, JSONCodec.Name(), p.version(), nil
+	}
+	return pgEmptyState, p.Codec, p.version(), p.Data
+}
+
+func pgPayload(state []byte, codec string, version int, payload []byte) Payload {
+	if codec == JSONCodec.Name() {
+		return Payload{Codec: codec, Version: version, Data: state}
+	}
+	return Payload{Codec: codec, Version: version, Data: payload}
+}
+
+// pgInstantiate orders claimed rows by due time, since UPDATE ... RETURNING
+// does not keep the order of the claim, and turns them into jobs.
+func pgInstantiate[T any](factory JobFactory[T], rows []pgClaimedRow) []Job[T] {
+	sort.Slice(rows, func(a, b int) bool { return rows[a].t.Before(rows[b].t) })
+	due := make([]Job[T], 0, len(rows))
+	for _, r := range rows {
+		due = append(due, instantiateClaimed(factory, r.typ, JobID(r.id), pgPayload(r.state, r.codec, r.version, r.payload), r.attempts))
+	}
+	return due
+}
+
+var pgArrayEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// pgArray renders values as a postgres array literal, which every driver can
+// pass as a plain string parameter.
+func pgArray[S ~string](values []S) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, id := range values {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteByte('"')
+		b.WriteString(pgArrayEscaper.Replace(string(id)))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
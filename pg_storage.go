@@ -2,19 +2,31 @@ package omniq
 
 import (
 	"database/sql"
-	"encoding/json"
-	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type pgStorageOptions struct {
-	tableName string
+	schema          string
+	tableName       string
+	deadLetterTable string
+	historyTable    string
+	notifyChannel   string
+	listener        PGListener
+	autoMigrate     bool
+	batchSize       int
+	codec           Codec
+
+	historyPartitioning PGPartitionInterval
+
+	// migrationLock is filled in by validate, see pgMigrationLock
+	migrationLock string
 }
 
 func newDefaultPGStorageOptions() pgStorageOptions {
-	return pgStorageOptions{tableName: "omniq_jobs"}
+	return pgStorageOptions{tableName: "omniq_jobs", autoMigrate: true, batchSize: 100}
 }
 
 type pgStorageOption func(*pgStorageOptions)
@@ -25,10 +37,28 @@ func WithTableName(tableName string) pgStorageOption {
 	}
 }
 
+// WithBatchSize limits how many jobs a single GetDue claims. It must be at
+// least 1.
+func WithBatchSize(n int) pgStorageOption {
+	return func(opts *pgStorageOptions) {
+		opts.batchSize = n
+	}
+}
+
+// WithCodec sets the codec jobs are encoded with, unless they name their own.
+// Only JSON payloads are stored as jsonb; the others go to a bytea column.
+func WithCodec(c Codec) pgStorageOption {
+	return func(opts *pgStorageOptions) {
+		opts.codec = c
+	}
+}
+
 type pgStorage[T any] struct {
-	db      *sql.DB
-	factory JobFactory[T]
-	options pgStorageOptions
+	db        *sql.DB
+	factory   JobFactory[T]
+	options   pgStorageOptions
+	waker     *waker
+	listening atomic.Bool
 }
 
 func NewPGStorage[T any](db *sql.DB, factory JobFactory[T], opts ...pgStorageOption) (*pgStorage[T], error) {
@@ -36,70 +66,183 @@ func NewPGStorage[T any](db *sql.DB, factory JobFactory[T], opts ...pgStorageOpt
 	for _, opt := range opts {
 		opt(&options)
 	}
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
 
-	s := &pgStorage[T]{db: db, factory: factory, options: options}
-	err := s.createTable()
-	if err != nil {
+	s := &pgStorage[T]{db: db, factory: factory, options: options, waker: newWaker()}
+	if options.autoMigrate {
+		if err := s.Migrate(); err != nil {
+			return nil, err
+		}
+	} else if err := pgCheckSchema(sqlSchemaConn{db}, options); err != nil {
 		return nil, err
 	}
+	if options.historyPartitioning != PGPartitionNone {
+		if err := s.maintainHistoryPartitions(time.Time{}); err != nil {
+			return nil, err
+		}
+	}
+	if options.listener != nil {
+		if err := s.startListening(); err != nil {
+			return nil, err
+		}
+	}
 	return s, nil
 }
 
-func (s *pgStorage[T]) createTable() error {
-	cmd := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
-  id UUID NOT NULL,
-  time TIMESTAMPTZ NOT NULL,
-  state JSONB NOT NULL DEFAULT '{}',
-  type VARCHAR NOT NULL
-)`, s.options.tableName)
+// Migrate brings the schema up to date. NewPGStorage calls it unless
+// WithAutoMigrate(false) is given.
+func (s *pgStorage[T]) Migrate() error {
+	return pgMigrate(s.db, s.options)
+}
+
+func (s *pgStorage[T]) jobCodec() Codec {
+	return s.options.codec
+}
+
+func (s *pgStorage[T]) Push(j Job[T], t time.Time) error {
+	return s.PushTx(s.db, j, t)
+}
+
+// PushTx inserts the job through tx, so it only becomes visible if the
+// surrounding transaction commits.
+func (s *pgStorage[T]) PushTx(tx Execer, j Job[T], t time.Time) error {
+	return pgPushTx(tx, s.options, j, t)
+}
 
-	_, err := s.db.Exec(cmd)
+// pgPushTx inserts the job and notifies the listeners through tx.
+func pgPushTx[T any](tx Execer, options pgStorageOptions, j Job[T], t time.Time) error {
+	id := uuid.New().String()
+	payload, err := encodeJob(j, options.codec)
+	if err != nil {
+		return err
+	}
+	state, codec, version, data := pgPayloadArgs(payload)
+	_, err = tx.Exec(pgInsertSQL(options), id, t, state, codec, version, data, j.Type(), jobQueue(j))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(pgNotifySQL, options.channel(), t.Format(time.RFC3339Nano))
 	if err != nil {
 		return err
 	}
+	j.GetIDContainer().SetID(JobID(id))
 	return nil
 }
 
-func (s *pgStorage[T]) Push(j Job[T], t time.Time) error {
-	id := uuid.New().String()
-	state, err := json.Marshal(j)
+func (s *pgStorage[T]) PushRetry(j Job[T], t time.Time, attempts int) error {
+	payload, err := encodeJob(j, s.options.codec)
 	if err != nil {
 		return err
 	}
-	_, err = s.db.Exec("INSERT INTO "+s.options.tableName+" (id, time, state, type) VALUES ($1, $2, $3, $4)", id, t, state, j.Type())
+	state, codec, version, data := pgPayloadArgs(payload)
+	id := string(j.GetIDContainer().GetID())
+	_, err = s.db.Exec(pgRetrySQL(s.options), id, t, state, codec, version, data, j.Type(), jobQueue(j), attempts)
 	if err != nil {
 		return err
 	}
-	return nil
+	_, err = s.db.Exec(pgNotifySQL, s.options.channel(), t.Format(time.RFC3339Nano))
+	return err
+}
+
+// PushMany inserts all jobs in one transaction, up to pgInsertChunk rows per
+// statement, and sends a single notification.
+func (s *pgStorage[T]) PushMany(items []Scheduled[T]) ([]JobID, error) {
+	errs := &BulkError{}
+	payloads := encodeScheduled(items, s.options.codec, errs)
+
+	ids := make([]JobID, len(items))
+	args := make([]any, 0, pgInsertColumns*len(items))
+	var earliest time.Time
+	for i, item := range items {
+		if payloads[i].Codec == "" {
+			continue
+		}
+		ids[i] = JobID(uuid.New().String())
+		state, codec, version, data := pgPayloadArgs(payloads[i])
+		args = append(args, string(ids[i]), item.At, state, codec, version, data, item.Job.Type(), jobQueue(item.Job))
+		if earliest.IsZero() || item.At.Before(earliest) {
+			earliest = item.At
+		}
+	}
+	if len(args) == 0 {
+		return ids, errs.err()
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for len(args) > 0 {
+		chunk := args[:min(len(args), pgInsertColumns*pgInsertChunk)]
+		if _, err := tx.Exec(pgInsertManySQL(s.options, len(chunk)/pgInsertColumns), chunk...); err != nil {
+			return nil, err
+		}
+		args = args[len(chunk):]
+	}
+	if _, err := tx.Exec(pgNotifySQL, s.options.channel(), earliest.Format(time.RFC3339Nano)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	for i, item := range items {
+		if ids[i] != "" {
+			item.Job.GetIDContainer().SetID(ids[i])
+		}
+	}
+	return ids, errs.err()
 }
 
 func (s *pgStorage[T]) Delete(id JobID) error {
-	_, err := s.db.Exec("DELETE FROM "+s.options.tableName+" WHERE id = $1", id)
+	_, err := s.db.Exec(pgDeleteSQL(s.options), string(id))
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+func (s *pgStorage[T]) DeleteMany(ids []JobID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := s.db.Exec(pgDeleteManySQL(s.options), pgArray(ids))
+	return err
+}
+
 func (s *pgStorage[T]) GetDue() ([]Job[T], error) {
-	rows, err := s.db.Query("SELECT id, time, state, type FROM "+s.options.tableName+" WHERE time <= $1", time.Now())
+	now := time.Now()
+	rows, err := s.db.Query(pgClaimSQL(s.options), now, now.Add(claimLease), s.options.batchSize)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	due := []Job[T]{}
+
+	claimed := []pgClaimedRow{}
 	for rows.Next() {
-		var id JobID
-		var t time.Time
-		var state string
-		var typ string
-		err = rows.Scan(&id, &t, &state, &typ)
+		var r pgClaimedRow
+		err = rows.Scan(&r.id, &r.t, &r.state, &r.codec, &r.version, &r.payload, &r.typ, &r.attempts)
 		if err != nil {
 			return nil, err
 		}
-		j := s.factory.Instantiate(typ, id, state)
-		due = append(due, j)
+		claimed = append(claimed, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	return due, nil
+	return pgInstantiate(s.factory, claimed), nil
+}
+
+func (s *pgStorage[T]) NextDue() (time.Time, bool, error) {
+	var next sql.NullTime
+	err := s.db.QueryRow(pgNextDueSQL(s.options)).Scan(&next)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return next.Time, next.Valid, nil
 }
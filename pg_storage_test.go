@@ -0,0 +1,136 @@
+package omniq_test
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/eugen-bondarev/omniq"
+	"github.com/eugen-bondarev/omniq/storagetest"
+)
+
+// pgTestDSNVariable names the database the postgres tests run against. They
+// are skipped without one.
+const pgTestDSNVariable = "OMNIQ_TEST_POSTGRES_DSN"
+
+// openTestDB connects to the test database and creates a schema that is
+// dropped again after the test.
+func openTestDB(tb testing.TB) (*sql.DB, string) {
+	tb.Helper()
+	dsn := os.Getenv(pgTestDSNVariable)
+	if dsn == "" {
+		tb.Skipf("%s is not set", pgTestDSNVariable)
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		tb.Fatalf("opening the database: %v", err)
+	}
+	tb.Cleanup(func() { db.Close() })
+
+	schema := fmt.Sprintf("omniq_test_%d", time.Now().UnixNano())
+	if _, err := db.Exec("CREATE SCHEMA " + schema); err != nil {
+		tb.Fatalf("creating schema: %v", err)
+	}
+	tb.Cleanup(func() { db.Exec("DROP SCHEMA " + schema + " CASCADE") })
+	return db, schema
+}
+
+func TestPGStorage(t *testing.T) {
+	db, base := openTestDB(t)
+	n := 0
+	storagetest.Run(t, func(t *testing.T, factory omniq.JobFactory[struct{}]) omniq.SchedulerStorage[struct{}] {
+		n++
+		schema := fmt.Sprintf("%s_%d", base, n)
+		if _, err := db.Exec("CREATE SCHEMA " + schema); err != nil {
+			t.Fatalf("creating schema: %v", err)
+		}
+		t.Cleanup(func() { db.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+		s, err := omniq.NewPGStorage(db, factory, omniq.WithSchema(schema))
+		if err != nil {
+			t.Fatalf("NewPGStorage: %v", err)
+		}
+		return s
+	})
+}
+
+func TestPGStorageBatchSize(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		if _, err := omniq.NewPGStorage[struct{}](nil, &storagetest.Factory{}, omniq.WithBatchSize(n)); err == nil {
+			t.Errorf("NewPGStorage accepted a batch size of %d", n)
+		}
+	}
+}
+
+// pgBenchmarkRows is how many jobs the table holds while claiming.
+const pgBenchmarkRows = 1_000_000
+
+// BenchmarkPGStorageClaim claims and acknowledges one batch per iteration from
+// a table of a million jobs, either all due (a backlog) or all scheduled for
+// later but a batch, which is where the due time index and the bounded claim
+// matter.
+func BenchmarkPGStorageClaim(b *testing.B) {
+	db, schema := openTestDB(b)
+	s, err := omniq.NewPGStorage(db, &storagetest.Factory{}, omniq.WithSchema(schema))
+	if err != nil {
+		b.Fatalf("NewPGStorage: %v", err)
+	}
+	table := schema + ".omniq_jobs"
+	fill := func(b *testing.B, due string) {
+		b.Helper()
+		if _, err := db.Exec("TRUNCATE " + table); err != nil {
+			b.Fatal(err)
+		}
+		_, err := db.Exec(`INSERT INTO `+table+` (id, time, state, type)
+SELECT gen_random_uuid(), `+due+` + i * interval '1 millisecond', jsonb_build_object('Text', i::text), 'TextJob'
+FROM generate_series(1, $1) AS i`, pgBenchmarkRows)
+		if err != nil {
+			b.Fatalf("filling the table: %v", err)
+		}
+		if _, err := db.Exec("ANALYZE " + table); err != nil {
+			b.Fatal(err)
+		}
+	}
+	claim := func(b *testing.B) {
+		b.Helper()
+		due, err := s.GetDue()
+		if err != nil {
+			b.Fatalf("GetDue: %v", err)
+		}
+		ids := make([]omniq.JobID, len(due))
+		for i, j := range due {
+			ids[i] = j.GetIDContainer().GetID()
+		}
+		if err := s.DeleteMany(ids); err != nil {
+			b.Fatalf("DeleteMany: %v", err)
+		}
+	}
+
+	b.Run("Backlog", func(b *testing.B) {
+		fill(b, "now() - interval '1 hour'")
+		b.ResetTimer()
+		for b.Loop() {
+			claim(b)
+		}
+	})
+	b.Run("Scheduled", func(b *testing.B) {
+		fill(b, "now() + interval '1 day'")
+		items := make([]omniq.Scheduled[struct{}], 100)
+		b.ResetTimer()
+		for b.Loop() {
+			b.StopTimer()
+			for i := range items {
+				items[i] = omniq.Scheduled[struct{}]{Job: &storagetest.TextJob{Text: "due"}, At: time.Now().Add(-time.Second)}
+			}
+			if _, err := s.PushMany(items); err != nil {
+				b.Fatalf("PushMany: %v", err)
+			}
+			b.StartTimer()
+			claim(b)
+		}
+	})
+}
@@ -0,0 +1,328 @@
+package omniq
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// pgxListenRetry is how long the pgx storage waits before re-establishing a
+// lost LISTEN connection.
+const pgxListenRetry = time.Second
+
+type pgxSchemaConn struct {
+	q interface {
+		Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+		QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+		Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	}
+}
+
+func (c pgxSchemaConn) exec(query string, args ...any) error {
+	_, err := c.q.Exec(context.Background(), query, args...)
+	return err
+}
+
+func (c pgxSchemaConn) queryInt(query string, args ...any) (int, error) {
+	var n int
+	err := c.q.QueryRow(context.Background(), query, args...).Scan(&n)
+	return n, err
+}
+
+func (c pgxSchemaConn) queryStrings(query string, args ...any) ([]string, error) {
+	rows, err := c.q.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// pgxWithTx runs fn in a transaction that is committed if fn succeeds.
+func pgxWithTx(pool *pgxpool.Pool, fn func(tx pgSchemaConn) error) error {
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(pgxSchemaConn{tx}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// pgxStorage is pgStorage on top of a pgxpool.Pool. It shares the schema, the
+// migrations and the options with pgStorage, and listens for pushes on a
+// connection of its own, so it needs no PGListener.
+type pgxStorage[T any] struct {
+	pool      *pgxpool.Pool
+	factory   JobFactory[T]
+	options   pgStorageOptions
+	waker     *waker
+	listening atomic.Bool
+	cancel    context.CancelFunc
+}
+
+func NewPGXStorage[T any](pool *pgxpool.Pool, factory JobFactory[T], opts ...pgStorageOption) (*pgxStorage[T], error) {
+	options := newDefaultPGStorageOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+
+	s := &pgxStorage[T]{pool: pool, factory: factory, options: options, waker: newWaker()}
+	if options.autoMigrate {
+		if err := s.Migrate(); err != nil {
+			return nil, err
+		}
+	} else if err := pgCheckSchema(pgxSchemaConn{pool}, options); err != nil {
+		return nil, err
+	}
+	if options.historyPartitioning != PGPartitionNone {
+		if err := s.maintainHistoryPartitions(time.Time{}); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go s.listen(ctx)
+	return s, nil
+}
+
+// Migrate brings the schema up to date. NewPGXStorage calls it unless
+// WithAutoMigrate(false) is given.
+func (s *pgxStorage[T]) Migrate() error {
+	return pgxWithTx(s.pool, func(tx pgSchemaConn) error {
+		return pgApplyMigrations(tx, s.options)
+	})
+}
+
+// Close stops listening for notifications. It does not close the pool.
+func (s *pgxStorage[T]) Close() {
+	s.cancel()
+}
+
+func (s *pgxStorage[T]) listen(ctx context.Context) {
+	for {
+		err := s.listenOnce(ctx)
+		s.listening.Store(false)
+		s.waker.wake()
+		if ctx.Err() != nil {
+			return
+		}
+		log.Println("Error listening for notifications:", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pgxListenRetry):
+		}
+	}
+}
+
+func (s *pgxStorage[T]) listenOnce(ctx context.Context) error {
+	conn, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// A listening connection must not go back to the pool
+	pgConn := conn.Hijack()
+	defer pgConn.Close(context.Background())
+
+	_, err = pgConn.Exec(ctx, "LISTEN "+pgx.Identifier{s.options.channel()}.Sanitize())
+	if err != nil {
+		return err
+	}
+	s.listening.Store(true)
+	// Jobs may have been pushed while nobody was listening
+	s.waker.wake()
+
+	for {
+		if _, err := pgConn.WaitForNotification(ctx); err != nil {
+			return err
+		}
+		s.waker.wake()
+	}
+}
+
+func (s *pgxStorage[T]) Wakeup() <-chan struct{} {
+	return s.waker.C()
+}
+
+func (s *pgxStorage[T]) Listening() bool {
+	return s.listening.Load()
+}
+
+// Push sends the insert and the notification as one batch, so it takes a
+// single round-trip.
+func (s *pgxStorage[T]) jobCodec() Codec {
+	return s.options.codec
+}
+
+func (s *pgxStorage[T]) Push(j Job[T], t time.Time) error {
+	id := uuid.New().String()
+	payload, err := encodeJob(j, s.options.codec)
+	if err != nil {
+		return err
+	}
+	state, codec, version, data := pgPayloadArgs(payload)
+
+	batch := &pgx.Batch{}
+	batch.Queue(pgInsertSQL(s.options), id, t, state, codec, version, data, j.Type(), jobQueue(j))
+	batch.Queue(pgNotifySQL, s.options.channel(), t.Format(time.RFC3339Nano))
+	if err := s.pool.SendBatch(context.Background(), batch).Close(); err != nil {
+		return err
+	}
+	j.GetIDContainer().SetID(JobID(id))
+	return nil
+}
+
+// PushTx inserts the job through tx, so it only becomes visible if the
+// surrounding transaction commits. Wrap a pgx.Tx with PGXTx to pass it.
+func (s *pgxStorage[T]) PushTx(tx Execer, j Job[T], t time.Time) error {
+	return pgPushTx(tx, s.options, j, t)
+}
+
+// PGXTx makes a pgx transaction an Execer, so jobs can be scheduled in it
+// with ScheduleInTx or InTx.
+func PGXTx(tx pgx.Tx) Execer {
+	return pgxExecer{tx}
+}
+
+type pgxExecer struct {
+	tx pgx.Tx
+}
+
+func (e pgxExecer) Exec(query string, args ...any) (sql.Result, error) {
+	tag, err := e.tx.Exec(context.Background(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgxResult{tag}, nil
+}
+
+// pgxResult is the sql.Result of a pgx command.
+type pgxResult struct {
+	tag pgconn.CommandTag
+}
+
+func (r pgxResult) LastInsertId() (int64, error) {
+	return 0, errors.New("omniq: LastInsertId is not supported by postgres")
+}
+
+func (r pgxResult) RowsAffected() (int64, error) {
+	return r.tag.RowsAffected(), nil
+}
+
+func (s *pgxStorage[T]) PushRetry(j Job[T], t time.Time, attempts int) error {
+	payload, err := encodeJob(j, s.options.codec)
+	if err != nil {
+		return err
+	}
+	state, codec, version, data := pgPayloadArgs(payload)
+	id := string(j.GetIDContainer().GetID())
+
+	batch := &pgx.Batch{}
+	batch.Queue(pgRetrySQL(s.options), id, t, state, codec, version, data, j.Type(), jobQueue(j), attempts)
+	batch.Queue(pgNotifySQL, s.options.channel(), t.Format(time.RFC3339Nano))
+	return s.pool.SendBatch(context.Background(), batch).Close()
+}
+
+// PushMany enqueues all jobs with a single COPY.
+func (s *pgxStorage[T]) PushMany(items []Scheduled[T]) ([]JobID, error) {
+	errs := &BulkError{}
+	payloads := encodeScheduled(items, s.options.codec, errs)
+
+	ids := make([]JobID, len(items))
+	rows := make([][]any, 0, len(items))
+	var earliest time.Time
+	for i, item := range items {
+		if payloads[i].Codec == "" {
+			continue
+		}
+		id := uuid.New()
+		ids[i] = JobID(id.String())
+		state, codec, version, data := pgPayloadArgs(payloads[i])
+		rows = append(rows, []any{[16]byte(id), item.At, state, codec, version, data, item.Job.Type(), jobQueue(item.Job)})
+		if earliest.IsZero() || item.At.Before(earliest) {
+			earliest = item.At
+		}
+	}
+	if len(rows) == 0 {
+		return ids, errs.err()
+	}
+
+	ctx := context.Background()
+	_, err := s.pool.CopyFrom(ctx, pgx.Identifier(s.options.identifier()), pgInsertColumnNames, pgx.CopyFromRows(rows))
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.pool.Exec(ctx, pgNotifySQL, s.options.channel(), earliest.Format(time.RFC3339Nano))
+	if err != nil {
+		return nil, err
+	}
+
+	for i, item := range items {
+		if ids[i] != "" {
+			item.Job.GetIDContainer().SetID(ids[i])
+		}
+	}
+	return ids, errs.err()
+}
+
+func (s *pgxStorage[T]) Delete(id JobID) error {
+	_, err := s.pool.Exec(context.Background(), pgDeleteSQL(s.options), string(id))
+	return err
+}
+
+func (s *pgxStorage[T]) DeleteMany(ids []JobID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := s.pool.Exec(context.Background(), pgDeleteManySQL(s.options), pgArray(ids))
+	return err
+}
+
+func (s *pgxStorage[T]) GetDue() ([]Job[T], error) {
+	now := time.Now()
+	rows, err := s.pool.Query(context.Background(), pgClaimSQL(s.options), now, now.Add(claimLease), s.options.batchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	claimed := []pgClaimedRow{}
+	for rows.Next() {
+		var r pgClaimedRow
+		if err := rows.Scan(&r.id, &r.t, &r.state, &r.codec, &r.version, &r.payload, &r.typ, &r.attempts); err != nil {
+			return nil, err
+		}
+		claimed = append(claimed, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pgInstantiate(s.factory, claimed), nil
+}
+
+func (s *pgxStorage[T]) NextDue() (time.Time, bool, error) {
+	var next *time.Time
+	err := s.pool.QueryRow(context.Background(), pgNextDueSQL(s.options)).Scan(&next)
+	if err != nil || next == nil {
+		return time.Time{}, false, err
+	}
+	return *next, true, nil
+}
@@ -0,0 +1,78 @@
+package omniq_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/eugen-bondarev/omniq"
+	"github.com/eugen-bondarev/omniq/storagetest"
+)
+
+// newTestPGXStorage creates a pgx storage in a schema of its own, which is
+// dropped again after the test.
+func newTestPGXStorage(t *testing.T, factory omniq.JobFactory[struct{}]) (omniq.SchedulerStorage[struct{}], *pgxpool.Pool) {
+	t.Helper()
+	_, schema := openTestDB(t)
+	pool, err := pgxpool.New(context.Background(), os.Getenv(pgTestDSNVariable))
+	if err != nil {
+		t.Fatalf("opening the pool: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	s, err := omniq.NewPGXStorage(pool, factory, omniq.WithSchema(schema))
+	if err != nil {
+		t.Fatalf("NewPGXStorage: %v", err)
+	}
+	t.Cleanup(s.Close)
+	return s, pool
+}
+
+func TestPGXStorage(t *testing.T) {
+	if os.Getenv(pgTestDSNVariable) == "" {
+		t.Skipf("%s is not set", pgTestDSNVariable)
+	}
+	storagetest.Run(t, func(t *testing.T, factory omniq.JobFactory[struct{}]) omniq.SchedulerStorage[struct{}] {
+		s, _ := newTestPGXStorage(t, factory)
+		return s
+	})
+}
+
+func TestPGXStoragePushTx(t *testing.T) {
+	s, pool := newTestPGXStorage(t, &storagetest.Factory{})
+	scheduler := omniq.New(s)
+	ctx := context.Background()
+
+	for _, commit := range []bool{false, true} {
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		j := &storagetest.TextJob{Text: fmt.Sprintf("commit %v", commit)}
+		if _, err := scheduler.Schedule(ctx, j, omniq.InTx(omniq.PGXTx(tx))); err != nil {
+			t.Fatalf("scheduling in a transaction: %v", err)
+		}
+		if commit {
+			err = tx.Commit(ctx)
+		} else {
+			err = tx.Rollback(ctx)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Give the committed job time to become due
+	time.Sleep(10 * time.Millisecond)
+	jobs, err := s.GetDue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].(*storagetest.TextJob).Text != "commit true" {
+		t.Errorf("got %v, want only the committed job", jobs)
+	}
+}
@@ -0,0 +1,174 @@
+package omniq
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+	"sort"
+	"time"
+)
+
+var ErrQueryNotSupported = errors.New("omniq: storage does not support queries")
+
+// JobState is where a pending job is in its life cycle.
+type JobState string
+
+const (
+	// JobScheduled jobs are not due yet.
+	JobScheduled JobState = "scheduled"
+	// JobDue jobs are waiting to be picked up, including ones whose lease
+	// expired before they were acknowledged.
+	JobDue JobState = "due"
+	// JobClaimed jobs were handed to a scheduler and are within their lease,
+	// or failed and wait for a retry, see RetryStorage.
+	JobClaimed JobState = "claimed"
+)
+
+// JobFilter selects pending jobs. Empty fields match everything.
+type JobFilter struct {
+	Types  []string
+	States []JobState
+	Queues []string
+	// DueAfter and DueBefore bound the due time to [DueAfter, DueBefore).
+	DueAfter  time.Time
+	DueBefore time.Time
+	// Payload matches jobs whose JSON state contains it, the way the postgres
+	// @> operator does: {"UserID": 42} matches any job with that field. Jobs
+	// stored with a codec other than JSONCodec never match.
+	Payload map[string]any
+	// Limit caps the number of jobs returned; zero means no limit.
+	Limit  int
+	Offset int
+}
+
+// JobInfo describes a pending job.
+type JobInfo struct {
+	ID    JobID
+	Type  string
+	Queue string
+	State JobState
+	// DueAt is when the job is due or, for claimed jobs, when the lease expires
+	// or the retry is due.
+	DueAt    time.Time
+	Attempts int
+	Payload  Payload
+}
+
+// JobPage is a page of jobs ordered by due time, and the number of jobs
+// matching the filter across all pages.
+type JobPage struct {
+	Jobs  []JobInfo
+	Total int
+}
+
+// List returns the pending jobs matching the filter.
+func (s *Scheduler[T]) List(f JobFilter) (JobPage, error) {
+	storage, ok := s.storage.(QueryStorage)
+	if !ok {
+		return JobPage{}, ErrQueryNotSupported
+	}
+	return storage.Query(f)
+}
+
+// jobState derives the state of a job from its due time and claim count.
+func jobState(due time.Time, attempts int, now time.Time) JobState {
+	switch {
+	case !due.After(now):
+		return JobDue
+	case attempts > 0:
+		return JobClaimed
+	default:
+		return JobScheduled
+	}
+}
+
+// queryJobs applies the filter to jobs held in memory. State is derived from
+// DueAt and Attempts.
+func queryJobs(jobs []JobInfo, f JobFilter, now time.Time) (JobPage, error) {
+	var payload any
+	if len(f.Payload) > 0 {
+		// Normalize the filter to what unmarshaling the payloads produces
+		content, err := json.Marshal(f.Payload)
+		if err != nil {
+			return JobPage{}, err
+		}
+		if err := json.Unmarshal(content, &payload); err != nil {
+			return JobPage{}, err
+		}
+	}
+
+	matched := []JobInfo{}
+	for _, j := range jobs {
+		j.State = jobState(j.DueAt, j.Attempts, now)
+		if len(f.Types) > 0 && !slices.Contains(f.Types, j.Type) {
+			continue
+		}
+		if len(f.States) > 0 && !slices.Contains(f.States, j.State) {
+			continue
+		}
+		if len(f.Queues) > 0 && !slices.Contains(f.Queues, j.Queue) {
+			continue
+		}
+		if !f.DueAfter.IsZero() && j.DueAt.Before(f.DueAfter) {
+			continue
+		}
+		if !f.DueBefore.IsZero() && !j.DueAt.Before(f.DueBefore) {
+			continue
+		}
+		if payload != nil {
+			var doc any
+			if !j.Payload.IsJSON() || json.Unmarshal(j.Payload.Data, &doc) != nil || !jsonContains(doc, payload) {
+				continue
+			}
+		}
+		matched = append(matched, j)
+	}
+
+	sort.Slice(matched, func(a, b int) bool {
+		if !matched[a].DueAt.Equal(matched[b].DueAt) {
+			return matched[a].DueAt.Before(matched[b].DueAt)
+		}
+		return matched[a].ID < matched[b].ID
+	})
+
+	page := JobPage{Total: len(matched)}
+	start := min(f.Offset, len(matched))
+	end := len(matched)
+	if f.Limit > 0 {
+		end = min(start+f.Limit, end)
+	}
+	page.Jobs = matched[start:end]
+	return page, nil
+}
+
+// jsonContains reports whether doc contains want, with the semantics of the
+// postgres jsonb @> operator.
+func jsonContains(doc, want any) bool {
+	switch want := want.(type) {
+	case map[string]any:
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			return false
+		}
+		for k, v := range want {
+			if field, ok := obj[k]; !ok || !jsonContains(field, v) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		arr, ok := doc.([]any)
+		if !ok {
+			return false
+		}
+		for _, v := range want {
+			if !slices.ContainsFunc(arr, func(elem any) bool { return jsonContains(elem, v) }) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(doc, want)
+	}
+}
@@ -0,0 +1,483 @@
+package omniq
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// KEYS[1] due zset, KEYS[2] payload hash
+// ARGV[1] id, ARGV[2] due time (unix ms), ARGV[3] payload
+var redisPushScript = redis.NewScript(`
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+return 1
+`)
+
+// KEYS[1] due zset, KEYS[2] payload hash, KEYS[3] attempts hash
+// ARGV[1] id, ARGV[2] due time (unix ms), ARGV[3] payload, ARGV[4] attempts
+//
+// The job replaces itself if it is still claimed.
+var redisRetryScript = redis.NewScript(`
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+redis.call('HSET', KEYS[3], ARGV[1], ARGV[4])
+return 1
+`)
+
+// KEYS[1] due zset, KEYS[2] payload hash, KEYS[3] attempts hash
+// ARGV[1] now (unix ms), ARGV[2] lease (ms), ARGV[3] batch size
+//
+// Claimed jobs get their score pushed past the lease, so they are handed out
+// again only if they are not acknowledged in time. It returns the ID, payload
+// and attempts of each claimed job.
+var redisClaimScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[3]))
+local claimed = {}
+for _, id in ipairs(ids) do
+  local payload = redis.call('HGET', KEYS[2], id)
+  if payload then
+    redis.call('ZADD', KEYS[1], tonumber(ARGV[1]) + tonumber(ARGV[2]), id)
+    local attempts = redis.call('HINCRBY', KEYS[3], id, 1)
+    table.insert(claimed, id)
+    table.insert(claimed, payload)
+    table.insert(claimed, tostring(attempts))
+  else
+    redis.call('ZREM', KEYS[1], id)
+  end
+end
+return claimed
+`)
+
+// KEYS[1] due zset, KEYS[2] payload hash, KEYS[3] attempts hash
+// ARGV[1] id
+var redisAckScript = redis.NewScript(`
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[3], ARGV[1])
+return 1
+`)
+
+// KEYS[1] due zset, KEYS[2] payload hash, KEYS[3] attempts hash, KEYS[4] dead letter hash
+// ARGV[1] id, ARGV[2] dead letter
+var redisDeadLetterScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[2], ARGV[1]) == 0 then
+  return 0
+end
+redis.call('HSET', KEYS[4], ARGV[1], ARGV[2])
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[3], ARGV[1])
+return 1
+`)
+
+// KEYS[1] history zset, KEYS[2] record hash of the job
+// ARGV[1] zset member, ARGV[2] hash field, ARGV[3] finish time (unix ms), ARGV[4] record
+var redisArchiveScript = redis.NewScript(`
+redis.call('HSET', KEYS[2], ARGV[2], ARGV[4])
+redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+return 1
+`)
+
+// KEYS[1] history zset, KEYS[2..] record hash of each candidate
+// ARGV[1] cutoff (unix ms, empty for none), ARGV[2] rows to keep (0 for all),
+// ARGV[3..] candidates, oldest first
+//
+// Members are "<id>:<finish time in ns>", the time being the hash field holding
+// the record. Candidates are checked again, as the history may have changed
+// since they were read.
+var redisPruneScript = redis.NewScript(`
+local removed = 0
+local keep = tonumber(ARGV[2])
+for i = 3, #ARGV do
+  local m = ARGV[i]
+  local score = redis.call('ZSCORE', KEYS[1], m)
+  if score then
+    local drop = ARGV[1] ~= '' and tonumber(score) < tonumber(ARGV[1])
+    if not drop and keep > 0 then
+      drop = redis.call('ZRANK', KEYS[1], m) < redis.call('ZCARD', KEYS[1]) - keep
+    end
+    if drop then
+      redis.call('ZREM', KEYS[1], m)
+      redis.call('HDEL', KEYS[i - 1], string.match(m, ':(%d+)$'))
+      removed = removed + 1
+    end
+  end
+end
+return removed
+`)
+
+// redisPruneBatch is how many history records a single prune script removes
+const redisPruneBatch = 500
+
+type redisEntry struct {
+	Type  string
+	Queue string `json:",omitempty"`
+	storedPayload
+}
+
+type redisStorageOptions struct {
+	keyPrefix string
+	batchSize int
+	codec     Codec
+}
+
+func newDefaultRedisStorageOptions() redisStorageOptions {
+	return redisStorageOptions{keyPrefix: "omniq", batchSize: 100}
+}
+
+type redisStorageOption func(*redisStorageOptions)
+
+func WithRedisKeyPrefix(prefix string) redisStorageOption {
+	return func(opts *redisStorageOptions) {
+		opts.keyPrefix = prefix
+	}
+}
+
+// WithRedisBatchSize limits how many jobs a single GetDue claims.
+func WithRedisBatchSize(n int) redisStorageOption {
+	return func(opts *redisStorageOptions) {
+		opts.batchSize = n
+	}
+}
+
+// WithRedisCodec sets the codec jobs are encoded with, unless they name their
+// own. Payloads of other codecs are stored base64-encoded.
+func WithRedisCodec(c Codec) redisStorageOption {
+	return func(opts *redisStorageOptions) {
+		opts.codec = c
+	}
+}
+
+type redisStorage[T any] struct {
+	client  redis.Cmdable
+	factory JobFactory[T]
+	options redisStorageOptions
+}
+
+// NewRedisStorage keeps due times in a sorted set and payloads in a hash. All
+// keys share a hash tag and scripts only touch the keys they are passed, so the
+// storage also works on Redis Cluster.
+func NewRedisStorage[T any](client redis.Cmdable, factory JobFactory[T], opts ...redisStorageOption) *redisStorage[T] {
+	options := newDefaultRedisStorageOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return &redisStorage[T]{client: client, factory: factory, options: options}
+}
+
+func (s *redisStorage[T]) dueKey() string {
+	return fmt.Sprintf("{%s}:due", s.options.keyPrefix)
+}
+
+func (s *redisStorage[T]) jobsKey() string {
+	return fmt.Sprintf("{%s}:jobs", s.options.keyPrefix)
+}
+
+func (s *redisStorage[T]) attemptsKey() string {
+	return fmt.Sprintf("{%s}:attempts", s.options.keyPrefix)
+}
+
+func (s *redisStorage[T]) deadKey() string {
+	return fmt.Sprintf("{%s}:dead", s.options.keyPrefix)
+}
+
+func (s *redisStorage[T]) historyKey() string {
+	return fmt.Sprintf("{%s}:history", s.options.keyPrefix)
+}
+
+func (s *redisStorage[T]) historyRecordPrefix() string {
+	return fmt.Sprintf("{%s}:history:", s.options.keyPrefix)
+}
+
+func (s *redisStorage[T]) jobCodec() Codec {
+	return s.options.codec
+}
+
+func (s *redisStorage[T]) Push(j Job[T], t time.Time) error {
+	encoded, err := encodeJob(j, s.options.codec)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(redisEntry{Type: j.Type(), Queue: jobQueue(j), storedPayload: newStoredPayload(encoded)})
+	if err != nil {
+		return err
+	}
+
+	id := JobID(uuid.New().String())
+	keys := []string{s.dueKey(), s.jobsKey()}
+	err = redisPushScript.Run(context.Background(), s.client, keys, string(id), t.UnixMilli(), payload).Err()
+	if err != nil {
+		return err
+	}
+	j.GetIDContainer().SetID(id)
+	return nil
+}
+
+func (s *redisStorage[T]) PushRetry(j Job[T], t time.Time, attempts int) error {
+	encoded, err := encodeJob(j, s.options.codec)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(redisEntry{Type: j.Type(), Queue: jobQueue(j), storedPayload: newStoredPayload(encoded)})
+	if err != nil {
+		return err
+	}
+
+	keys := []string{s.dueKey(), s.jobsKey(), s.attemptsKey()}
+	return redisRetryScript.Run(context.Background(), s.client, keys, string(j.GetIDContainer().GetID()), t.UnixMilli(), payload, attempts).Err()
+}
+
+// PushMany enqueues all jobs in a single MULTI/EXEC round-trip.
+func (s *redisStorage[T]) PushMany(items []Scheduled[T]) ([]JobID, error) {
+	errs := &BulkError{}
+	encoded := encodeScheduled(items, s.options.codec, errs)
+
+	ids := make([]JobID, len(items))
+	payloads := map[string]any{}
+	due := []redis.Z{}
+	for i, item := range items {
+		if encoded[i].Codec == "" {
+			continue
+		}
+		payload, err := json.Marshal(redisEntry{Type: item.Job.Type(), Queue: jobQueue(item.Job), storedPayload: newStoredPayload(encoded[i])})
+		if err != nil {
+			errs.add(i, err)
+			continue
+		}
+		ids[i] = JobID(uuid.New().String())
+		payloads[string(ids[i])] = payload
+		due = append(due, redis.Z{Score: float64(item.At.UnixMilli()), Member: string(ids[i])})
+	}
+
+	if len(due) > 0 {
+		_, err := s.client.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+			pipe.HSet(context.Background(), s.jobsKey(), payloads)
+			pipe.ZAdd(context.Background(), s.dueKey(), due...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i, item := range items {
+		if ids[i] != "" {
+			item.Job.GetIDContainer().SetID(ids[i])
+		}
+	}
+	return ids, errs.err()
+}
+
+func (s *redisStorage[T]) Delete(id JobID) error {
+	keys := []string{s.dueKey(), s.jobsKey(), s.attemptsKey()}
+	return redisAckScript.Run(context.Background(), s.client, keys, string(id)).Err()
+}
+
+func (s *redisStorage[T]) GetDue() ([]Job[T], error) {
+	keys := []string{s.dueKey(), s.jobsKey(), s.attemptsKey()}
+	args := []any{time.Now().UnixMilli(), claimLease.Milliseconds(), s.options.batchSize}
+	claimed, err := redisClaimScript.Run(context.Background(), s.client, keys, args...).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+
+	due := make([]Job[T], 0, len(claimed)/3)
+	for i := 0; i+2 < len(claimed); i += 3 {
+		attempts, _ := strconv.Atoi(claimed[i+2])
+		var e redisEntry
+		if err := json.Unmarshal([]byte(claimed[i+1]), &e); err != nil {
+			corrupt := &corruptRecordError{record: []byte(claimed[i+1]), err: err}
+			due = append(due, &PoisonJob[T]{WithID: WithID{ID: JobID(claimed[i]), attempts: attempts}, Payload: corrupt.payload(), Err: corrupt})
+			continue
+		}
+		due = append(due, instantiateClaimed(s.factory, e.Type, JobID(claimed[i]), e.payload(), attempts))
+	}
+	return due, nil
+}
+
+func (s *redisStorage[T]) NextDue() (time.Time, bool, error) {
+	next, err := s.client.ZRangeWithScores(context.Background(), s.dueKey(), 0, 0).Result()
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if len(next) == 0 {
+		return time.Time{}, false, nil
+	}
+	return time.UnixMilli(int64(next[0].Score)), true, nil
+}
+
+// Query loads all pending jobs, so it is meant for inspection rather than for
+// frequent calls.
+func (s *redisStorage[T]) Query(f JobFilter) (JobPage, error) {
+	ctx := context.Background()
+	var due *redis.ZSliceCmd
+	var payloads, attempts *redis.MapStringStringCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		due = pipe.ZRangeWithScores(ctx, s.dueKey(), 0, -1)
+		payloads = pipe.HGetAll(ctx, s.jobsKey())
+		attempts = pipe.HGetAll(ctx, s.attemptsKey())
+		return nil
+	})
+	if err != nil {
+		return JobPage{}, err
+	}
+
+	jobs := make([]JobInfo, 0, len(due.Val()))
+	for _, z := range due.Val() {
+		id := z.Member.(string)
+		payload, ok := payloads.Val()[id]
+		if !ok {
+			continue
+		}
+		var e redisEntry
+		if err := json.Unmarshal([]byte(payload), &e); err != nil {
+			return JobPage{}, err
+		}
+		n, _ := strconv.Atoi(attempts.Val()[id])
+		jobs = append(jobs, JobInfo{
+			ID:       JobID(id),
+			Type:     e.Type,
+			Queue:    cmp.Or(e.Queue, DefaultQueue),
+			DueAt:    time.UnixMilli(int64(z.Score)),
+			Attempts: n,
+			Payload:  e.payload(),
+		})
+	}
+	return queryJobs(jobs, f, time.Now())
+}
+
+// DeadLetter moves the job to a hash of dead letters.
+func (s *redisStorage[T]) DeadLetter(id JobID, reason string) error {
+	ctx := context.Background()
+	var payload *redis.StringCmd
+	var attempts *redis.StringCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		payload = pipe.HGet(ctx, s.jobsKey(), string(id))
+		attempts = pipe.HGet(ctx, s.attemptsKey(), string(id))
+		return nil
+	})
+	if errors.Is(payload.Err(), redis.Nil) {
+		return nil
+	}
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+
+	n, _ := strconv.Atoi(attempts.Val())
+	// A payload that does not parse is kept as it was stored
+	dead := corruptDeadLetter(id, []byte(payload.Val()), n, reason)
+	var e redisEntry
+	if err := json.Unmarshal([]byte(payload.Val()), &e); err == nil {
+		dead = deadLetterEntry{ID: id, Type: e.Type, Queue: cmp.Or(e.Queue, DefaultQueue), storedPayload: e.storedPayload, Attempts: n, Error: reason, FailedAt: time.Now()}
+	}
+	content, err := json.Marshal(dead)
+	if err != nil {
+		return err
+	}
+	keys := []string{s.dueKey(), s.jobsKey(), s.attemptsKey(), s.deadKey()}
+	return redisDeadLetterScript.Run(ctx, s.client, keys, string(id), content).Err()
+}
+
+func (s *redisStorage[T]) DeadLetters() ([]DeadLetter, error) {
+	fields, err := s.client.HGetAll(context.Background(), s.deadKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	letters := make([]DeadLetter, 0, len(fields))
+	for _, content := range fields {
+		var e deadLetterEntry
+		if err := json.Unmarshal([]byte(content), &e); err != nil {
+			return nil, err
+		}
+		letters = append(letters, e.deadLetter())
+	}
+	sort.Slice(letters, func(a, b int) bool { return letters[a].FailedAt.Before(letters[b].FailedAt) })
+	return letters, nil
+}
+
+func (s *redisStorage[T]) Archive(rec HistoryRecord) error {
+	content, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	field := strconv.FormatInt(rec.FinishedAt.UnixNano(), 10)
+	keys := []string{s.historyKey(), s.historyRecordPrefix() + string(rec.ID)}
+	args := []any{string(rec.ID) + ":" + field, field, rec.FinishedAt.UnixMilli(), content}
+	return redisArchiveScript.Run(context.Background(), s.client, keys, args...).Err()
+}
+
+func (s *redisStorage[T]) History(id JobID) ([]HistoryRecord, error) {
+	fields, err := s.client.HGetAll(context.Background(), s.historyRecordPrefix()+string(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	recs := make([]HistoryRecord, 0, len(fields))
+	for _, content := range fields {
+		var rec HistoryRecord
+		if err := json.Unmarshal([]byte(content), &rec); err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+	sort.Slice(recs, func(a, b int) bool { return recs[a].FinishedAt.Before(recs[b].FinishedAt) })
+	return recs, nil
+}
+
+// PruneHistory reads the records to remove first, as the script has to be
+// passed the hash of each, and removes them in batches.
+func (s *redisStorage[T]) PruneHistory(before time.Time, keep int) (int, error) {
+	ctx := context.Background()
+	cutoff := ""
+	var candidates []string
+	if !before.IsZero() {
+		cutoff = strconv.FormatInt(before.UnixMilli(), 10)
+		expired, err := s.client.ZRangeByScore(ctx, s.historyKey(), &redis.ZRangeBy{Min: "-inf", Max: "(" + cutoff}).Result()
+		if err != nil {
+			return 0, err
+		}
+		candidates = expired
+	}
+	if keep > 0 {
+		total, err := s.client.ZCard(ctx, s.historyKey()).Result()
+		if err != nil {
+			return 0, err
+		}
+		if excess := int(total) - len(candidates) - keep; excess > 0 {
+			oldest, err := s.client.ZRange(ctx, s.historyKey(), int64(len(candidates)), int64(len(candidates)+excess-1)).Result()
+			if err != nil {
+				return 0, err
+			}
+			candidates = append(candidates, oldest...)
+		}
+	}
+
+	removed := 0
+	for batch := range slices.Chunk(candidates, redisPruneBatch) {
+		keys := []string{s.historyKey()}
+		args := []any{cutoff, keep}
+		for _, m := range batch {
+			id := m[:strings.LastIndexByte(m, ':')]
+			keys = append(keys, s.historyRecordPrefix()+id)
+			args = append(args, m)
+		}
+		n, err := redisPruneScript.Run(ctx, s.client, keys, args...).Int()
+		if err != nil {
+			return removed, err
+		}
+		removed += n
+	}
+	return removed, nil
+}
@@ -0,0 +1,107 @@
+package omniq_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/eugen-bondarev/omniq"
+	"github.com/eugen-bondarev/omniq/storagetest"
+)
+
+func newMiniredisClient(t *testing.T) *redis.Client {
+	m := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestRedisStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, factory omniq.JobFactory[struct{}]) omniq.SchedulerStorage[struct{}] {
+		return omniq.NewRedisStorage(newMiniredisClient(t), factory)
+	})
+}
+
+func TestRedisStoragePruneHistory(t *testing.T) {
+	s := omniq.NewRedisStorage(newMiniredisClient(t), &storagetest.Factory{})
+	start := time.Now().Add(-time.Hour)
+	for i := range 6 {
+		id := omniq.JobID(fmt.Sprintf("job-%d", i%2))
+		rec := omniq.HistoryRecord{ID: id, Type: "TextJob", Status: omniq.JobSucceeded, StartedAt: start, FinishedAt: start.Add(time.Duration(i) * time.Minute)}
+		if err := s.Archive(rec); err != nil {
+			t.Fatalf("Archive: %v", err)
+		}
+	}
+	history := func() []time.Time {
+		var finished []time.Time
+		for _, id := range []omniq.JobID{"job-0", "job-1"} {
+			recs, err := s.History(id)
+			if err != nil {
+				t.Fatalf("History: %v", err)
+			}
+			for _, rec := range recs {
+				finished = append(finished, rec.FinishedAt)
+			}
+		}
+		return finished
+	}
+
+	n, err := s.PruneHistory(start.Add(2*time.Minute), 0)
+	if err != nil {
+		t.Fatalf("PruneHistory by age: %v", err)
+	}
+	if left := history(); n != 2 || len(left) != 4 {
+		t.Errorf("pruning by age removed %d records and left %d, want 2 and 4", n, len(left))
+	}
+
+	n, err = s.PruneHistory(time.Time{}, 1)
+	if err != nil {
+		t.Fatalf("PruneHistory by count: %v", err)
+	}
+	left := history()
+	if n != 3 || len(left) != 1 || !left[0].Equal(start.Add(5*time.Minute)) {
+		t.Errorf("pruning by count removed %d records and left %v, want 3 and only the newest", n, left)
+	}
+}
+
+func TestRedisStorageDeadLetterUnreadable(t *testing.T) {
+	ctx := context.Background()
+	client := newMiniredisClient(t)
+	s := omniq.NewRedisStorage(client, &storagetest.Factory{})
+	if err := client.HSet(ctx, "{omniq}:jobs", "broken", "not json").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ZAdd(ctx, "{omniq}:due", redis.Z{Score: 0, Member: "broken"}).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	due, err := s.GetDue()
+	if err != nil {
+		t.Fatalf("GetDue: %v", err)
+	}
+	if len(due) != 1 {
+		t.Fatalf("got %d jobs, want the poison job", len(due))
+	}
+	poison, ok := due[0].(*omniq.PoisonJob[struct{}])
+	if !ok || poison.Err == nil {
+		t.Fatalf("got %#v, want a poison job", due[0])
+	}
+
+	if err := s.DeadLetter("broken", poison.Err.Error()); err != nil {
+		t.Fatalf("DeadLetter: %v", err)
+	}
+	letters, err := s.DeadLetters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 || string(letters[0].Payload.Data) != "not json" || letters[0].Payload.Codec != "raw" || letters[0].Attempts != 1 {
+		t.Errorf("got %+v, want the payload as it was stored and one attempt", letters)
+	}
+	if n, err := client.Exists(ctx, "{omniq}:jobs", "{omniq}:due", "{omniq}:attempts").Result(); err != nil || n != 0 {
+		t.Errorf("%d keys are left after dead-lettering the only job, %v", n, err)
+	}
+}
@@ -0,0 +1,54 @@
+package omniq
+
+import (
+	"context"
+	"time"
+)
+
+type scheduleOptions struct {
+	at time.Time
+	tx Execer
+}
+
+// ScheduleOption configures a single call to Schedule.
+type ScheduleOption func(*scheduleOptions)
+
+// In makes the job due after d.
+func In(d time.Duration) ScheduleOption {
+	return func(opts *scheduleOptions) {
+		opts.at = time.Now().Add(d)
+	}
+}
+
+// At makes the job due at t.
+func At(t time.Time) ScheduleOption {
+	return func(opts *scheduleOptions) {
+		opts.at = t
+	}
+}
+
+// InTx enqueues the job inside tx, like ScheduleInTx.
+func InTx(tx Execer) ScheduleOption {
+	return func(opts *scheduleOptions) {
+		opts.tx = tx
+	}
+}
+
+// Schedule enqueues the job, due right away unless In or At says otherwise,
+// and returns its ID. For a Unique job with a pending duplicate, that is the
+// ID of the duplicate. The context is only checked before the job is pushed,
+// since storages do not take one.
+func (s *Scheduler[T]) Schedule(ctx context.Context, j Job[T], opts ...ScheduleOption) (JobID, error) {
+	options := scheduleOptions{at: time.Now()}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if err := s.schedule(options.tx, j, options.at); err != nil {
+		return "", err
+	}
+	return j.GetIDContainer().GetID(), nil
+}
@@ -2,16 +2,22 @@ package omniq
 
 import (
 	"log"
+	"sort"
 	"time"
 )
 
 type schedulerOptions struct {
-	sleepDuration time.Duration
+	sleepDuration  time.Duration
+	workerID       string
+	history        bool
+	historyMaxAge  time.Duration
+	historyMaxRows int
 }
 
 func newDefaultSchedulerOptions() schedulerOptions {
 	return schedulerOptions{
 		sleepDuration: 1 * time.Second,
+		workerID:      defaultWorkerID(),
 	}
 }
 
@@ -26,6 +32,7 @@ func WithSleepDuration(d time.Duration) schedulerOption {
 type Scheduler[T any] struct {
 	storage SchedulerStorage[T]
 	options schedulerOptions
+	waker   *waker
 }
 
 func New[T any](storage SchedulerStorage[T], opts ...schedulerOption) *Scheduler[T] {
@@ -37,6 +44,7 @@ func New[T any](storage SchedulerStorage[T], opts ...schedulerOption) *Scheduler
 	return &Scheduler[T]{
 		storage: storage,
 		options: options,
+		waker:   newWaker(),
 	}
 }
 
@@ -49,30 +57,146 @@ func NewWithDependencies[T any](storage SchedulerStorage[T], opts ...schedulerOp
 	return &Scheduler[T]{
 		storage: storage,
 		options: options,
+		waker:   newWaker(),
 	}
 }
 
 func (s *Scheduler[T]) Listen(container T) {
 	log.Println("Scheduler is running")
+	if s.options.history {
+		go s.reapHistory()
+	}
 	for {
 		jobs, err := s.storage.GetDue()
 		if err != nil {
 			log.Println("Error getting due jobs:", err)
+			s.wait()
 			continue
 		}
 
+		runnable := jobs[:0]
 		for _, j := range jobs {
-			go j.Run(container)
-			err = s.storage.Delete(j.GetIDContainer().GetID())
-			if err != nil {
-				log.Println("Error deleting job:", err)
+			if poison, ok := j.(*PoisonJob[T]); ok {
+				s.deadLetter(poison)
+				continue
 			}
+			runnable = append(runnable, j)
+		}
+		sort.SliceStable(runnable, func(a, b int) bool { return jobPriority(runnable[a]) > jobPriority(runnable[b]) })
+		// Acknowledge first, so a job that fails quickly and is pushed back
+		// for a retry is not deleted again
+		s.delete(runnable)
+		for _, j := range runnable {
+			go s.run(j, container)
+		}
+
+		s.wait()
+	}
+}
+
+func (s *Scheduler[T]) delete(jobs []Job[T]) {
+	if batch, ok := s.storage.(BatchDeleteStorage); ok && len(jobs) > 1 {
+		ids := make([]JobID, len(jobs))
+		for i, j := range jobs {
+			ids[i] = j.GetIDContainer().GetID()
+		}
+		if err := batch.DeleteMany(ids); err != nil {
+			log.Println("Error deleting jobs:", err)
+		}
+		return
+	}
+
+	for _, j := range jobs {
+		err := s.storage.Delete(j.GetIDContainer().GetID())
+		if err != nil {
+			log.Println("Error deleting job:", err)
+		}
+	}
+}
+
+// wait blocks until the next job is due, a job is scheduled on this instance
+// or the storage signals new work. Unless the storage delivers notifications,
+// it never waits longer than the poll interval.
+func (s *Scheduler[T]) wait() {
+	var notified <-chan struct{}
+	d := s.options.sleepDuration
+	notifier, ok := s.storage.(NotifyingStorage)
+	listening := ok && notifier.Listening()
+	if listening {
+		notified = notifier.Wakeup()
+	}
+
+	next, ok, err := s.nextDue()
+	switch {
+	case err != nil:
+		log.Println("Error getting next due time:", err)
+	case ok:
+		// A job that fell due since the claim is claimed right away
+		if until := max(time.Until(next), 0); listening || until < d {
+			d = until
 		}
+	case listening:
+		d = -1
+	}
 
-		time.Sleep(s.options.sleepDuration)
+	var timeout <-chan time.Time
+	if d >= 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-timeout:
+	case <-notified:
+	case <-s.waker.C():
 	}
 }
 
+func (s *Scheduler[T]) nextDue() (time.Time, bool, error) {
+	storage, ok := s.storage.(NextDueStorage)
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	return storage.NextDue()
+}
+
+// ScheduleIn enqueues the job to run after d. If the job is Unique and a
+// duplicate is pending, it enqueues nothing and sets the job's ID to the
+// pending one.
 func (s *Scheduler[T]) ScheduleIn(j Job[T], d time.Duration) error {
-	return s.storage.Push(j, time.Now().Add(d))
+	return s.schedule(nil, j, time.Now().Add(d))
+}
+
+// ScheduleInTx enqueues the job inside tx. The storage must implement TxStorage.
+// Unique jobs are checked against the committed jobs only.
+func (s *Scheduler[T]) ScheduleInTx(tx Execer, j Job[T], d time.Duration) error {
+	return s.schedule(tx, j, time.Now().Add(d))
+}
+
+// schedule pushes the job due at t, inside tx unless it is nil.
+func (s *Scheduler[T]) schedule(tx Execer, j Job[T], t time.Time) error {
+	var txStorage TxStorage[T]
+	if tx != nil {
+		var ok bool
+		if txStorage, ok = s.storage.(TxStorage[T]); !ok {
+			return ErrTxNotSupported
+		}
+	}
+	id, err := s.pendingDuplicate(j)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		j.GetIDContainer().SetID(id)
+		return nil
+	}
+	if tx != nil {
+		return txStorage.PushTx(tx, j, t)
+	}
+	if err := s.storage.Push(j, t); err != nil {
+		return err
+	}
+	s.waker.wake()
+	return nil
 }
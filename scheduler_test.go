@@ -0,0 +1,474 @@
+package omniq_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eugen-bondarev/omniq"
+)
+
+// testDeps is what the scheduler tests run their jobs with. Each run reports
+// the job's ID and attempt on runs.
+type testDeps struct {
+	runs chan testRun
+}
+
+type testRun struct {
+	ID      omniq.JobID
+	Attempt int
+	Text    string
+}
+
+func newTestDeps() *testDeps {
+	return &testDeps{runs: make(chan testRun, 100)}
+}
+
+// next waits for the next run.
+func (d *testDeps) next(t *testing.T) testRun {
+	t.Helper()
+	select {
+	case r := <-d.runs:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a job to run")
+		return testRun{}
+	}
+}
+
+// none checks that no job runs for a while.
+func (d *testDeps) none(t *testing.T, wait time.Duration) {
+	t.Helper()
+	select {
+	case r := <-d.runs:
+		t.Errorf("%+v ran, want no run", r)
+	case <-time.After(wait):
+	}
+}
+
+func reportRun(d *testDeps, id *omniq.WithID, text string) {
+	d.runs <- testRun{ID: id.GetID(), Attempt: id.GetAttempts(), Text: text}
+}
+
+// slowJob outlives its timeout, writing to its fields all the while.
+type slowJob struct {
+	omniq.WithID
+	Steps int
+}
+
+func (j *slowJob) Run(d *testDeps) {
+	reportRun(d, &j.WithID, "")
+	for range 50 {
+		j.Steps++
+		time.Sleep(time.Millisecond)
+	}
+}
+func (j *slowJob) Type() string                  { return "slowJob" }
+func (j *slowJob) GetIDContainer() *omniq.WithID { return &j.WithID }
+func (j *slowJob) Timeout() time.Duration        { return 10 * time.Millisecond }
+func (j *slowJob) Retries() omniq.RetryPolicy {
+	return omniq.RetryPolicy{Retries: 1, Backoff: omniq.BackoffConstant, Delay: 10 * time.Millisecond}
+}
+
+// textJob reports its text.
+type textJob struct {
+	omniq.WithID
+	Text string
+}
+
+func (j *textJob) Run(d *testDeps)               { reportRun(d, &j.WithID, j.Text) }
+func (j *textJob) Type() string                  { return "textJob" }
+func (j *textJob) GetIDContainer() *omniq.WithID { return &j.WithID }
+
+// failingJob panics on every attempt.
+type failingJob struct {
+	omniq.WithID
+}
+
+func (j *failingJob) Run(d *testDeps) {
+	reportRun(d, &j.WithID, "")
+	panic("failingJob failed")
+}
+func (j *failingJob) Type() string                  { return "failingJob" }
+func (j *failingJob) GetIDContainer() *omniq.WithID { return &j.WithID }
+func (j *failingJob) Retries() omniq.RetryPolicy {
+	return omniq.RetryPolicy{Retries: 2, Backoff: omniq.BackoffLinear, Delay: 5 * time.Millisecond}
+}
+
+// priorityJob is started before jobs of lower levels claimed with it.
+type priorityJob struct {
+	omniq.WithID
+	Level int
+}
+
+func (j *priorityJob) Run(d *testDeps)               { reportRun(d, &j.WithID, fmt.Sprint(j.Level)) }
+func (j *priorityJob) Type() string                  { return "priorityJob" }
+func (j *priorityJob) GetIDContainer() *omniq.WithID { return &j.WithID }
+func (j *priorityJob) Priority() int                 { return j.Level }
+
+// uniqueJob is a duplicate of any pending uniqueJob with the same key.
+type uniqueJob struct {
+	omniq.WithID
+	Key  string
+	Text string
+}
+
+func (j *uniqueJob) Run(d *testDeps)               { reportRun(d, &j.WithID, j.Text) }
+func (j *uniqueJob) Type() string                  { return "uniqueJob" }
+func (j *uniqueJob) GetIDContainer() *omniq.WithID { return &j.WithID }
+func (j *uniqueJob) UniqueFields() map[string]any  { return map[string]any{"Key": j.Key} }
+
+// complexJob has a field encoding/json cannot encode, but gob can.
+type complexJob struct {
+	omniq.WithID
+	Z complex128
+}
+
+func (j *complexJob) Run(d *testDeps)               { reportRun(d, &j.WithID, fmt.Sprint(j.Z)) }
+func (j *complexJob) Type() string                  { return "complexJob" }
+func (j *complexJob) GetIDContainer() *omniq.WithID { return &j.WithID }
+
+type testFactory struct{}
+
+func (testFactory) Instantiate(t string, id omniq.JobID, payload omniq.Payload) (omniq.Job[*testDeps], error) {
+	var j omniq.Job[*testDeps]
+	switch t {
+	case "textJob":
+		j = &textJob{}
+	case "slowJob":
+		j = &slowJob{}
+	case "failingJob":
+		j = &failingJob{}
+	case "priorityJob":
+		j = &priorityJob{}
+	case "uniqueJob":
+		j = &uniqueJob{}
+	case "complexJob":
+		j = &complexJob{}
+	default:
+		return nil, fmt.Errorf("%w: %q", omniq.ErrUnknownJobType, t)
+	}
+	if err := payload.Decode(j); err != nil {
+		return nil, err
+	}
+	j.GetIDContainer().SetID(id)
+	return j, nil
+}
+
+// listen starts a scheduler on the storage. It keeps running after the test,
+// as Listen does not return.
+func listen(t *testing.T, storage omniq.SchedulerStorage[*testDeps]) (*omniq.Scheduler[*testDeps], *testDeps) {
+	t.Helper()
+	s := omniq.New(storage, omniq.WithSleepDuration(5*time.Millisecond), omniq.WithHistory(0, 0))
+	deps := newTestDeps()
+	go s.Listen(deps)
+	return s, deps
+}
+
+// schedulerStorages returns the storages the scheduler tests run against.
+func schedulerStorages() map[string]func(t *testing.T) omniq.SchedulerStorage[*testDeps] {
+	return map[string]func(t *testing.T) omniq.SchedulerStorage[*testDeps]{
+		"json": func(t *testing.T) omniq.SchedulerStorage[*testDeps] {
+			return omniq.NewJSONStorage(filepath.Join(t.TempDir(), "jobs.json"), testFactory{})
+		},
+		"journal": func(t *testing.T) omniq.SchedulerStorage[*testDeps] {
+			s, err := omniq.NewJournalStorage(filepath.Join(t.TempDir(), "jobs.journal"), testFactory{})
+			if err != nil {
+				t.Fatalf("NewJournalStorage: %v", err)
+			}
+			t.Cleanup(func() { s.Close() })
+			return s
+		},
+	}
+}
+
+// history waits until the job has n history records.
+func history(t *testing.T, s *omniq.Scheduler[*testDeps], id omniq.JobID, n int) []omniq.HistoryRecord {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		recs, err := s.History(id)
+		if err != nil {
+			t.Fatalf("History: %v", err)
+		}
+		if len(recs) >= n || time.Now().After(deadline) {
+			if len(recs) != n {
+				t.Fatalf("got %d history records, want %d", len(recs), n)
+			}
+			return recs
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestSchedulerTimeoutRetry runs with -race to check that a job given up on
+// after its timeout is not encoded for its retry while it still runs.
+func TestSchedulerTimeoutRetry(t *testing.T) {
+	for name, newStorage := range schedulerStorages() {
+		t.Run(name, func(t *testing.T) {
+			s, deps := listen(t, newStorage(t))
+
+			id, err := s.Schedule(context.Background(), &slowJob{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for attempt := 1; attempt <= 2; attempt++ {
+				if r := deps.next(t); r.ID != id || r.Attempt != attempt {
+					t.Errorf("got run %+v, want attempt %d of %s", r, attempt, id)
+				}
+			}
+			deps.none(t, 50*time.Millisecond)
+
+			for _, rec := range history(t, s, id, 2) {
+				if rec.Status != omniq.JobFailed || !strings.Contains(rec.Error, omniq.ErrJobTimeout.Error()) {
+					t.Errorf("got %+v, want a timed out run", rec)
+				}
+			}
+		})
+	}
+}
+
+func TestSchedulerHistoryCodec(t *testing.T) {
+	storage := omniq.NewJSONStorage(filepath.Join(t.TempDir(), "jobs.json"), testFactory{}, omniq.WithJSONStorageCodec(omniq.GobCodec))
+	s, deps := listen(t, storage)
+
+	id, err := s.Schedule(context.Background(), &complexJob{Z: complex(1, 2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := deps.next(t); r.Text != "(1+2i)" {
+		t.Errorf("the job ran with %s, want (1+2i)", r.Text)
+	}
+
+	rec := history(t, s, id, 1)[0]
+	var state struct{ Codec string }
+	if err := json.Unmarshal(rec.State, &state); err != nil || state.Codec != "gob" {
+		t.Errorf("archived state %s, want the gob payload", rec.State)
+	}
+}
+
+// TestSchedulerNextDue pushes the job past the scheduler, so nothing wakes it
+// up but the due time it reads from the storage.
+func TestSchedulerNextDue(t *testing.T) {
+	for name, newStorage := range schedulerStorages() {
+		t.Run(name, func(t *testing.T) {
+			storage := newStorage(t)
+			start := time.Now()
+			if err := storage.Push(&textJob{Text: "due"}, start.Add(100*time.Millisecond)); err != nil {
+				t.Fatal(err)
+			}
+
+			deps := newTestDeps()
+			go omniq.New(storage, omniq.WithSleepDuration(time.Hour)).Listen(deps)
+			if r := deps.next(t); r.Text != "due" {
+				t.Errorf("got run %+v, want the due job", r)
+			}
+			if ran := time.Since(start); ran < 100*time.Millisecond {
+				t.Errorf("the job ran after %v, before it was due", ran)
+			}
+		})
+	}
+}
+
+func TestSchedulerScheduleMany(t *testing.T) {
+	for name, newStorage := range schedulerStorages() {
+		t.Run(name, func(t *testing.T) {
+			s, deps := listen(t, newStorage(t))
+
+			now := time.Now()
+			items := []omniq.Scheduled[*testDeps]{
+				{Job: &textJob{Text: "a"}, At: now},
+				{Job: &complexJob{Z: complex(1, 2)}, At: now},
+				{Job: &textJob{Text: "b"}, At: now.Add(20 * time.Millisecond)},
+			}
+			ids, err := s.ScheduleMany(items)
+			var bulkErr *omniq.BulkError
+			if !errors.As(err, &bulkErr) || len(bulkErr.Errors) != 1 || bulkErr.Errors[1] == nil {
+				t.Fatalf("ScheduleMany = %v, want a BulkError for the job JSON cannot encode", err)
+			}
+			if len(ids) != 3 || ids[0] == "" || ids[1] != "" || ids[2] == "" || ids[0] == ids[2] {
+				t.Fatalf("got IDs %q, want one for each job that was scheduled", ids)
+			}
+			for i, item := range items {
+				if got := item.Job.GetIDContainer().GetID(); got != ids[i] {
+					t.Errorf("item %d has ID %q, want %q", i, got, ids[i])
+				}
+			}
+
+			ran := map[omniq.JobID]string{}
+			for range 2 {
+				r := deps.next(t)
+				ran[r.ID] = r.Text
+			}
+			if ran[ids[0]] != "a" || ran[ids[2]] != "b" {
+				t.Errorf("got runs %v, want a as %s and b as %s", ran, ids[0], ids[2])
+			}
+			deps.none(t, 50*time.Millisecond)
+		})
+	}
+}
+
+// lateStorage claims nothing the first time, as if its job fell due just after
+// the scheduler looked.
+type lateStorage struct {
+	nextDueStorage
+	looked bool
+}
+
+type nextDueStorage interface {
+	omniq.SchedulerStorage[*testDeps]
+	omniq.NextDueStorage
+}
+
+func (s *lateStorage) GetDue() ([]omniq.Job[*testDeps], error) {
+	if !s.looked {
+		s.looked = true
+		return nil, nil
+	}
+	return s.nextDueStorage.GetDue()
+}
+
+func TestSchedulerOverdue(t *testing.T) {
+	storage := omniq.NewJSONStorage(filepath.Join(t.TempDir(), "jobs.json"), testFactory{})
+	if err := storage.Push(&textJob{Text: "overdue"}, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	deps := newTestDeps()
+	go omniq.New[*testDeps](&lateStorage{nextDueStorage: storage}, omniq.WithSleepDuration(time.Hour)).Listen(deps)
+	if r := deps.next(t); r.Text != "overdue" {
+		t.Errorf("got run %+v, want the overdue job", r)
+	}
+}
+
+func TestSchedulerUnique(t *testing.T) {
+	for name, newStorage := range schedulerStorages() {
+		t.Run(name, func(t *testing.T) {
+			s, deps := listen(t, newStorage(t))
+			ctx := context.Background()
+
+			first, err := s.Schedule(ctx, &uniqueJob{Key: "a", Text: "first"}, omniq.In(100*time.Millisecond))
+			if err != nil {
+				t.Fatal(err)
+			}
+			dup := &uniqueJob{Key: "a", Text: "duplicate"}
+			if id, err := s.Schedule(ctx, dup, omniq.In(100*time.Millisecond)); err != nil || id != first || dup.GetID() != first {
+				t.Errorf("scheduling a duplicate = %q, %v, want the pending job %q", id, err, first)
+			}
+			other, err := s.Schedule(ctx, &uniqueJob{Key: "b", Text: "other"}, omniq.In(100*time.Millisecond))
+			if err != nil || other == first {
+				t.Errorf("scheduling another key = %q, %v, want a new job", other, err)
+			}
+
+			ran := map[omniq.JobID]string{}
+			for range 2 {
+				r := deps.next(t)
+				ran[r.ID] = r.Text
+			}
+			if ran[first] != "first" || ran[other] != "other" {
+				t.Errorf("got runs %v, want first and other", ran)
+			}
+			deps.none(t, 50*time.Millisecond)
+
+			// The job ran, so nothing is pending to duplicate
+			again, err := s.Schedule(ctx, &uniqueJob{Key: "a", Text: "again"})
+			if err != nil || again == first {
+				t.Errorf("scheduling after the run = %q, %v, want a new job", again, err)
+			}
+			if r := deps.next(t); r.ID != again || r.Text != "again" {
+				t.Errorf("got run %+v, want again", r)
+			}
+		})
+	}
+}
+
+// recordingStorage records the order jobs are deleted in. It hides
+// BatchDeleteStorage, so the scheduler deletes one job at a time.
+type recordingStorage struct {
+	omniq.SchedulerStorage[*testDeps]
+	mu      sync.Mutex
+	deleted []omniq.JobID
+}
+
+func (s *recordingStorage) Delete(id omniq.JobID) error {
+	s.mu.Lock()
+	s.deleted = append(s.deleted, id)
+	s.mu.Unlock()
+	return s.SchedulerStorage.Delete(id)
+}
+
+func TestSchedulerPriority(t *testing.T) {
+	for name, newStorage := range schedulerStorages() {
+		t.Run(name, func(t *testing.T) {
+			storage := &recordingStorage{SchedulerStorage: newStorage(t)}
+			due := time.Now().Add(-time.Second)
+			ids := map[int]omniq.JobID{}
+			for _, level := range []int{0, 5, -1, 10} {
+				j := &priorityJob{Level: level}
+				if err := storage.Push(j, due); err != nil {
+					t.Fatal(err)
+				}
+				ids[level] = j.GetID()
+			}
+
+			// Runs start concurrently, so the order they are handed over in
+			// is the order they are acknowledged in
+			_, deps := listen(t, storage)
+			for range 4 {
+				deps.next(t)
+			}
+			storage.mu.Lock()
+			defer storage.mu.Unlock()
+			want := []omniq.JobID{ids[10], ids[5], ids[0], ids[-1]}
+			if !slices.Equal(storage.deleted, want) {
+				t.Errorf("jobs were acknowledged in the order %q, want %q", storage.deleted, want)
+			}
+		})
+	}
+}
+
+// noRetryStorage hides RetryStorage, so the scheduler retries in process.
+type noRetryStorage struct {
+	historyStorage
+}
+
+type historyStorage interface {
+	omniq.SchedulerStorage[*testDeps]
+	omniq.HistoryStorage
+}
+
+func TestSchedulerRetries(t *testing.T) {
+	storages := schedulerStorages()
+	storages["in process"] = func(t *testing.T) omniq.SchedulerStorage[*testDeps] {
+		return noRetryStorage{omniq.NewJSONStorage(filepath.Join(t.TempDir(), "jobs.json"), testFactory{})}
+	}
+	for name, newStorage := range storages {
+		t.Run(name, func(t *testing.T) {
+			s, deps := listen(t, newStorage(t))
+
+			id, err := s.Schedule(context.Background(), &failingJob{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for range 3 {
+				if r := deps.next(t); r.ID != id {
+					t.Errorf("got run %+v, want a run of %s", r, id)
+				}
+			}
+			deps.none(t, 50*time.Millisecond)
+
+			for i, rec := range history(t, s, id, 3) {
+				if rec.Status != omniq.JobFailed || rec.Attempts != i+1 || !strings.Contains(rec.Error, "failingJob failed") {
+					t.Errorf("got %+v, want failed attempt %d", rec, i+1)
+				}
+			}
+		})
+	}
+}
@@ -1,11 +1,99 @@
 package omniq
 
 import (
+	"database/sql"
+	"errors"
 	"time"
 )
 
+var ErrTxNotSupported = errors.New("omniq: storage does not support transactional enqueue")
+
+// claimLease is how long a job handed out by GetDue stays invisible to other
+// consumers. If it is not deleted within that window it becomes due again.
+const claimLease = 5 * time.Minute
+
 type SchedulerStorage[TDeps any] interface {
 	Push(j Job[TDeps], t time.Time) error
 	Delete(id JobID) error
 	GetDue() ([]Job[TDeps], error)
 }
+
+// Scheduled is a job together with the time it is due.
+type Scheduled[TDeps any] struct {
+	Job Job[TDeps]
+	At  time.Time
+}
+
+// Execer is satisfied by both *sql.DB and *sql.Tx.
+type Execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// TxStorage is implemented by storages that can enqueue a job as part of the
+// caller's database transaction.
+type TxStorage[TDeps any] interface {
+	PushTx(tx Execer, j Job[TDeps], t time.Time) error
+}
+
+// BatchDeleteStorage is implemented by storages that can acknowledge many jobs
+// in a single round-trip.
+type BatchDeleteStorage interface {
+	DeleteMany(ids []JobID) error
+}
+
+// NextDueStorage is implemented by storages that can report the earliest due
+// time among their jobs, so the scheduler can sleep exactly until then.
+type NextDueStorage interface {
+	NextDue() (time.Time, bool, error)
+}
+
+// NotifyingStorage is implemented by storages that can tell the scheduler when
+// new work may be due, so it does not have to poll.
+type NotifyingStorage interface {
+	// Wakeup is signalled when a job was pushed or a known due time passed.
+	Wakeup() <-chan struct{}
+	// Listening reports whether wake-ups are currently reliable. While it is
+	// false the scheduler falls back to polling.
+	Listening() bool
+}
+
+// HistoryStorage is implemented by storages that can keep a record of finished
+// jobs. Records are only written when the scheduler is created WithHistory.
+type HistoryStorage interface {
+	Archive(rec HistoryRecord) error
+	// History returns all records of the job, oldest first.
+	History(id JobID) ([]HistoryRecord, error)
+	// PruneHistory removes the records that finished before the cutoff and all
+	// but the newest keep records. A zero cutoff or keep disables that limit.
+	PruneHistory(before time.Time, keep int) (int, error)
+}
+
+// BulkStorage is implemented by storages that can enqueue many jobs with a
+// single write. IDs of jobs that could not be enqueued are left empty and
+// their errors reported in a *BulkError.
+type BulkStorage[TDeps any] interface {
+	PushMany(items []Scheduled[TDeps]) ([]JobID, error)
+}
+
+// RetryStorage is implemented by storages that can enqueue a failed job again,
+// so its retries outlive the process that ran it. Storages implementing it
+// count claims and report them through WithID.SetAttempts in GetDue.
+type RetryStorage[TDeps any] interface {
+	// PushRetry enqueues the job due at t under its current ID, replacing it
+	// if it is still stored, as if it had been claimed attempts times.
+	PushRetry(j Job[TDeps], t time.Time, attempts int) error
+}
+
+// QueryStorage is implemented by storages that can list their pending jobs.
+type QueryStorage interface {
+	Query(f JobFilter) (JobPage, error)
+}
+
+// DeadLetterStorage is implemented by storages that can set aside jobs that
+// cannot be run, such as ones whose payload no longer decodes.
+type DeadLetterStorage interface {
+	// DeadLetter moves a claimed job out of the queue, recording the reason.
+	DeadLetter(id JobID, reason string) error
+	// DeadLetters returns the jobs set aside so far, oldest first.
+	DeadLetters() ([]DeadLetter, error)
+}
@@ -0,0 +1,701 @@
+// Package storagetest is a conformance suite for omniq.SchedulerStorage
+// implementations. Call Run from a test in the package that implements the
+// storage:
+//
+//	func TestStorage(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T, factory omniq.JobFactory[struct{}]) omniq.SchedulerStorage[struct{}] {
+//			return NewMyStorage(factory)
+//		})
+//	}
+package storagetest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eugen-bondarev/omniq"
+)
+
+// NewStorage must return an empty storage that instantiates jobs with factory.
+type NewStorage func(t *testing.T, factory omniq.JobFactory[struct{}]) omniq.SchedulerStorage[struct{}]
+
+type TextJob struct {
+	omniq.WithID
+	Text string
+}
+
+func (j *TextJob) Run(struct{})                  {}
+func (j *TextJob) Type() string                  { return "TextJob" }
+func (j *TextJob) GetIDContainer() *omniq.WithID { return &j.WithID }
+
+type RichJob struct {
+	omniq.WithID
+	Number  float64
+	Flag    bool
+	Tags    []string
+	Nested  map[string]int
+	Unicode string
+}
+
+func (j *RichJob) Run(struct{})                  {}
+func (j *RichJob) Type() string                  { return "RichJob" }
+func (j *RichJob) GetIDContainer() *omniq.WithID { return &j.WithID }
+
+// CodecJob is stored with the codec it names rather than the storage's.
+type CodecJob struct {
+	omniq.WithID
+	Text  string
+	Count int
+	With  string
+}
+
+func (j *CodecJob) Run(struct{})                  {}
+func (j *CodecJob) Type() string                  { return "CodecJob" }
+func (j *CodecJob) GetIDContainer() *omniq.WithID { return &j.WithID }
+
+func (j *CodecJob) Codec() omniq.Codec {
+	c, err := omniq.LookupCodec(j.With)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// VersionedJob is at version 3. Factory records the version its payload came
+// back with in Loaded.
+type VersionedJob struct {
+	omniq.WithID
+	Text   string
+	Loaded int `json:"-" msgpack:"-"`
+}
+
+func (j *VersionedJob) Run(struct{})                  {}
+func (j *VersionedJob) Type() string                  { return "VersionedJob" }
+func (j *VersionedJob) GetIDContainer() *omniq.WithID { return &j.WithID }
+func (j *VersionedJob) Version() int                  { return 3 }
+
+// UnknownJob is what Factory instantiates for types it does not know. It keeps
+// the raw type and payload so the suite can check the storage passed them through.
+type UnknownJob struct {
+	omniq.WithID
+	TypeName string
+	Data     string
+}
+
+func (j *UnknownJob) Run(struct{})                  {}
+func (j *UnknownJob) Type() string                  { return j.TypeName }
+func (j *UnknownJob) GetIDContainer() *omniq.WithID { return &j.WithID }
+
+// Factory instantiates the suite's job types.
+type Factory struct{}
+
+func (f *Factory) Instantiate(t string, id omniq.JobID, payload omniq.Payload) (omniq.Job[struct{}], error) {
+	var j omniq.Job[struct{}]
+	switch t {
+	case "TextJob":
+		j = &TextJob{}
+	case "RichJob":
+		j = &RichJob{}
+	case "CodecJob":
+		j = &CodecJob{}
+	case "VersionedJob":
+		j = &VersionedJob{Loaded: payload.Version}
+	default:
+		return &UnknownJob{WithID: omniq.WithID{ID: id}, TypeName: t, Data: string(payload.Data)}, nil
+	}
+	if err := payload.Decode(j); err != nil {
+		return nil, fmt.Errorf("storagetest: decoding %s: %w", t, err)
+	}
+	j.GetIDContainer().SetID(id)
+	return j, nil
+}
+
+// Run runs the whole conformance suite against storages built by newStorage.
+func Run(t *testing.T, newStorage NewStorage) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s omniq.SchedulerStorage[struct{}])
+	}{
+		{"PushGetDueDelete", testPushGetDueDelete},
+		{"Ordering", testOrdering},
+		{"FutureJobsAreNotDue", testFutureJobsAreNotDue},
+		{"DueAtNow", testDueAtNow},
+		{"ClaimedJobsAreNotRedelivered", testClaimedJobsAreNotRedelivered},
+		{"ConcurrentClaim", testConcurrentClaim},
+		{"IDRoundTrip", testIDRoundTrip},
+		{"DeleteMissing", testDeleteMissing},
+		{"UnknownTypes", testUnknownTypes},
+		{"PayloadFidelity", testPayloadFidelity},
+		{"LargePayload", testLargePayload},
+		{"PushMany", testPushMany},
+		{"Query", testQuery},
+		{"Codecs", testCodecs},
+		{"PoisonJobs", testPoisonJobs},
+		{"Versions", testVersions},
+		{"Retry", testRetry},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStorage(t, &Factory{}))
+		})
+	}
+}
+
+func push(t *testing.T, s omniq.SchedulerStorage[struct{}], j omniq.Job[struct{}], at time.Time) omniq.JobID {
+	t.Helper()
+	if err := s.Push(j, at); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	return j.GetIDContainer().GetID()
+}
+
+func getDue(t *testing.T, s omniq.SchedulerStorage[struct{}]) []omniq.Job[struct{}] {
+	t.Helper()
+	due, err := s.GetDue()
+	if err != nil {
+		t.Fatalf("GetDue: %v", err)
+	}
+	return due
+}
+
+func ids(jobs []omniq.Job[struct{}]) []omniq.JobID {
+	out := make([]omniq.JobID, len(jobs))
+	for i, j := range jobs {
+		out[i] = j.GetIDContainer().GetID()
+	}
+	return out
+}
+
+func testPushGetDueDelete(t *testing.T, s omniq.SchedulerStorage[struct{}]) {
+	past := time.Now().Add(-time.Minute)
+	id := push(t, s, &TextJob{Text: "hello"}, past)
+
+	due := getDue(t, s)
+	if len(due) != 1 {
+		t.Fatalf("GetDue returned %d jobs, want 1", len(due))
+	}
+	j, ok := due[0].(*TextJob)
+	if !ok {
+		t.Fatalf("GetDue returned %T, want *TextJob", due[0])
+	}
+	if j.Text != "hello" {
+		t.Errorf("Text = %q, want %q", j.Text, "hello")
+	}
+	if j.GetID() != id {
+		t.Errorf("ID = %q, want %q", j.GetID(), id)
+	}
+
+	if err := s.Delete(id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if due := getDue(t, s); len(due) != 0 {
+		t.Errorf("GetDue after Delete returned %d jobs, want 0", len(due))
+	}
+}
+
+func testOrdering(t *testing.T, s omniq.SchedulerStorage[struct{}]) {
+	now := time.Now()
+	third := push(t, s, &TextJob{Text: "third"}, now.Add(-1*time.Second))
+	first := push(t, s, &TextJob{Text: "first"}, now.Add(-3*time.Second))
+	second := push(t, s, &TextJob{Text: "second"}, now.Add(-2*time.Second))
+
+	got := ids(getDue(t, s))
+	want := []omniq.JobID{first, second, third}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("GetDue order = %v, want %v", got, want)
+	}
+}
+
+func testFutureJobsAreNotDue(t *testing.T, s omniq.SchedulerStorage[struct{}]) {
+	push(t, s, &TextJob{Text: "later"}, time.Now().Add(time.Hour))
+	if due := getDue(t, s); len(due) != 0 {
+		t.Errorf("GetDue returned %d jobs, want 0", len(due))
+	}
+}
+
+// testDueAtNow pins down the boundary: a job scheduled for exactly "now" is
+// due, i.e. storages compare with time <= now rather than time < now.
+func testDueAtNow(t *testing.T, s omniq.SchedulerStorage[struct{}]) {
+	id := push(t, s, &TextJob{Text: "now"}, time.Now())
+	got := ids(getDue(t, s))
+	if len(got) != 1 || got[0] != id {
+		t.Errorf("GetDue = %v, want [%v]", got, id)
+	}
+}
+
+func testClaimedJobsAreNotRedelivered(t *testing.T, s omniq.SchedulerStorage[struct{}]) {
+	push(t, s, &TextJob{Text: "once"}, time.Now().Add(-time.Second))
+	if due := getDue(t, s); len(due) != 1 {
+		t.Fatalf("first GetDue returned %d jobs, want 1", len(due))
+	}
+	if due := getDue(t, s); len(due) != 0 {
+		t.Errorf("second GetDue returned %d jobs, want 0", len(due))
+	}
+}
+
+func testConcurrentClaim(t *testing.T, s omniq.SchedulerStorage[struct{}]) {
+	const jobs = 50
+	const workers = 8
+
+	pushed := map[omniq.JobID]bool{}
+	for i := range jobs {
+		pushed[push(t, s, &TextJob{Text: fmt.Sprint(i)}, time.Now().Add(-time.Second))] = true
+	}
+
+	var mu sync.Mutex
+	seen := map[omniq.JobID]int{}
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			due, err := s.GetDue()
+			if err != nil {
+				t.Errorf("GetDue: %v", err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, id := range ids(due) {
+				seen[id]++
+			}
+		}()
+	}
+	wg.Wait()
+
+	for id, n := range seen {
+		if n > 1 {
+			t.Errorf("job %v was claimed %d times", id, n)
+		}
+		if !pushed[id] {
+			t.Errorf("GetDue returned unknown job %v", id)
+		}
+	}
+}
+
+func testIDRoundTrip(t *testing.T, s omniq.SchedulerStorage[struct{}]) {
+	a := push(t, s, &TextJob{Text: "a"}, time.Now().Add(-2*time.Second))
+	b := push(t, s, &TextJob{Text: "b"}, time.Now().Add(-1*time.Second))
+	if a == "" || b == "" {
+		t.Fatalf("Push did not set the job ID: %q, %q", a, b)
+	}
+	if a == b {
+		t.Fatalf("Push assigned the same ID twice: %q", a)
+	}
+
+	due := getDue(t, s)
+	if len(due) != 2 {
+		t.Fatalf("GetDue returned %d jobs, want 2", len(due))
+	}
+	for _, j := range due {
+		id := j.GetIDContainer().GetID()
+		want := map[string]omniq.JobID{"a": a, "b": b}[j.(*TextJob).Text]
+		if id != want {
+			t.Errorf("job %q came back with ID %q, want %q", j.(*TextJob).Text, id, want)
+		}
+		if err := s.Delete(id); err != nil {
+			t.Errorf("Delete(%q): %v", id, err)
+		}
+	}
+	if due := getDue(t, s); len(due) != 0 {
+		t.Errorf("GetDue after deleting by returned IDs returned %d jobs, want 0", len(due))
+	}
+}
+
+func testDeleteMissing(t *testing.T, s omniq.SchedulerStorage[struct{}]) {
+	j := &TextJob{Text: "gone"}
+	id := push(t, s, j, time.Now().Add(-time.Second))
+	if err := s.Delete(id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := s.Delete(id); err != nil {
+		t.Errorf("deleting an already deleted job: %v", err)
+	}
+}
+
+// testUnknownTypes checks that storages do not interpret job types: the type
+// name and payload reach the factory verbatim even if it has never heard of them.
+func testUnknownTypes(t *testing.T, s omniq.SchedulerStorage[struct{}]) {
+	typeName := "legacy.Job/v2 ü"
+	push(t, s, &UnknownJob{TypeName: typeName, Data: "payload"}, time.Now().Add(-time.Second))
+
+	due := getDue(t, s)
+	if len(due) != 1 {
+		t.Fatalf("GetDue returned %d jobs, want 1", len(due))
+	}
+	j, ok := due[0].(*UnknownJob)
+	if !ok {
+		t.Fatalf("GetDue returned %T, want *UnknownJob", due[0])
+	}
+	if j.TypeName != typeName {
+		t.Errorf("type = %q, want %q", j.TypeName, typeName)
+	}
+	var state UnknownJob
+	if err := json.Unmarshal([]byte(j.Data), &state); err != nil {
+		t.Fatalf("payload is not the pushed JSON: %v", err)
+	}
+	if state.Data != "payload" {
+		t.Errorf("payload Data = %q, want %q", state.Data, "payload")
+	}
+}
+
+func testPayloadFidelity(t *testing.T, s omniq.SchedulerStorage[struct{}]) {
+	in := &RichJob{
+		Number:  3.25,
+		Flag:    true,
+		Tags:    []string{"a", "b"},
+		Nested:  map[string]int{"x": 1},
+		Unicode: "héllo, 世界 \"quoted\"\n",
+	}
+	push(t, s, in, time.Now().Add(-time.Second))
+
+	due := getDue(t, s)
+	if len(due) != 1 {
+		t.Fatalf("GetDue returned %d jobs, want 1", len(due))
+	}
+	out := due[0].(*RichJob)
+	if fmt.Sprint(out.Number, out.Flag, out.Tags, out.Nested, out.Unicode) !=
+		fmt.Sprint(in.Number, in.Flag, in.Tags, in.Nested, in.Unicode) {
+		t.Errorf("payload = %+v, want %+v", out, in)
+	}
+}
+
+func testLargePayload(t *testing.T, s omniq.SchedulerStorage[struct{}]) {
+	text := strings.Repeat("0123456789abcdef", 1<<16)
+	push(t, s, &TextJob{Text: text}, time.Now().Add(-time.Second))
+
+	due := getDue(t, s)
+	if len(due) != 1 {
+		t.Fatalf("GetDue returned %d jobs, want 1", len(due))
+	}
+	if got := due[0].(*TextJob).Text; got != text {
+		t.Errorf("payload of %d bytes came back as %d bytes", len(text), len(got))
+	}
+}
+
+// badJob cannot be marshaled, so pushing it must fail.
+type badJob struct {
+	omniq.WithID
+	C chan int
+}
+
+func (j *badJob) Run(struct{})                  {}
+func (j *badJob) Type() string                  { return "badJob" }
+func (j *badJob) GetIDContainer() *omniq.WithID { return &j.WithID }
+
+func testPushMany(t *testing.T, s omniq.SchedulerStorage[struct{}]) {
+	bulk, ok := s.(omniq.BulkStorage[struct{}])
+	if !ok {
+		t.Skip("storage does not implement BulkStorage")
+	}
+
+	now := time.Now()
+	items := []omniq.Scheduled[struct{}]{
+		{Job: &TextJob{Text: "b"}, At: now.Add(-1 * time.Second)},
+		{Job: &badJob{C: make(chan int)}, At: now.Add(-3 * time.Second)},
+		{Job: &TextJob{Text: "a"}, At: now.Add(-2 * time.Second)},
+		{Job: &TextJob{Text: "later"}, At: now.Add(time.Hour)},
+	}
+	pushed, err := bulk.PushMany(items)
+	var bulkErr *omniq.BulkError
+	if !errors.As(err, &bulkErr) || len(bulkErr.Errors) != 1 || bulkErr.Errors[1] == nil {
+		t.Fatalf("PushMany returned %v, want a BulkError for item 1 only", err)
+	}
+	if len(pushed) != len(items) || pushed[1] != "" {
+		t.Fatalf("PushMany returned IDs %q, want one per item and none for item 1", pushed)
+	}
+	for i, item := range items {
+		if got := item.Job.GetIDContainer().GetID(); got != pushed[i] {
+			t.Errorf("item %d has ID %q, PushMany returned %q", i, got, pushed[i])
+		}
+	}
+
+	due := getDue(t, s)
+	if len(due) != 2 {
+		t.Fatalf("GetDue returned %d jobs, want 2", len(due))
+	}
+	if got := []omniq.JobID{due[0].GetIDContainer().GetID(), due[1].GetIDContainer().GetID()}; got[0] != pushed[2] || got[1] != pushed[0] {
+		t.Errorf("GetDue returned %q, want %q", got, []omniq.JobID{pushed[2], pushed[0]})
+	}
+}
+
+func testQuery(t *testing.T, s omniq.SchedulerStorage[struct{}]) {
+	qs, ok := s.(omniq.QueryStorage)
+	if !ok {
+		t.Skip("storage does not implement QueryStorage")
+	}
+	query := func(f omniq.JobFilter) omniq.JobPage {
+		t.Helper()
+		page, err := qs.Query(f)
+		if err != nil {
+			t.Fatalf("Query(%+v): %v", f, err)
+		}
+		return page
+	}
+	pageIDs := func(page omniq.JobPage) []omniq.JobID {
+		ids := []omniq.JobID{}
+		for _, j := range page.Jobs {
+			ids = append(ids, j.ID)
+		}
+		return ids
+	}
+
+	now := time.Now()
+	a := push(t, s, &TextJob{Text: "a"}, now.Add(-2*time.Second))
+	rich := push(t, s, &RichJob{Number: 7, Tags: []string{"x", "y"}}, now.Add(-1*time.Second))
+	later := push(t, s, &TextJob{Text: "later"}, now.Add(time.Hour))
+
+	all := query(omniq.JobFilter{})
+	if all.Total != 3 || !slices.Equal(pageIDs(all), []omniq.JobID{a, rich, later}) {
+		t.Fatalf("Query() returned %q (total %d), want all 3 jobs by due time", pageIDs(all), all.Total)
+	}
+	if j := all.Jobs[0]; j.Type != "TextJob" || j.Queue != omniq.DefaultQueue || j.State != omniq.JobDue || j.Attempts != 0 {
+		t.Errorf("Query() described job a as %+v", j)
+	}
+
+	cases := []struct {
+		name   string
+		filter omniq.JobFilter
+		want   []omniq.JobID
+		total  int
+	}{
+		{"Types", omniq.JobFilter{Types: []string{"TextJob"}}, []omniq.JobID{a, later}, 2},
+		{"States", omniq.JobFilter{States: []omniq.JobState{omniq.JobScheduled}}, []omniq.JobID{later}, 1},
+		{"Queues", omniq.JobFilter{Queues: []string{"other"}}, []omniq.JobID{}, 0},
+		{"DueRange", omniq.JobFilter{DueAfter: now.Add(-1500 * time.Millisecond), DueBefore: now}, []omniq.JobID{rich}, 1},
+		{"Payload", omniq.JobFilter{Payload: map[string]any{"Text": "later"}}, []omniq.JobID{later}, 1},
+		{"NestedPayload", omniq.JobFilter{Payload: map[string]any{"Number": 7, "Tags": []string{"y"}}}, []omniq.JobID{rich}, 1},
+		{"Pagination", omniq.JobFilter{Limit: 1, Offset: 1}, []omniq.JobID{rich}, 3},
+		{"PastTheEnd", omniq.JobFilter{Offset: 5}, []omniq.JobID{}, 3},
+	}
+	for _, c := range cases {
+		page := query(c.filter)
+		if page.Total != c.total || !slices.Equal(pageIDs(page), c.want) {
+			t.Errorf("%s: Query returned %q (total %d), want %q (total %d)", c.name, pageIDs(page), page.Total, c.want, c.total)
+		}
+	}
+
+	getDue(t, s)
+	// Both leases expire at the same time, so the order is up to the storage
+	claimed := query(omniq.JobFilter{States: []omniq.JobState{omniq.JobClaimed}})
+	if got := pageIDs(claimed); len(got) != 2 || !slices.Contains(got, a) || !slices.Contains(got, rich) {
+		t.Fatalf("Query for claimed jobs returned %q, want %q", got, []omniq.JobID{a, rich})
+	}
+	if claimed.Jobs[0].Attempts != 1 {
+		t.Errorf("claimed job has %d attempts, want 1", claimed.Jobs[0].Attempts)
+	}
+}
+
+// testCodecs checks that jobs naming their own codec come back intact, and
+// that the codec name is stored with them.
+func testCodecs(t *testing.T, s omniq.SchedulerStorage[struct{}]) {
+	codecs := []string{"json", "gob", "msgpack"}
+	pushed := map[omniq.JobID]string{}
+	for i, name := range codecs {
+		id := push(t, s, &CodecJob{Text: "héllo " + name, Count: i + 1, With: name}, time.Now().Add(-time.Second))
+		pushed[id] = name
+	}
+
+	if qs, ok := s.(omniq.QueryStorage); ok {
+		page, err := qs.Query(omniq.JobFilter{})
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		for _, j := range page.Jobs {
+			if j.Payload.Codec != pushed[j.ID] {
+				t.Errorf("Query reports codec %q for a %s job", j.Payload.Codec, pushed[j.ID])
+			}
+		}
+		page, err = qs.Query(omniq.JobFilter{Payload: map[string]any{"Count": 2}})
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		if page.Total != 0 {
+			t.Errorf("a payload filter matched %d jobs not stored as JSON", page.Total)
+		}
+	}
+
+	due := getDue(t, s)
+	if len(due) != len(codecs) {
+		t.Fatalf("GetDue returned %d jobs, want %d", len(due), len(codecs))
+	}
+	for _, j := range due {
+		got, ok := j.(*CodecJob)
+		if !ok {
+			t.Fatalf("GetDue returned %T, want *CodecJob", j)
+		}
+		name := pushed[got.ID]
+		if got.With != name || got.Text != "héllo "+name || got.Count != slices.Index(codecs, name)+1 {
+			t.Errorf("%s job came back as %+v", name, got)
+		}
+	}
+}
+
+// brokenJob claims to be a RichJob but stores Number as a string, so the
+// factory cannot decode it.
+type brokenJob struct {
+	omniq.WithID
+	Number string
+}
+
+func (j *brokenJob) Run(struct{})                  {}
+func (j *brokenJob) Type() string                  { return "RichJob" }
+func (j *brokenJob) GetIDContainer() *omniq.WithID { return &j.WithID }
+
+// testPoisonJobs checks that a job the factory rejects comes back as a
+// PoisonJob without holding up the others, and that dead-lettering takes it
+// out of the queue.
+func testPoisonJobs(t *testing.T, s omniq.SchedulerStorage[struct{}]) {
+	broken := push(t, s, &brokenJob{Number: "seven"}, time.Now().Add(-2*time.Second))
+	good := push(t, s, &TextJob{Text: "fine"}, time.Now().Add(-1*time.Second))
+
+	due := getDue(t, s)
+	if got := ids(due); !slices.Equal(got, []omniq.JobID{broken, good}) {
+		t.Fatalf("GetDue returned %q, want %q", got, []omniq.JobID{broken, good})
+	}
+	poison, ok := due[0].(*omniq.PoisonJob[struct{}])
+	if !ok {
+		t.Fatalf("GetDue returned %T for the broken job, want *omniq.PoisonJob", due[0])
+	}
+	if poison.Err == nil || poison.TypeName != "RichJob" {
+		t.Errorf("poison job = %+v, want type RichJob and an error", poison)
+	}
+	if _, ok := due[1].(*TextJob); !ok {
+		t.Errorf("GetDue returned %T for the good job, want *TextJob", due[1])
+	}
+
+	dls, ok := s.(omniq.DeadLetterStorage)
+	if !ok {
+		return
+	}
+	if err := dls.DeadLetter(broken, "does not decode"); err != nil {
+		t.Fatalf("DeadLetter: %v", err)
+	}
+	if err := dls.DeadLetter("00000000-0000-0000-0000-000000000000", "missing"); err != nil {
+		t.Errorf("dead-lettering a missing job: %v", err)
+	}
+
+	letters, err := dls.DeadLetters()
+	if err != nil {
+		t.Fatalf("DeadLetters: %v", err)
+	}
+	if len(letters) != 1 {
+		t.Fatalf("DeadLetters returned %d entries, want 1", len(letters))
+	}
+	d := letters[0]
+	if d.ID != broken || d.Type != "RichJob" || d.Queue != omniq.DefaultQueue || d.Attempts != 1 || d.Error != "does not decode" || d.FailedAt.IsZero() {
+		t.Errorf("dead letter = %+v", d)
+	}
+	var state brokenJob
+	if err := d.Payload.Decode(&state); err != nil || state.Number != "seven" {
+		t.Errorf("dead letter payload decoded to %+v, %v", state, err)
+	}
+
+	if qs, ok := s.(omniq.QueryStorage); ok {
+		page, err := qs.Query(omniq.JobFilter{})
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		if page.Total != 1 || page.Jobs[0].ID != good {
+			t.Errorf("Query after DeadLetter returned %d jobs, want only %q", page.Total, good)
+		}
+	}
+}
+
+// testVersions checks that the version of a payload is stored with it, and
+// that jobs without one come back as version 1.
+func testVersions(t *testing.T, s omniq.SchedulerStorage[struct{}]) {
+	versioned := push(t, s, &VersionedJob{Text: "v3"}, time.Now().Add(-2*time.Second))
+	push(t, s, &TextJob{Text: "v1"}, time.Now().Add(-1*time.Second))
+
+	if qs, ok := s.(omniq.QueryStorage); ok {
+		page, err := qs.Query(omniq.JobFilter{})
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		for _, j := range page.Jobs {
+			want := 1
+			if j.ID == versioned {
+				want = 3
+			}
+			if j.Payload.Version != want {
+				t.Errorf("Query reports version %d for a %s, want %d", j.Payload.Version, j.Type, want)
+			}
+		}
+	}
+
+	due := getDue(t, s)
+	if len(due) != 2 {
+		t.Fatalf("GetDue returned %d jobs, want 2", len(due))
+	}
+	j, ok := due[0].(*VersionedJob)
+	if !ok {
+		t.Fatalf("GetDue returned %T, want *VersionedJob", due[0])
+	}
+	if j.Loaded != 3 || j.Text != "v3" {
+		t.Errorf("versioned job came back as %+v, want version 3", j)
+	}
+}
+
+func testRetry(t *testing.T, s omniq.SchedulerStorage[struct{}]) {
+	rs, ok := s.(omniq.RetryStorage[struct{}])
+	if !ok {
+		t.Skip("storage does not implement RetryStorage")
+	}
+
+	id := push(t, s, &TextJob{Text: "first"}, time.Now().Add(-time.Second))
+	due := getDue(t, s)
+	if len(due) != 1 {
+		t.Fatalf("GetDue returned %d jobs, want 1", len(due))
+	}
+	if n := due[0].GetIDContainer().GetAttempts(); n != 1 {
+		t.Errorf("first claim reported %d attempts, want 1", n)
+	}
+
+	// A retry replaces the job if it is still claimed
+	j := due[0].(*TextJob)
+	j.Text = "second"
+	if err := rs.PushRetry(j, time.Now().Add(-time.Second), 1); err != nil {
+		t.Fatalf("PushRetry: %v", err)
+	}
+	due = getDue(t, s)
+	if len(due) != 1 {
+		t.Fatalf("GetDue after PushRetry returned %d jobs, want 1", len(due))
+	}
+	got, ok := due[0].(*TextJob)
+	if !ok || got.ID != id || got.Text != "second" {
+		t.Fatalf("GetDue after PushRetry returned %+v, want the job %v with the text second", due[0], id)
+	}
+	if n := got.GetAttempts(); n != 2 {
+		t.Errorf("claim after PushRetry reported %d attempts, want 2", n)
+	}
+
+	// and enqueues it again if it was deleted
+	if err := s.Delete(id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := rs.PushRetry(got, time.Now().Add(time.Hour), 2); err != nil {
+		t.Fatalf("PushRetry: %v", err)
+	}
+	if due := getDue(t, s); len(due) != 0 {
+		t.Errorf("GetDue returned %d jobs, want the retry to wait", len(due))
+	}
+	qs, ok := s.(omniq.QueryStorage)
+	if !ok {
+		return
+	}
+	page, err := qs.Query(omniq.JobFilter{})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(page.Jobs) != 1 || page.Jobs[0].ID != id || page.Jobs[0].Attempts != 2 {
+		t.Errorf("Query returned %+v, want the job %v with 2 attempts", page.Jobs, id)
+	}
+}
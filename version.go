@@ -0,0 +1,86 @@
+package omniq
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Versioned is implemented by jobs whose stored shape changed over time. The
+// version is stored with the payload; jobs that do not implement it are
+// version 1.
+type Versioned interface {
+	Version() int
+}
+
+func jobVersion(j any) int {
+	if v, ok := j.(Versioned); ok && v.Version() > 1 {
+		return v.Version()
+	}
+	return 1
+}
+
+// Upcaster migrates the decoded state of a job by one version, e.g. by
+// renaming a key. JSON numbers arrive as json.Number.
+type Upcaster func(state map[string]any) error
+
+// Upcast brings a payload stored at an older version up to version. steps[i]
+// migrates version i+1 to i+2; a nil step means the state needs no change,
+// as when a field was only added. Payloads already at version are returned as
+// they are, and ones from a newer version than this build knows are an error.
+//
+// The state is decoded into a map and re-encoded with the payload's codec, so
+// upcasting needs a codec that can do that, such as JSON or msgpack.
+func Upcast(p Payload, version int, steps ...Upcaster) (Payload, error) {
+	from := p.version()
+	if from == version {
+		return p, nil
+	}
+	if from > version {
+		return p, fmt.Errorf("omniq: payload is version %d, newer than %d", from, version)
+	}
+	if !hasUpcasters(steps, from, version) {
+		p.Version = version
+		return p, nil
+	}
+
+	c, err := LookupCodec(p.Codec)
+	if err != nil {
+		return p, err
+	}
+	state := map[string]any{}
+	if p.IsJSON() {
+		dec := json.NewDecoder(bytes.NewReader(p.Data))
+		dec.UseNumber()
+		err = dec.Decode(&state)
+	} else {
+		err = c.Unmarshal(p.Data, &state)
+	}
+	if err != nil {
+		return p, fmt.Errorf("omniq: decoding version %d payload for upcasting: %w", from, err)
+	}
+
+	for v := from; v < version; v++ {
+		if v-1 >= len(steps) || steps[v-1] == nil {
+			continue
+		}
+		if err := steps[v-1](state); err != nil {
+			return p, fmt.Errorf("omniq: upcasting from version %d: %w", v, err)
+		}
+	}
+
+	data, err := c.Marshal(state)
+	if err != nil {
+		return p, err
+	}
+	return Payload{Codec: c.Name(), Version: version, Data: data}, nil
+}
+
+func hasUpcasters(steps []Upcaster, from, to int) bool {
+	for v := from; v < to && v-1 < len(steps); v++ {
+		if steps[v-1] != nil {
+			return true
+		}
+	}
+	return false
+}
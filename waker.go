@@ -0,0 +1,22 @@
+package omniq
+
+// waker coalesces wake-up signals: any number of wakes while nobody is
+// waiting collapse into a single pending signal.
+type waker struct {
+	ch chan struct{}
+}
+
+func newWaker() *waker {
+	return &waker{ch: make(chan struct{}, 1)}
+}
+
+func (w *waker) C() <-chan struct{} {
+	return w.ch
+}
+
+func (w *waker) wake() {
+	select {
+	case w.ch <- struct{}{}:
+	default:
+	}
+}